@@ -1,13 +1,19 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"encoding/gob"
+	"errors"
+	"flag"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/perbu/minirag/pkg/embedder"
@@ -20,12 +26,14 @@ var docsFS embed.FS
 
 const checkpointPath = "embeddings/checkpoint.gob"
 
+const outputPath = "embeddings/index.gob"
+
+// checkpoint holds the embeddings generated so far, by minirag.ChunkHash,
+// so a run interrupted while the docs are edited still resumes
 type checkpoint struct {
-	Chunks     []minirag.Chunk
-	Embeddings [][]float32
-	Completed  map[int]bool // Track which chunks are done
-	ModelInfo  string
-	Dimension  int
+	ByHash    map[string][]float32
+	ModelInfo string
+	Dimension int
 }
 
 func loadCheckpoint() (*checkpoint, error) {
@@ -71,15 +79,100 @@ func saveCheckpoint(cp *checkpoint) error {
 	return os.Rename(checkpointPath+".tmp", checkpointPath)
 }
 
+// batchEmbedder is an embedding backend with progress reporting
+type batchEmbedder interface {
+	embedder.Embedder
+	EmbedBatchWithProgressContext(ctx context.Context, texts []string, progressFn func(int, int)) ([][]float32, error)
+}
+
+// withProgress reports progress once the whole batch is embedded, for
+// embedders that run locally and quickly
+type withProgress struct {
+	embedder.Embedder
+}
+
+func (w withProgress) EmbedBatchWithProgressContext(ctx context.Context, texts []string, progressFn func(int, int)) ([][]float32, error) {
+	embeddings, err := w.EmbedBatchContext(ctx, texts)
+	if err == nil && progressFn != nil {
+		progressFn(len(texts), len(texts))
+	}
+	return embeddings, err
+}
+
+// defaultCacheDir is the embedding cache under the user's cache directory,
+// or empty, disabling the cache, when there is none
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "minirag", "embeddings")
+}
+
+// envOr returns the environment variable key, or def when it is not set
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
 func main() {
 	// Load .env file if it exists
 	_ = godotenv.Load()
 
+	buildHNSW := flag.Bool("hnsw", false, "build an HNSW graph for approximate search")
+	ivfLists := flag.Int("ivf", 0, "build an IVF index with this many k-means clusters (-1 picks sqrt(chunks))")
+	int8Scale := flag.String("int8", "", "quantize embeddings to int8 with 'vector' or 'dimension' scales")
+	int8Rescore := flag.Int("int8-rescore", 4, "candidates rescored with float32 vectors, as a multiple of top-k")
+	int8Only := flag.Bool("int8-only", false, "store only int8 codes, dropping float32 vectors (with -int8, about 4x smaller)")
+	buildBinary := flag.Bool("binary", false, "store sign bits for a Hamming-distance prefilter")
+	pqSubVectors := flag.Int("pq", 0, "train product quantization codebooks with this many sub-vectors (with -ivf: IVF-PQ)")
+	pqRescore := flag.Int("pq-rescore", 4, "candidates rescored with float32 vectors, as a multiple of top-k")
+	pqOnly := flag.Bool("pq-only", false, "store only PQ codes, dropping float32 vectors (with -pq)")
+	buildBM25 := flag.Bool("bm25", true, "build a BM25 index for lexical and hybrid search")
+	backend := flag.String("backend", "openai", "embedding backend: openai, ollama for a local Ollama server at OLLAMA_HOST, bert for a local model directory given by -model, or hash for offline n-gram hashing")
+	model := flag.String("model", "", "embedding model (default: OPENAI_EMBEDDING_MODEL or text-embedding-3-small; nomic-embed-text with ollama)")
+	requestsPerMinute := flag.Int("rpm", 0, "limit OpenAI requests per minute (0 is unlimited)")
+	tokensPerMinute := flag.Int("tpm", 0, "limit estimated OpenAI tokens per minute (0 is unlimited)")
+	cacheDir := flag.String("cache", defaultCacheDir(), "directory caching OpenAI and Ollama embeddings across runs (empty disables)")
+	rebuild := flag.Bool("rebuild", false, "embed every chunk, instead of reusing the embeddings of unchanged chunks in the previous index")
+	searchMode := flag.String("mode", "auto", "default search mode stored in the index: auto, exact, hnsw, ivf, int8, binary, pq")
+	flag.Parse()
+
+	// Check the index options before paying for any embeddings
+	var scale minirag.QuantizationScale
+	switch *int8Scale {
+	case "", "vector":
+		scale = minirag.PerVector
+	case "dimension":
+		scale = minirag.PerDimension
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown int8 scale %q (want 'vector' or 'dimension')\n", *int8Scale)
+		os.Exit(1)
+	}
+	if *int8Only && *int8Scale == "" {
+		fmt.Fprintf(os.Stderr, "Error: -int8-only needs -int8\n")
+		os.Exit(1)
+	}
+	if *pqOnly && *pqSubVectors <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: -pq-only needs -pq\n")
+		os.Exit(1)
+	}
+	mode, err := minirag.ParseSearchMode(*searchMode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
 	fmt.Println("MiniRAG Embedding Generation Tool")
 	fmt.Println("==================================")
 	fmt.Println()
 
 	// Setup signal handling for graceful shutdown
+	// Cancelling ctx aborts embedding requests still in flight
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	var cpMutex sync.Mutex
@@ -87,6 +180,7 @@ func main() {
 
 	go func() {
 		<-sigChan
+		cancel()
 		fmt.Println("\n\n⚠ Interrupt received, saving checkpoint...")
 		cpMutex.Lock()
 		if currentCP != nil {
@@ -100,10 +194,30 @@ func main() {
 		os.Exit(0)
 	}()
 
-	// Verify API key
-	if os.Getenv("OPENAI_API_KEY") == "" {
+	switch *backend {
+	case "openai":
+		if *model == "" {
+			*model = envOr("OPENAI_EMBEDDING_MODEL", "text-embedding-3-small")
+		}
+	case "ollama":
+		if *model == "" {
+			*model = "nomic-embed-text"
+		}
+	case "bert":
+		if *model == "" {
+			fmt.Fprintf(os.Stderr, "Error: -backend bert needs -model with the model directory\n")
+			os.Exit(1)
+		}
+	case "hash":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown backend %q (use openai, ollama, bert or hash)\n", *backend)
+		os.Exit(1)
+	}
+
+	// Verify API key; a self-hosted gateway at OPENAI_BASE_URL may not need one
+	if *backend == "openai" && os.Getenv("OPENAI_API_KEY") == "" && os.Getenv("OPENAI_BASE_URL") == "" {
 		fmt.Fprintf(os.Stderr, "Error: OPENAI_API_KEY environment variable not set\n")
-		fmt.Fprintf(os.Stderr, "Please set it in .env file or environment\n")
+		fmt.Fprintf(os.Stderr, "Please set it (or OPENAI_BASE_URL) in .env file or environment\n")
 		os.Exit(1)
 	}
 
@@ -116,49 +230,128 @@ func main() {
 	}
 	fmt.Printf("  ✓ Loaded %d chunks from documents\n\n", len(chunks))
 
-	// Step 2: Initialize OpenAI embedder
-	fmt.Println("Step 2: Initializing OpenAI embedder...")
-	model := "text-embedding-3-small"
-	emb, err := embedder.NewOpenAIEmbedder(model)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error initializing embedder: %v\n", err)
-		os.Exit(1)
+	// Step 2: Initialize the embedder
+	fmt.Printf("Step 2: Initializing %s embedder...\n", *backend)
+	var emb batchEmbedder
+	var api *embedder.OpenAIEmbedder
+	var window int // Texts embedded between checkpoints
+	switch *backend {
+	case "hash":
+		// IDF is fitted on the chunks; the minirag CLI refits it on the
+		// chunks stored in the index
+		hash := embedder.NewHashEmbedder(embedder.HashConfig{})
+		texts := make([]string, len(chunks))
+		for i, c := range chunks {
+			texts[i] = c.Content
+		}
+		hash.Fit(texts)
+		*model = hash.ModelInfo()
+		window = 1000
+		emb = withProgress{hash}
+	case "bert":
+		bert, err := embedder.NewBERTEmbedder(*model)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error initializing embedder: %v\n", err)
+			os.Exit(1)
+		}
+		window = 256
+		emb = bert
+	case "ollama":
+		ollama := embedder.NewOllamaEmbedder("", *model)
+		// Ollama reports no dimension; the probe also loads the model
+		probeCtx, cancelProbe := context.WithTimeout(ctx, 2*time.Minute)
+		_, err := ollama.Probe(probeCtx)
+		cancelProbe()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error initializing embedder: %v\n", err)
+			os.Exit(1)
+		}
+		window = ollama.MaxBatchSize * 4
+		emb = ollama
+	default:
+		openai, err := embedder.NewOpenAIEmbedder(*model)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error initializing embedder: %v\n", err)
+			os.Exit(1)
+		}
+		openai.RateLimit = embedder.RateLimit{RequestsPerMinute: *requestsPerMinute, TokensPerMinute: *tokensPerMinute}
+		// Each window keeps every concurrent request busy
+		window = openai.MaxBatchSize * openai.Concurrency
+		api, emb = openai, openai
+	}
+
+	// Only remote models are cached; the local ones embed faster than the
+	// cache reads, and their ModelInfo does not pin down the weights or IDF
+	var cache *embedder.CachedEmbedder
+	if *cacheDir != "" && (*backend == "openai" || *backend == "ollama") {
+		cache, err = embedder.NewCachedEmbedder(emb, *cacheDir, embedder.CacheOptions{})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: embedding without a cache: %v\n", err)
+		} else {
+			emb = cache
+			fmt.Printf("  ✓ Cache at %s (%d embeddings)\n", *cacheDir, cache.Stats().Entries)
+		}
+	}
+	fmt.Printf("  ✓ Embedder initialized (model=%s, dim=%d)\n\n", *model, emb.Dimension())
+
+	// Step 2.5: Reuse the embeddings of chunks unchanged since the previous
+	// index, and of chunks embedded before an interrupted run. Hash IDF
+	// weights are refitted on the current chunks, so every embedding changes
+	// with the corpus, and a BERT ModelInfo names only the model directory,
+	// whose weights may have been replaced; both embed locally anyway.
+	reuse := !*rebuild && *backend != "hash" && *backend != "bert"
+	var previous *minirag.VectorIndex
+	if reuse {
+		prev, err := minirag.LoadIndexFromFile(outputPath)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Warning: Error loading previous index: %v\n", err)
+		case prev.ModelInfo != emb.ModelInfo() || prev.Dimension != emb.Dimension():
+			fmt.Printf("Previous index was built with %s, embedding every chunk\n", prev.ModelInfo)
+		default:
+			previous = prev
+		}
+	}
+	plan := minirag.PlanReindex(previous, chunks)
+	if previous != nil {
+		fmt.Printf("Compared with the previous index: %d reused, %d changed, %d added, %d removed\n\n",
+			plan.Reused, plan.Changed, plan.Added, plan.Removed)
 	}
-	fmt.Printf("  ✓ Embedder initialized (model=%s, dim=%d)\n\n", model, emb.Dimension())
 
-	// Step 2.5: Check for existing checkpoint
-	var cp *checkpoint
+	cp := &checkpoint{
+		ByHash:    make(map[string][]float32),
+		ModelInfo: emb.ModelInfo(),
+		Dimension: emb.Dimension(),
+	}
 	existingCP, err := loadCheckpoint()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Warning: Error loading checkpoint: %v\n", err)
 		fmt.Println("Starting from scratch...")
 	} else if existingCP != nil {
-		completed := 0
-		for _, done := range existingCP.Completed {
-			if done {
-				completed++
-			}
-		}
-		fmt.Printf("Found checkpoint: %d/%d embeddings already generated\n", completed, len(chunks))
-
-		// Verify checkpoint matches current docs
-		if len(existingCP.Chunks) != len(chunks) || existingCP.ModelInfo != emb.ModelInfo() {
-			fmt.Println("  ⚠ Checkpoint doesn't match current documents/model, starting fresh")
-			cp = nil
-		} else {
-			cp = existingCP
-			fmt.Println("  ✓ Resuming from checkpoint")
+		if existingCP.ModelInfo != cp.ModelInfo || existingCP.Dimension != cp.Dimension || !reuse {
+			fmt.Println("  ⚠ Checkpoint doesn't match current model, starting fresh")
+		} else if existingCP.ByHash != nil {
+			cp.ByHash = existingCP.ByHash
+			fmt.Printf("Found checkpoint: %d embeddings already generated\n", len(cp.ByHash))
 		}
 	}
 
-	// Initialize new checkpoint if needed
-	if cp == nil {
-		cp = &checkpoint{
-			Chunks:     chunks,
-			Embeddings: make([][]float32, len(chunks)),
-			Completed:  make(map[int]bool),
-			ModelInfo:  emb.ModelInfo(),
-			Dimension:  emb.Dimension(),
+	// Chunks left to embed, by hash; identical chunks are embedded once
+	embeddings := plan.Embeddings
+	hashes := make([]string, len(chunks))
+	var toProcess []string
+	contents := make(map[string]string)
+	for i, c := range chunks {
+		hashes[i] = minirag.ChunkHash(c)
+		if embeddings[i] != nil {
+			continue
+		}
+		if emb, ok := cp.ByHash[hashes[i]]; ok {
+			embeddings[i] = emb
+		} else if _, ok := contents[hashes[i]]; !ok {
+			contents[hashes[i]] = c.Content
+			toProcess = append(toProcess, hashes[i])
 		}
 	}
 
@@ -170,143 +363,141 @@ func main() {
 	// Step 3: Generate embeddings with progress and checkpointing
 	fmt.Println("Step 3: Generating embeddings...")
 
-	// Count how many we need to do
-	remaining := 0
-	for i := range chunks {
-		if !cp.Completed[i] {
-			remaining++
-		}
-	}
-
+	remaining := len(toProcess)
 	if remaining == 0 {
 		fmt.Println("  ✓ All embeddings already generated!")
 	} else {
-		fmt.Printf("  (This will call OpenAI API %d times, ~$%.2f estimated cost)\n", remaining, float64(remaining)*0.00002)
-		fmt.Printf("  Using parallel processing (up to 10 concurrent requests)...\n")
-
-		var mu sync.Mutex
-		completed := len(chunks) - remaining
-		saveCounter := 0
-
-		// Build list of indices to process (to avoid concurrent map read)
-		toProcess := make([]int, 0, remaining)
-		for i := range chunks {
-			if !cp.Completed[i] {
-				toProcess = append(toProcess, i)
+		// Texts are packed into batched requests, checkpointing after each
+		// window
+		if api != nil {
+			requests := (remaining + api.MaxBatchSize - 1) / api.MaxBatchSize
+			fmt.Printf("  (%d texts in at least %d batched API requests, ~$%.2f estimated cost)\n", remaining, requests, float64(remaining)*0.00002)
+			if cache != nil {
+				fmt.Println("  Texts found in the cache are not sent, and cost nothing")
 			}
+			fmt.Printf("  Using parallel processing (up to %d concurrent requests)...\n", api.Concurrency)
+		} else {
+			fmt.Printf("  (%d texts embedded locally with %s)\n", remaining, emb.ModelInfo())
 		}
 
-		// Generate only missing embeddings
-		var wg sync.WaitGroup
-		errChan := make(chan error, len(toProcess))
-		sem := make(chan struct{}, 10) // Limit concurrent requests
-
-		for _, idx := range toProcess {
-			wg.Add(1)
-			sem <- struct{}{}
-			go func(idx int) {
-				defer wg.Done()
-				defer func() { <-sem }()
-
-				emb_vec, err := emb.Embed(chunks[idx].Content)
-				if err != nil {
-					errChan <- fmt.Errorf("chunk %d (%s): %w", idx, chunks[idx].Path, err)
-					return
-				}
-
-				mu.Lock()
-				cp.Embeddings[idx] = emb_vec
-				cp.Completed[idx] = true
-				completed++
-				saveCounter++
-
-				// Show progress
-				if completed%10 == 0 || completed == len(chunks) {
-					fmt.Printf("\r  Progress: %d/%d (%.1f%%)", completed, len(chunks), float64(completed)/float64(len(chunks))*100)
-					if completed == len(chunks) {
-						fmt.Println()
-					}
-				}
+		completed := 0
+		for start := 0; start < len(toProcess); start += window {
+			batch := toProcess[start:min(start+window, len(toProcess))]
+			texts := make([]string, len(batch))
+			for i, h := range batch {
+				texts[i] = contents[h]
+			}
 
-				// Save checkpoint every 50 embeddings
-				if saveCounter >= 50 {
-					saveCounter = 0
-					if err := saveCheckpoint(cp); err != nil {
-						fmt.Fprintf(os.Stderr, "\nWarning: Failed to save checkpoint: %v\n", err)
-					}
+			vectors, err := emb.EmbedBatchWithProgressContext(ctx, texts, func(done, _ int) {
+				n := completed + done
+				fmt.Printf("\r  Progress: %d/%d (%.1f%%)", n, remaining, float64(n)/float64(remaining)*100)
+			})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\n\n⚠ Embedding failed: %v\n", err)
+				fmt.Println("\nProgress saved to checkpoint. Run again to resume.")
+				cpMutex.Lock()
+				if saveErr := saveCheckpoint(cp); saveErr != nil {
+					fmt.Fprintf(os.Stderr, "Error saving checkpoint: %v\n", saveErr)
 				}
-				mu.Unlock()
-
-				errChan <- nil
-			}(idx)
-		}
-
-		wg.Wait()
-		close(errChan)
+				cpMutex.Unlock()
+				os.Exit(1)
+			}
 
-		// Check for errors - collect all errors first
-		var embedErrors []error
-		for err := range errChan {
-			if err != nil {
-				embedErrors = append(embedErrors, err)
+			// Checkpoint after every window
+			cpMutex.Lock()
+			for i, h := range batch {
+				cp.ByHash[h] = vectors[i]
+			}
+			if err := saveCheckpoint(cp); err != nil {
+				fmt.Fprintf(os.Stderr, "\nWarning: Failed to save checkpoint: %v\n", err)
 			}
+			cpMutex.Unlock()
+			completed += len(batch)
 		}
+		fmt.Println()
 
-		if len(embedErrors) > 0 {
-			fmt.Fprintf(os.Stderr, "\n\n⚠ Encountered %d error(s) during embedding:\n", len(embedErrors))
-			for _, err := range embedErrors {
-				fmt.Fprintf(os.Stderr, "  - %v\n", err)
+		for i := range chunks {
+			if embeddings[i] == nil {
+				embeddings[i] = cp.ByHash[hashes[i]]
 			}
-			fmt.Println("\nProgress saved to checkpoint. Run again to resume.")
-			mu.Lock()
-			if saveErr := saveCheckpoint(cp); saveErr != nil {
-				fmt.Fprintf(os.Stderr, "Error saving checkpoint: %v\n", saveErr)
+		}
+		fmt.Printf("  ✓ Generated %d embeddings\n", remaining)
+		if cache != nil {
+			s := cache.Stats()
+			fmt.Printf("  ✓ Cache: %d hits, %d misses, %d evicted\n", s.Hits, s.Misses, s.Evictions)
+			if s.WriteErrors > 0 {
+				fmt.Printf("  ⚠ %d embeddings could not be cached\n", s.WriteErrors)
 			}
-			mu.Unlock()
-			os.Exit(1)
 		}
+		fmt.Println()
+	}
+
+	// Step 4: Build the index from the reused and new embeddings
+	index := minirag.BuildIndex(chunks, embeddings, cp.Dimension)
+	index.ModelInfo = cp.ModelInfo
+
+	if *buildBM25 {
+		fmt.Println("Building BM25 index...")
+		index.BM25 = minirag.BuildBM25(index.Chunks, minirag.BM25Config{})
+		fmt.Printf("  ✓ Indexed %d chunks\n\n", index.BM25.Len())
+	}
+
+	if *buildHNSW {
+		fmt.Println("Building HNSW graph...")
+		index.HNSW = minirag.BuildHNSW(index, minirag.DefaultHNSWConfig())
+		fmt.Printf("  ✓ Graph built over %d chunks\n\n", index.HNSW.Len())
+	}
+
+	pqConfig := minirag.PQConfig{SubVectors: *pqSubVectors, Rescore: *pqRescore}
 
-		// Final checkpoint save
-		if err := saveCheckpoint(cp); err != nil {
-			fmt.Fprintf(os.Stderr, "Error saving final checkpoint: %v\n", err)
+	if *ivfLists != 0 {
+		ivfConfig := minirag.IVFConfig{Lists: max(*ivfLists, 0)}
+		if *pqSubVectors > 0 {
+			fmt.Println("Clustering embeddings and training PQ codebooks for IVF-PQ index...")
+			index.IVF = minirag.BuildIVFPQ(index, ivfConfig, pqConfig)
+			index.IVF.PQ.DropFloat32 = *pqOnly
+		} else {
+			fmt.Println("Clustering embeddings for IVF index...")
+			index.IVF = minirag.BuildIVF(index, ivfConfig)
 		}
+		fmt.Printf("  ✓ %d clusters, probing %d per query\n\n", len(index.IVF.Centroids), index.IVF.NProbe)
+	} else if *pqSubVectors > 0 {
+		fmt.Println("Training product quantization codebooks...")
+		index.PQ = minirag.QuantizePQ(index, pqConfig)
+		index.PQ.DropFloat32 = *pqOnly
+		fmt.Printf("  ✓ Encoded %d embeddings as %d-byte codes\n\n", index.PQ.Len(), index.PQ.SubVectors())
+	}
 
-		fmt.Printf("  ✓ Generated %d embeddings\n\n", len(chunks))
+	if *int8Scale != "" {
+		fmt.Println("Quantizing embeddings to int8...")
+		index.Int8 = minirag.QuantizeInt8(index, scale)
+		index.Int8.Rescore = *int8Rescore
+		index.Int8.DropFloat32 = *int8Only
+		fmt.Printf("  ✓ Quantized %d embeddings (%s scales)\n\n", index.Int8.Len(), *int8Scale)
 	}
 
-	// Step 4: Create embedding data structure from checkpoint
-	embData := minirag.EmbeddingData{
-		Chunks:     cp.Chunks,
-		Embeddings: cp.Embeddings,
-		ModelInfo:  cp.ModelInfo,
-		Dimension:  cp.Dimension,
+	if *buildBinary {
+		fmt.Println("Computing binary codes...")
+		index.Binary = minirag.QuantizeBinary(index)
+		fmt.Printf("  ✓ %d sign-bit vectors\n\n", index.Binary.Len())
 	}
 
+	index.Mode = mode
+
 	// Step 5: Save to final index file
 	fmt.Println("Step 4: Saving final index...")
-	outputPath := "embeddings/index.gob"
 
-	// Ensure directory exists
-	if err := os.MkdirAll("embeddings", 0755); err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating embeddings directory: %v\n", err)
+	if err := minirag.SaveIndex(index, outputPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving index: %v\n", err)
 		os.Exit(1)
 	}
 
-	file, err := os.Create(outputPath)
+	// Get file size
+	info, err := os.Stat(outputPath)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
-		os.Exit(1)
-	}
-	defer file.Close()
-
-	encoder := gob.NewEncoder(file)
-	if err := encoder.Encode(embData); err != nil {
-		fmt.Fprintf(os.Stderr, "Error encoding embeddings: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error reading index file: %v\n", err)
 		os.Exit(1)
 	}
-
-	// Get file size
-	info, _ := file.Stat()
 	sizeMB := float64(info.Size()) / (1024 * 1024)
 
 	fmt.Printf("  ✓ Saved to %s (%.2f MB)\n\n", outputPath, sizeMB)
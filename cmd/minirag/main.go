@@ -1,12 +1,14 @@
 package main
 
 import (
+	"context"
 	_ "embed"
-	"encoding/gob"
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/perbu/minirag/pkg/embedder"
@@ -25,7 +27,21 @@ func main() {
 	threshold := flag.Float64("threshold", 0.0, "minimum similarity score")
 	full := flag.Bool("full", false, "show full content instead of just paths")
 	verbose := flag.Bool("verbose", false, "enable verbose output for debugging")
-	context := flag.Int("context", 0, "number of surrounding chunks to show for context")
+	contextSize := flag.Int("context", 0, "number of surrounding chunks to show for context")
+	mode := flag.String("mode", "", "search mode: auto, exact, hnsw, ivf, int8, binary, pq (default: as stored in the index)")
+	hybrid := flag.Bool("hybrid", false, "fuse BM25 keyword results with vector results")
+	fusion := flag.String("fusion", "rrf", "hybrid fusion method: rrf (reciprocal rank) or weighted (score blending)")
+	vectorWeight := flag.Float64("vector-weight", 1, "weight of the vector ranking in hybrid search")
+	lexicalWeight := flag.Float64("lexical-weight", 1, "weight of the BM25 ranking in hybrid search")
+	diversify := flag.Bool("diversify", false, "diversify results with Maximal Marginal Relevance, skipping near-duplicates")
+	lambda := flag.Float64("lambda", 0.5, "MMR trade-off for -diversify, from 1 (pure relevance) to 0 (pure diversity)")
+	group := flag.String("group", "", "list documents instead of chunks, scored by their best chunk (max), all chunks (sum) or top 3 (mean)")
+	perDoc := flag.Int("per-doc", 3, "chunks listed per document with -group (0 for all)")
+	timeout := flag.Duration("timeout", 30*time.Second, "give up embedding the query after this long and fall back to keyword search")
+	cacheDir := flag.String("cache", defaultCacheDir(), "directory caching query embeddings of OpenAI and Ollama models (empty disables)")
+	offline := flag.Bool("offline", false, "use BM25 keyword search only, without embedding the query (automatic when OPENAI_API_KEY is not set)")
+	var filters filterFlags
+	flag.Var(&filters, "filter", "only return chunks matching `key=value`, key=a|b, key!=value, key^=prefix or key~=glob (repeatable, all must match; keys: path, heading or a metadata field)")
 	flag.Parse()
 
 	// Get query string
@@ -39,91 +55,179 @@ func main() {
 
 	query := strings.Join(args, " ")
 
+	if *lambda < 0 || *lambda > 1 {
+		fmt.Fprintf(os.Stderr, "Error: -lambda must be between 0 and 1, got %g\n", *lambda)
+		os.Exit(1)
+	}
+
 	// Step 1: Load embedded index
 	if *verbose {
 		fmt.Printf("[DEBUG] Loading embedded index (%d bytes)...\n", len(embeddedIndex))
 	}
 
-	var embData minirag.EmbeddingData
-	decoder := gob.NewDecoder(strings.NewReader(string(embeddedIndex)))
-	if err := decoder.Decode(&embData); err != nil {
+	// Vectors are views into the embedded bytes, so nothing is copied
+	index, err := minirag.LoadIndexFromBytes(embeddedIndex)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading index: %v\n", err)
 		os.Exit(1)
 	}
 
 	if *verbose {
 		fmt.Printf("[DEBUG] Loaded %d chunks, %d embeddings (dim=%d, model=%s)\n",
-			len(embData.Chunks), len(embData.Embeddings), embData.Dimension, embData.ModelInfo)
+			len(index.Chunks), len(index.Embeddings), index.Dimension, index.ModelInfo)
 	}
 
-	index := minirag.LoadIndex(&embData)
+	if *mode != "" {
+		index.Mode, err = minirag.ParseSearchMode(*mode)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
-	// Step 2: Initialize embedder for query
-	if os.Getenv("OPENAI_API_KEY") == "" {
-		fmt.Fprintf(os.Stderr, "Error: OPENAI_API_KEY environment variable not set\n")
-		fmt.Fprintf(os.Stderr, "Please set it in .env file or environment\n")
+	var fusionMethod minirag.Fusion
+	switch *fusion {
+	case "rrf":
+		fusionMethod = minirag.FusionRRF
+	case "weighted":
+		fusionMethod = minirag.FusionWeighted
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown fusion method %q (want 'rrf' or 'weighted')\n", *fusion)
 		os.Exit(1)
 	}
 
-	emb, err := embedder.NewOpenAIEmbedder("text-embedding-3-small")
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error initializing embedder: %v\n", err)
-		os.Exit(1)
+	var filter minirag.Filter
+	if len(filters) > 0 {
+		filter = minirag.And(filters...)
+		if *verbose {
+			fmt.Printf("[DEBUG] Filter: %s\n", filter)
+		}
 	}
 
-	// Step 3: Embed query
-	if *verbose {
-		fmt.Printf("[DEBUG] Embedding query: %q\n", query)
+	// Step 2: Embed the query, unless running offline
+	offlineReason := ""
+	switch {
+	case *offline:
+		offlineReason = "-offline"
+	case usesOpenAI(index) && os.Getenv("OPENAI_API_KEY") == "" && os.Getenv("OPENAI_BASE_URL") == "":
+		offlineReason = "OPENAI_API_KEY not set"
 	}
 
-	queryEmbedding, err := emb.Embed(query)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error embedding query: %v\n", err)
-		os.Exit(1)
+	var queryEmbedding []float32
+	if offlineReason == "" {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		queryEmbedding, err = embedQuery(ctx, index, query, *cacheDir, *verbose)
+		cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v; falling back to keyword search\n", err)
+			offlineReason = "query embedding failed"
+		}
 	}
 
-	if *verbose {
-		fmt.Printf("[DEBUG] Query embedding dimension: %d\n", len(queryEmbedding))
+	// Indexes built before BM25 support have no lexical index, so build one
+	// from the embedded chunks when keyword scoring is needed
+	if (offlineReason != "" || *hybrid) && index.BM25 == nil {
+		if *verbose {
+			fmt.Printf("[DEBUG] Index has no BM25 section, indexing %d chunks\n", len(index.Chunks))
+		}
+		index.BM25 = minirag.BuildBM25(index.Chunks, minirag.BM25Config{})
 	}
 
-	// Step 4: Execute search
-	if *verbose {
-		fmt.Printf("[DEBUG] Searching with top=%d, threshold=%.2f\n", *top, *threshold)
+	var aggregation minirag.Aggregation
+	if *group != "" {
+		aggregation, err = minirag.ParseAggregation(*group)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v (want max, sum or mean)\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *diversify && (offlineReason != "" || *hybrid) {
+		fmt.Fprintf(os.Stderr, "Warning: -diversify only applies to semantic search\n")
 	}
 
-	results := minirag.Search(index, queryEmbedding, *top, float32(*threshold))
+	// Step 3: Execute search
+	opts := minirag.SearchOptions{
+		TopK:      *top,
+		Threshold: float32(*threshold),
+		Filter:    filter,
+	}
+	if *group != "" && *top > 0 {
+		// -top counts documents, so fetch enough chunks to fill them
+		opts.TopK = max(50, 10*(*top))
+	}
+	var results []minirag.SearchResult
+	var searchDesc string
+	switch {
+	case offlineReason != "":
+		// BM25 scores are not similarities, so -threshold does not apply
+		opts.Threshold = 0
+		searchDesc = fmt.Sprintf("lexical (BM25 keyword search, offline: %s)", offlineReason)
+		results = minirag.LexicalSearch(index, query, opts)
+	case *hybrid:
+		hybridOpts := minirag.HybridOptions{
+			SearchOptions: opts,
+			Fusion:        fusionMethod,
+			VectorWeight:  float32(*vectorWeight),
+			LexicalWeight: float32(*lexicalWeight),
+		}
+		searchDesc = fmt.Sprintf("hybrid (BM25 + %s vector search, %s fusion)", index.ResolveMode(hybridOpts.VectorOptions()), *fusion)
+		results = minirag.HybridSearch(index, query, queryEmbedding, hybridOpts)
+	case *diversify:
+		mmrLambda := float32(*lambda)
+		mmrOpts := minirag.MMROptions{
+			SearchOptions: opts,
+			Lambda:        &mmrLambda,
+		}
+		searchDesc = fmt.Sprintf("semantic (%s vector search, MMR lambda=%.2f)", index.ResolveMode(mmrOpts.VectorOptions()), *lambda)
+		results = minirag.MMRSearch(index, queryEmbedding, mmrOpts)
+	default:
+		searchDesc = fmt.Sprintf("semantic (%s vector search)", index.ResolveMode(opts))
+		results = minirag.SearchWithOptions(index, queryEmbedding, opts)
+	}
 
 	if *verbose {
-		fmt.Printf("[DEBUG] Found %d results\n\n", len(results))
+		fmt.Printf("[DEBUG] Searched with top=%d, threshold=%.2f, found %d results\n", *top, opts.Threshold, len(results))
 	}
 
-	// Step 5: Display results
+	// Step 4: Display results
+	fmt.Printf("Search mode: %s\n", searchDesc)
 	if len(results) == 0 {
 		fmt.Println("No results found")
 		return
 	}
 
+	if *group != "" {
+		docs := minirag.GroupByDocument(results, minirag.GroupOptions{
+			Aggregation:  aggregation,
+			MaxChunks:    *perDoc,
+			MaxDocuments: *top,
+		})
+		printDocuments(docs, *full)
+		return
+	}
+
 	fmt.Printf("Found %d results:\n\n", len(results))
 	for i, result := range results {
-		fmt.Printf("Score: %.2f | %s", result.Score, result.Chunk.Path)
-		if result.Chunk.Heading != "" {
-			fmt.Printf(" [%s]", result.Chunk.Heading)
+		fmt.Printf("Score: %.2f | %s", result.Score, location(result.Chunk))
+		if heading := result.Chunk.Breadcrumb(); heading != "" {
+			fmt.Printf(" [%s]", heading)
 		}
 		fmt.Println()
 
-		if *full || *context > 0 {
+		if *full || *contextSize > 0 {
 			fmt.Println()
 
 			// Find surrounding chunks from the same file
-			if *context > 0 {
-				surroundingChunks := findSurroundingChunks(&embData, result.Chunk, *context)
+			if *contextSize > 0 {
+				surroundingChunks := findSurroundingChunks(index, result.Chunk, *contextSize)
 
 				for j, chunk := range surroundingChunks {
-					if chunk.Path == result.Chunk.Path && chunk.Offset == result.Chunk.Offset {
+					if sameChunk(chunk, result.Chunk) {
 						fmt.Printf(">>> MATCHED CHUNK <<<\n")
 					}
-					if chunk.Heading != "" {
-						fmt.Printf("[%s]\n", chunk.Heading)
+					if heading := chunk.Breadcrumb(); heading != "" {
+						fmt.Printf("[%s]\n", heading)
 					}
 					fmt.Printf("%s\n", chunk.Content)
 					if j < len(surroundingChunks)-1 {
@@ -141,14 +245,156 @@ func main() {
 	}
 }
 
+// printDocuments lists grouped results with their best matching sections
+func printDocuments(docs []minirag.DocumentResult, full bool) {
+	fmt.Printf("Found %d documents:\n\n", len(docs))
+	for i, doc := range docs {
+		fmt.Printf("Score: %.2f | %s (%d matching chunks)\n", doc.Score, doc.Path, doc.Total)
+		for _, hit := range doc.Hits {
+			heading := hit.Chunk.Breadcrumb()
+			if heading == "" {
+				heading = "(no heading)"
+			}
+			fmt.Printf("    %.2f  %s\n", hit.Score, heading)
+			if full {
+				fmt.Printf("\n%s\n\n", hit.Chunk.Content)
+			}
+		}
+		if full && i < len(docs)-1 {
+			fmt.Println(strings.Repeat("-", 80) + "\n")
+		}
+	}
+}
+
+// usesOpenAI reports whether the index was embedded with the OpenAI API,
+// rather than a local embedder
+func usesOpenAI(index *minirag.VectorIndex) bool {
+	for _, local := range []string{"ollama-", "hash-", "bert-"} {
+		if strings.HasPrefix(index.ModelInfo, local) {
+			return false
+		}
+	}
+	return true
+}
+
+// defaultCacheDir is the embedding cache shared with generate-embeddings,
+// or empty when the user has no cache directory
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "minirag", "embeddings")
+}
+
+// embedQuery embeds the query with the model the index was built with.
+// Remote models are cached in cacheDir, unless it is empty, so repeated
+// queries need no request.
+func embedQuery(ctx context.Context, index *minirag.VectorIndex, query, cacheDir string, verbose bool) ([]float32, error) {
+	var emb embedder.Embedder
+	if cfg, fitted, err := embedder.ParseHashModelInfo(index.ModelInfo); err == nil {
+		hash := embedder.NewHashEmbedder(cfg)
+		if fitted {
+			texts := make([]string, len(index.Chunks))
+			for i, c := range index.Chunks {
+				texts[i] = c.Content
+			}
+			hash.Fit(texts)
+		}
+		emb = hash
+	} else if strings.HasPrefix(index.ModelInfo, "bert-") {
+		// The model directory is not stored in the index
+		dir := os.Getenv("MINIRAG_MODEL_DIR")
+		if dir == "" {
+			return nil, fmt.Errorf("index was built with local model %s: set MINIRAG_MODEL_DIR to its directory", index.ModelInfo)
+		}
+		if emb, err = embedder.NewBERTEmbedder(dir); err != nil {
+			return nil, fmt.Errorf("initializing embedder: %w", err)
+		}
+		if emb.ModelInfo() != index.ModelInfo {
+			return nil, fmt.Errorf("MINIRAG_MODEL_DIR holds %s, but the index was built with %s", emb.ModelInfo(), index.ModelInfo)
+		}
+	} else if model, ok := strings.CutPrefix(index.ModelInfo, "ollama-"); ok {
+		emb = embedder.NewOllamaEmbedder("", model)
+	} else {
+		model := "text-embedding-3-small"
+		if m, ok := strings.CutPrefix(index.ModelInfo, "openai-"); ok {
+			model = m
+		}
+		opts, err := embedder.OpenAIOptionsFromEnv()
+		if err != nil {
+			return nil, fmt.Errorf("initializing embedder: %w", err)
+		}
+		if opts.Dimensions == 0 {
+			opts.Dimensions = index.Dimension
+		}
+		emb, err = embedder.NewOpenAIEmbedderWithOptions(model, opts)
+		if err != nil {
+			return nil, fmt.Errorf("initializing embedder: %w", err)
+		}
+	}
+
+	var cache *embedder.CachedEmbedder
+	if cacheDir != "" && !strings.HasPrefix(index.ModelInfo, "hash-") && !strings.HasPrefix(index.ModelInfo, "bert-") {
+		var err error
+		if cache, err = embedder.NewCachedEmbedder(emb, cacheDir, embedder.CacheOptions{}); err != nil {
+			if verbose {
+				fmt.Printf("[DEBUG] Not caching the query embedding: %v\n", err)
+			}
+		} else {
+			emb = cache
+		}
+	}
+
+	if verbose {
+		fmt.Printf("[DEBUG] Embedding query: %q\n", query)
+	}
+
+	queryEmbedding, err := emb.EmbedContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("embedding query: %w", err)
+	}
+
+	if verbose {
+		fmt.Printf("[DEBUG] Query embedding dimension: %d\n", len(queryEmbedding))
+		if cache != nil {
+			s := cache.Stats()
+			fmt.Printf("[DEBUG] Embedding cache: %d hits, %d misses (%d entries in %s)\n", s.Hits, s.Misses, s.Entries, cacheDir)
+		}
+	}
+	return queryEmbedding, nil
+}
+
+// sameChunk reports whether a and b are the same chunk. Indexes built before
+// chunks had IDs are matched by position.
+func sameChunk(a, b minirag.Chunk) bool {
+	if a.ID != "" || b.ID != "" {
+		return a.ID == b.ID
+	}
+	return a.Path == b.Path && a.Offset == b.Offset
+}
+
+// location returns the path of a chunk with its line range, when the index
+// records it
+func location(c minirag.Chunk) string {
+	switch {
+	case c.StartLine == 0:
+		return c.Path
+	case c.EndLine > c.StartLine:
+		return fmt.Sprintf("%s:%d-%d", c.Path, c.StartLine, c.EndLine)
+	default:
+		return fmt.Sprintf("%s:%d", c.Path, c.StartLine)
+	}
+}
+
 // findSurroundingChunks returns chunks before and after the target chunk from the same file
-func findSurroundingChunks(data *minirag.EmbeddingData, target minirag.Chunk, contextSize int) []minirag.Chunk {
+func findSurroundingChunks(index *minirag.VectorIndex, target minirag.Chunk, contextSize int) []minirag.Chunk {
 	var result []minirag.Chunk
 	targetIdx := -1
 
 	// Find the target chunk index
-	for i, chunk := range data.Chunks {
-		if chunk.Path == target.Path && chunk.Offset == target.Offset {
+	for i, chunk := range index.Chunks {
+		if sameChunk(chunk, target) {
 			targetIdx = i
 			break
 		}
@@ -164,15 +410,35 @@ func findSurroundingChunks(data *minirag.EmbeddingData, target minirag.Chunk, co
 		start = 0
 	}
 	end := targetIdx + contextSize + 1
-	if end > len(data.Chunks) {
-		end = len(data.Chunks)
+	if end > len(index.Chunks) {
+		end = len(index.Chunks)
 	}
 
 	for i := start; i < end; i++ {
-		if data.Chunks[i].Path == target.Path {
-			result = append(result, data.Chunks[i])
+		if index.Chunks[i].Path == target.Path {
+			result = append(result, index.Chunks[i])
 		}
 	}
 
 	return result
 }
+
+// filterFlags collects repeated -filter flags
+type filterFlags []minirag.Filter
+
+func (f *filterFlags) String() string {
+	parts := make([]string, len(*f))
+	for i, filter := range *f {
+		parts[i] = filter.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (f *filterFlags) Set(expr string) error {
+	filter, err := minirag.ParseFilter(expr)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, filter)
+	return nil
+}
@@ -0,0 +1,472 @@
+package embedder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// BERTEmbedder runs a BERT sentence-transformer (MiniLM, BGE, E5 and the
+// like) on the CPU in pure Go. It loads a model directory as saved by
+// sentence-transformers or downloaded from the Hugging Face hub:
+//
+//	config.json                BERT hyperparameters
+//	model.safetensors          weights (F32, F16 or BF16)
+//	vocab.txt                  WordPiece vocabulary
+//	tokenizer_config.json      do_lower_case (optional)
+//	sentence_bert_config.json  max_seq_length (optional)
+//	1_Pooling/config.json      mean or CLS pooling (optional, default mean)
+//
+// Embeddings are pooled over the tokens of the last layer and L2
+// normalized, as sentence-transformers does with a Normalize module.
+type BERTEmbedder struct {
+	// Concurrency is the number of texts EmbedBatch embeds in parallel;
+	// 0 picks GOMAXPROCS
+	Concurrency int
+
+	name      string
+	cfg       bertConfig
+	tokenizer *wordPiece
+	maxLen    int
+	clsPool   bool
+
+	wordEmb, posEmb, typeEmb []float32
+	embNorm                  layerNorm
+	layers                   []bertLayer
+}
+
+type bertConfig struct {
+	ModelType             string  `json:"model_type"`
+	HiddenSize            int     `json:"hidden_size"`
+	NumHiddenLayers       int     `json:"num_hidden_layers"`
+	NumAttentionHeads     int     `json:"num_attention_heads"`
+	IntermediateSize      int     `json:"intermediate_size"`
+	HiddenAct             string  `json:"hidden_act"`
+	MaxPositionEmbeddings int     `json:"max_position_embeddings"`
+	TypeVocabSize         int     `json:"type_vocab_size"`
+	LayerNormEps          float64 `json:"layer_norm_eps"`
+}
+
+type bertLayer struct {
+	query, key, value, attnOut linear
+	attnNorm                   layerNorm
+	inter, out                 linear
+	outNorm                    layerNorm
+}
+
+// linear is a dense layer with a weight matrix of out rows by in columns,
+// as PyTorch stores it
+type linear struct {
+	w, b    []float32
+	in, out int
+}
+
+type layerNorm struct {
+	gamma, beta []float32
+	eps         float64
+}
+
+// NewBERTEmbedder loads the model in dir
+func NewBERTEmbedder(dir string) (*BERTEmbedder, error) {
+	e := &BERTEmbedder{name: filepath.Base(filepath.Clean(dir))}
+
+	if err := readJSON(filepath.Join(dir, "config.json"), &e.cfg, true); err != nil {
+		return nil, err
+	}
+	c := &e.cfg
+	if c.ModelType != "" && c.ModelType != "bert" {
+		return nil, fmt.Errorf("unsupported model type %q, expected bert", c.ModelType)
+	}
+	if c.HiddenSize <= 0 || c.NumAttentionHeads <= 0 || c.HiddenSize%c.NumAttentionHeads != 0 {
+		return nil, fmt.Errorf("invalid hidden size %d for %d attention heads", c.HiddenSize, c.NumAttentionHeads)
+	}
+	if c.MaxPositionEmbeddings < 2 {
+		return nil, fmt.Errorf("invalid max_position_embeddings %d", c.MaxPositionEmbeddings)
+	}
+	if c.LayerNormEps == 0 {
+		c.LayerNormEps = 1e-12
+	}
+	switch c.HiddenAct {
+	case "", "gelu", "gelu_new", "gelu_pytorch_tanh", "relu":
+	default:
+		return nil, fmt.Errorf("unsupported activation %q", c.HiddenAct)
+	}
+
+	tokCfg := struct {
+		DoLowerCase *bool `json:"do_lower_case"`
+	}{}
+	if err := readJSON(filepath.Join(dir, "tokenizer_config.json"), &tokCfg, false); err != nil {
+		return nil, err
+	}
+	lowercase := tokCfg.DoLowerCase == nil || *tokCfg.DoLowerCase
+
+	var err error
+	if e.tokenizer, err = loadWordPiece(filepath.Join(dir, "vocab.txt"), lowercase); err != nil {
+		return nil, fmt.Errorf("loading vocabulary: %w", err)
+	}
+
+	stCfg := struct {
+		MaxSeqLength int `json:"max_seq_length"`
+	}{}
+	if err := readJSON(filepath.Join(dir, "sentence_bert_config.json"), &stCfg, false); err != nil {
+		return nil, err
+	}
+	e.maxLen = c.MaxPositionEmbeddings
+	if stCfg.MaxSeqLength >= 2 {
+		e.maxLen = min(e.maxLen, stCfg.MaxSeqLength)
+	}
+
+	poolCfg := struct {
+		Mean bool `json:"pooling_mode_mean_tokens"`
+		CLS  bool `json:"pooling_mode_cls_token"`
+	}{}
+	if err := readJSON(filepath.Join(dir, "1_Pooling", "config.json"), &poolCfg, false); err != nil {
+		return nil, err
+	}
+	e.clsPool = poolCfg.CLS && !poolCfg.Mean
+
+	tensors, err := loadSafetensors(filepath.Join(dir, "model.safetensors"))
+	if err != nil {
+		return nil, fmt.Errorf("loading weights: %w", err)
+	}
+	if err := e.loadWeights(tensors); err != nil {
+		return nil, fmt.Errorf("loading weights: %w", err)
+	}
+	return e, nil
+}
+
+// readJSON decodes a config file, which need not exist unless required
+func readJSON(path string, v any, required bool) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// loadWeights takes the tensors of a BertModel, named with or without a
+// "bert." prefix, checking their shapes against the config
+func (e *BERTEmbedder) loadWeights(tensors map[string]tensor) error {
+	c := e.cfg
+	var errs []error
+	lookup := func(name string) (tensor, bool) {
+		t, ok := tensors[name]
+		if !ok {
+			t, ok = tensors["bert."+name]
+		}
+		// Checkpoints converted from TensorFlow name LayerNorm parameters
+		// gamma and beta
+		if !ok && strings.Contains(name, "LayerNorm.") {
+			alt := strings.NewReplacer(".weight", ".gamma", ".bias", ".beta").Replace(name)
+			if t, ok = tensors[alt]; !ok {
+				t, ok = tensors["bert."+alt]
+			}
+		}
+		if !ok {
+			errs = append(errs, fmt.Errorf("missing tensor %s", name))
+		}
+		return t, ok
+	}
+	get := func(name string, shape ...int) []float32 {
+		t, ok := lookup(name)
+		if ok && !slices.Equal(t.shape, shape) {
+			errs = append(errs, fmt.Errorf("tensor %s: expected shape %v, got %v", name, shape, t.shape))
+			return nil
+		}
+		return t.data
+	}
+	dense := func(name string, in, out int) linear {
+		return linear{w: get(name+".weight", out, in), b: get(name+".bias", out), in: in, out: out}
+	}
+	norm := func(name string) layerNorm {
+		return layerNorm{gamma: get(name+".weight", c.HiddenSize), beta: get(name+".bias", c.HiddenSize), eps: c.LayerNormEps}
+	}
+
+	h := c.HiddenSize
+	// The embedding matrix may be padded beyond the vocabulary
+	if t, ok := lookup("embeddings.word_embeddings.weight"); ok {
+		if len(t.shape) != 2 || t.shape[0] < e.tokenizer.size || t.shape[1] != h {
+			errs = append(errs, fmt.Errorf("tensor embeddings.word_embeddings.weight: expected shape [>=%d %d], got %v", e.tokenizer.size, h, t.shape))
+		}
+		e.wordEmb = t.data
+	}
+	e.posEmb = get("embeddings.position_embeddings.weight", c.MaxPositionEmbeddings, h)
+	e.typeEmb = get("embeddings.token_type_embeddings.weight", max(1, c.TypeVocabSize), h)
+	e.embNorm = norm("embeddings.LayerNorm")
+
+	e.layers = make([]bertLayer, c.NumHiddenLayers)
+	for i := range e.layers {
+		p := fmt.Sprintf("encoder.layer.%d.", i)
+		e.layers[i] = bertLayer{
+			query:    dense(p+"attention.self.query", h, h),
+			key:      dense(p+"attention.self.key", h, h),
+			value:    dense(p+"attention.self.value", h, h),
+			attnOut:  dense(p+"attention.output.dense", h, h),
+			attnNorm: norm(p + "attention.output.LayerNorm"),
+			inter:    dense(p+"intermediate.dense", h, c.IntermediateSize),
+			out:      dense(p+"output.dense", c.IntermediateSize, h),
+			outNorm:  norm(p + "output.LayerNorm"),
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Embed generates an embedding for a single text. Texts longer than the
+// model's maximum sequence length are truncated.
+func (e *BERTEmbedder) Embed(text string) ([]float32, error) {
+	ids := e.tokenizer.encode(text, e.maxLen)
+	hidden := e.forward(ids)
+
+	h := e.cfg.HiddenSize
+	vec := make([]float32, h)
+	if e.clsPool {
+		copy(vec, hidden[:h])
+	} else {
+		for i := range ids {
+			for j, v := range hidden[i*h : (i+1)*h] {
+				vec[j] += v
+			}
+		}
+		for j := range vec {
+			vec[j] /= float32(len(ids))
+		}
+	}
+
+	l2normalize(vec)
+	return vec, nil
+}
+
+// forward returns the last hidden state, one row of HiddenSize per token
+func (e *BERTEmbedder) forward(ids []int32) []float32 {
+	n, h := len(ids), e.cfg.HiddenSize
+	x := make([]float32, n*h)
+	for i, id := range ids {
+		row := x[i*h : (i+1)*h]
+		word := e.wordEmb[int(id)*h:]
+		pos := e.posEmb[i*h:]
+		for j := range row {
+			// Single-segment input: token type 0 throughout
+			row[j] = word[j] + pos[j] + e.typeEmb[j]
+		}
+	}
+	e.embNorm.apply(x)
+
+	for _, l := range e.layers {
+		ctx := e.attention(l, x, n)
+		attn := l.attnOut.apply(ctx, n)
+		add(attn, x)
+		l.attnNorm.apply(attn)
+
+		inter := l.inter.apply(attn, n)
+		e.activate(inter)
+		x = l.out.apply(inter, n)
+		add(x, attn)
+		l.outNorm.apply(x)
+	}
+	return x
+}
+
+// attention runs multi-head self-attention over all n tokens; a single
+// unpadded sequence needs no attention mask
+func (e *BERTEmbedder) attention(l bertLayer, x []float32, n int) []float32 {
+	h := e.cfg.HiddenSize
+	heads := e.cfg.NumAttentionHeads
+	dh := h / heads
+	scale := float32(1 / math.Sqrt(float64(dh)))
+
+	q, k, v := l.query.apply(x, n), l.key.apply(x, n), l.value.apply(x, n)
+	ctx := make([]float32, n*h)
+	scores := make([]float32, n)
+	for head := range heads {
+		off := head * dh
+		for i := range n {
+			qi := q[i*h+off : i*h+off+dh]
+			for j := range n {
+				scores[j] = dot32(qi, k[j*h+off:j*h+off+dh]) * scale
+			}
+			softmax(scores)
+
+			out := ctx[i*h+off : i*h+off+dh]
+			for j, p := range scores {
+				for d, vd := range v[j*h+off : j*h+off+dh] {
+					out[d] += p * vd
+				}
+			}
+		}
+	}
+	return ctx
+}
+
+func (e *BERTEmbedder) activate(x []float32) {
+	switch e.cfg.HiddenAct {
+	case "relu":
+		for i, v := range x {
+			x[i] = max(v, 0)
+		}
+	case "gelu_new", "gelu_pytorch_tanh":
+		for i, v := range x {
+			f := float64(v)
+			x[i] = float32(0.5 * f * (1 + math.Tanh(math.Sqrt(2/math.Pi)*(f+0.044715*f*f*f))))
+		}
+	default: // Exact GELU
+		for i, v := range x {
+			f := float64(v)
+			x[i] = float32(0.5 * f * (1 + math.Erf(f/math.Sqrt2)))
+		}
+	}
+}
+
+// apply multiplies n rows of x by the transposed weights and adds the bias
+func (l linear) apply(x []float32, n int) []float32 {
+	y := make([]float32, n*l.out)
+	for i := range n {
+		row := x[i*l.in : (i+1)*l.in]
+		out := y[i*l.out : (i+1)*l.out]
+		for j := range out {
+			out[j] = l.b[j] + dot32(row, l.w[j*l.in:(j+1)*l.in])
+		}
+	}
+	return y
+}
+
+// apply normalizes each row of x in place
+func (ln layerNorm) apply(x []float32) {
+	h := len(ln.gamma)
+	for start := 0; start < len(x); start += h {
+		row := x[start : start+h]
+		var mean, variance float64
+		for _, v := range row {
+			mean += float64(v)
+		}
+		mean /= float64(h)
+		for _, v := range row {
+			d := float64(v) - mean
+			variance += d * d
+		}
+		inv := 1 / math.Sqrt(variance/float64(h)+ln.eps)
+		for j, v := range row {
+			row[j] = float32((float64(v)-mean)*inv)*ln.gamma[j] + ln.beta[j]
+		}
+	}
+}
+
+func dot32(a, b []float32) float32 {
+	b = b[:len(a)]
+	var s0, s1, s2, s3 float32
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		s0 += a[i] * b[i]
+		s1 += a[i+1] * b[i+1]
+		s2 += a[i+2] * b[i+2]
+		s3 += a[i+3] * b[i+3]
+	}
+	for ; i < len(a); i++ {
+		s0 += a[i] * b[i]
+	}
+	return s0 + s1 + s2 + s3
+}
+
+func add(dst, src []float32) {
+	for i, v := range src {
+		dst[i] += v
+	}
+}
+
+func softmax(x []float32) {
+	m := slices.Max(x)
+	var sum float32
+	for i, v := range x {
+		x[i] = float32(math.Exp(float64(v - m)))
+		sum += x[i]
+	}
+	for i := range x {
+		x[i] /= sum
+	}
+}
+
+// EmbedContext is Embed with a context
+func (e *BERTEmbedder) EmbedContext(ctx context.Context, text string) ([]float32, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return e.Embed(text)
+}
+
+// EmbedBatch generates embeddings for multiple texts in parallel
+func (e *BERTEmbedder) EmbedBatch(texts []string) ([][]float32, error) {
+	return e.EmbedBatchWithProgressContext(context.Background(), texts, nil)
+}
+
+// EmbedBatchContext is EmbedBatch with a context, checked between texts
+func (e *BERTEmbedder) EmbedBatchContext(ctx context.Context, texts []string) ([][]float32, error) {
+	return e.EmbedBatchWithProgressContext(ctx, texts, nil)
+}
+
+// EmbedBatchWithProgressContext is EmbedBatchContext with a callback,
+// called with (completed, total) after each text
+func (e *BERTEmbedder) EmbedBatchWithProgressContext(ctx context.Context, texts []string, progressFn func(int, int)) ([][]float32, error) {
+	workers := e.Concurrency
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	embeddings := make([][]float32, len(texts))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	completed := 0
+	for range min(workers, len(texts)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				embeddings[i], _ = e.Embed(texts[i])
+				if progressFn != nil {
+					mu.Lock()
+					completed++
+					progressFn(completed, len(texts))
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	var err error
+	for i := range texts {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err != nil {
+		return nil, err
+	}
+	return embeddings, nil
+}
+
+// Dimension returns the embedding dimension
+func (e *BERTEmbedder) Dimension() int {
+	return e.cfg.HiddenSize
+}
+
+// ModelInfo returns "bert-" followed by the model directory's name
+func (e *BERTEmbedder) ModelInfo() string {
+	return "bert-" + e.name
+}
@@ -0,0 +1,157 @@
+package embedder
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// The tiny model and expected outputs come from testdata/tinybert/generate.py:
+// token ids from transformers' BertTokenizer, embeddings from
+// SentenceTransformer.encode with normalize_embeddings
+const tinyBERT = "testdata/tinybert"
+
+type bertFixture struct {
+	Text      string    `json:"text"`
+	IDs       []int32   `json:"ids"`
+	Embedding []float32 `json:"embedding"`
+}
+
+func loadBERTFixtures(t *testing.T) []bertFixture {
+	data, err := os.ReadFile(filepath.Join(tinyBERT, "expected.json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		t.Skip("no reference outputs; run generate.py in testdata/tinybert with sentence-transformers installed")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected struct {
+		Generator string        `json:"generator"`
+		Sentences []bertFixture `json:"sentences"`
+	}
+	if err := json.Unmarshal(data, &expected); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(expected.Generator, "sentence-transformers ") {
+		t.Fatalf("expected.json was not generated by sentence-transformers: %s", expected.Generator)
+	}
+	return expected.Sentences
+}
+
+func TestBERTTokenizerMatchesReference(t *testing.T) {
+	e, err := NewBERTEmbedder(tinyBERT)
+	if err != nil {
+		t.Fatalf("NewBERTEmbedder: %v", err)
+	}
+	for _, f := range loadBERTFixtures(t) {
+		if ids := e.tokenizer.encode(f.Text, e.maxLen); !slices.Equal(ids, f.IDs) {
+			t.Errorf("%q: expected ids %v, got %v", f.Text, f.IDs, ids)
+		}
+	}
+}
+
+func TestBERTEmbedderMatchesReference(t *testing.T) {
+	e, err := NewBERTEmbedder(tinyBERT)
+	if err != nil {
+		t.Fatalf("NewBERTEmbedder: %v", err)
+	}
+	if e.Dimension() != 16 || e.ModelInfo() != "bert-tinybert" {
+		t.Errorf("Unexpected model %s with dimension %d", e.ModelInfo(), e.Dimension())
+	}
+
+	fixtures := loadBERTFixtures(t)
+	texts := make([]string, len(fixtures))
+	for i, f := range fixtures {
+		texts[i] = f.Text
+	}
+	embeddings, err := e.EmbedBatch(texts)
+	if err != nil {
+		t.Fatalf("EmbedBatch: %v", err)
+	}
+	for i, f := range fixtures {
+		if len(embeddings[i]) != len(f.Embedding) {
+			t.Errorf("%q: expected %d dimensions, got %d", f.Text, len(f.Embedding), len(embeddings[i]))
+			continue
+		}
+		for j, want := range f.Embedding {
+			if got := embeddings[i][j]; math.Abs(float64(got-want)) > 1e-4 {
+				t.Errorf("%q: dimension %d: expected %.6f, got %.6f", f.Text, j, want, got)
+				break
+			}
+		}
+	}
+}
+
+func TestBERTEmbedderErrors(t *testing.T) {
+	if _, err := NewBERTEmbedder("testdata/missing"); err == nil {
+		t.Error("Expected an error for a missing model directory")
+	}
+
+	// A model whose config disagrees with its weights
+	dir := t.TempDir()
+	for _, name := range []string{"vocab.txt", "model.safetensors"} {
+		data, err := os.ReadFile(filepath.Join(tinyBERT, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.WriteFile(filepath.Join(dir, name), data, 0o644)
+	}
+	config := `{"hidden_size": 32, "num_hidden_layers": 2, "num_attention_heads": 2, "intermediate_size": 32, "max_position_embeddings": 32}`
+	os.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0o644)
+	if _, err := NewBERTEmbedder(dir); err == nil {
+		t.Error("Expected an error for mismatched tensor shapes")
+	}
+}
+
+func TestWordPiece(t *testing.T) {
+	wp := &wordPiece{vocab: map[string]int32{
+		"[UNK]": 0, "[CLS]": 1, "[SEP]": 2, "un": 3, "##aff": 4, "##able": 5,
+		"naive": 6, ",": 7, "中": 8, "文": 9, "hello": 10,
+	}, lowercase: true, cls: 1, sep: 2}
+
+	tests := []struct {
+		text   string
+		maxLen int
+		want   []int32
+	}{
+		{"unaffable", 16, []int32{1, 3, 4, 5, 2}},
+		{"Naïve,hello", 16, []int32{1, 6, 7, 10, 2}},
+		{"NAI\u0308VE", 16, []int32{1, 6, 2}},                 // Decomposed accent
+		{"中文", 16, []int32{1, 8, 9, 2}},                       // Ideographs are words of their own
+		{"unknown\x00 \u200bhello", 16, []int32{1, 0, 10, 2}}, // Control and format characters are dropped
+		{"hello hello hello hello", 4, []int32{1, 10, 10, 2}},
+	}
+	for _, tt := range tests {
+		if got := wp.encode(tt.text, tt.maxLen); !slices.Equal(got, tt.want) {
+			t.Errorf("%q: expected %v, got %v", tt.text, tt.want, got)
+		}
+	}
+}
+
+func TestFloat16(t *testing.T) {
+	tests := []struct {
+		bits uint16
+		want float32
+	}{
+		{0x3c00, 1},
+		{0xc000, -2},
+		{0x3555, 0.33325195},
+		{0x0001, 5.9604645e-08}, // Smallest subnormal
+		{0x7bff, 65504},
+		{0x0000, 0},
+	}
+	for _, tt := range tests {
+		if got := float16to32(tt.bits); got != tt.want {
+			t.Errorf("%#04x: expected %g, got %g", tt.bits, tt.want, got)
+		}
+	}
+	if !math.IsInf(float64(float16to32(0x7c00)), 1) {
+		t.Error("Expected +Inf for 0x7c00")
+	}
+}
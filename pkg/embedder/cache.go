@@ -0,0 +1,406 @@
+package embedder
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultCacheBytes bounds the cache when CacheOptions.MaxBytes is 0
+const defaultCacheBytes = 1 << 30
+
+// CacheOptions configures a CachedEmbedder
+type CacheOptions struct {
+	MaxBytes   int64 // Size of the stored vectors; 0 picks 1 GiB
+	MaxEntries int   // 0 limits only the size
+}
+
+// CacheStats counts the lookups of a CachedEmbedder since it was created,
+// and the current size of its store
+type CacheStats struct {
+	Hits, Misses, Evictions int64
+	WriteErrors             int64 // Embeddings that could not be stored
+	Entries                 int
+	Bytes                   int64
+}
+
+// CachedEmbedder stores the embeddings of another Embedder in a directory,
+// one file per text, keyed by the SHA-256 of the inner ModelInfo, its
+// dimension and the text. Unchanged texts are not sent to the model again,
+// even across runs. When the store exceeds its limits the least recently
+// used entries are removed; file modification times carry the recency
+// across runs.
+//
+// The inner ModelInfo must identify the model and its configuration, or
+// embeddings of different models would be mixed up; the OpenAI and Ollama
+// embedders add their endpoint to the key. Entries of the wrong size are
+// treated as misses and removed. A CachedEmbedder is safe for concurrent
+// use; processes sharing a directory do not corrupt it, but each enforces
+// the limits only for the entries it knows of.
+type CachedEmbedder struct {
+	inner Embedder
+	dir   string
+	opts  CacheOptions
+
+	mu      sync.Mutex
+	dim     int        // Entry size in floats, while the inner embedder reports none
+	lru     *list.List // Of *cacheEntry, most recently used first
+	entries map[string]*list.Element
+	bytes   int64
+	stats   CacheStats
+}
+
+type cacheEntry struct {
+	key  string
+	size int64
+}
+
+// NewCachedEmbedder wraps inner with a cache stored in dir, which is
+// created if needed. Entries already in dir are reused.
+func NewCachedEmbedder(inner Embedder, dir string, opts CacheOptions) (*CachedEmbedder, error) {
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultCacheBytes
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating cache directory: %w", err)
+	}
+
+	c := &CachedEmbedder{
+		inner:   inner,
+		dir:     dir,
+		opts:    opts,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+	if err := c.scan(); err != nil {
+		return nil, fmt.Errorf("reading cache directory: %w", err)
+	}
+
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+	return c, nil
+}
+
+// scan indexes the entries in the cache directory, oldest first
+func (c *CachedEmbedder) scan() error {
+	type found struct {
+		key     string
+		size    int64
+		modTime time.Time
+	}
+	var files []found
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // Removed meanwhile
+		}
+		switch {
+		case isCacheKey(d.Name()):
+			files = append(files, found{d.Name(), info.Size(), info.ModTime()})
+		case strings.HasPrefix(d.Name(), ".tmp-") && time.Since(info.ModTime()) > time.Hour:
+			// Left behind by a process that died while writing
+			os.Remove(path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	slices.SortFunc(files, func(a, b found) int { return a.modTime.Compare(b.modTime) })
+	for _, f := range files {
+		c.entries[f.key] = c.lru.PushFront(&cacheEntry{f.key, f.size})
+		c.bytes += f.size
+	}
+	return nil
+}
+
+func isCacheKey(name string) bool {
+	if len(name) != 2*sha256.Size {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+// cacheIdentifier is implemented by embedders whose ModelInfo and dimension
+// do not pin down their embeddings, such as those served by an endpoint
+type cacheIdentifier interface {
+	cacheIdentity() string
+}
+
+// key identifies text embedded by the inner model
+func (c *CachedEmbedder) key(text string) string {
+	h := sha256.New()
+	if id, ok := c.inner.(cacheIdentifier); ok {
+		h.Write([]byte(id.cacheIdentity()))
+	} else {
+		fmt.Fprintf(h, "%s\x00%d", c.inner.ModelInfo(), c.inner.Dimension())
+	}
+	h.Write([]byte{0})
+	h.Write([]byte(text))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// validSize reports whether an embedding of n floats fits the inner model.
+// Until the inner embedder knows its dimension, the first size seen is
+// taken as the right one.
+func (c *CachedEmbedder) validSize(n int) bool {
+	if n == 0 {
+		return false
+	}
+	if dim := c.inner.Dimension(); dim > 0 {
+		return n == dim
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.dim == 0 {
+		c.dim = n
+	}
+	return n == c.dim
+}
+
+// path spreads the entries over 256 subdirectories
+func (c *CachedEmbedder) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+// lookup returns the cached embedding for key, if any
+func (c *CachedEmbedder) lookup(key string) ([]float32, bool) {
+	c.mu.Lock()
+	elem, ok := c.entries[key]
+	if ok {
+		c.lru.MoveToFront(elem)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	path := c.path(key)
+	data, err := os.ReadFile(path)
+	if err != nil || len(data)%4 != 0 || !c.validSize(len(data)/4) {
+		// Removed by another process, truncated or not this model's
+		c.remove(key)
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(path, now, now)
+
+	vec := make([]float32, len(data)/4)
+	for i := range vec {
+		vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	return vec, true
+}
+
+// store writes an embedding, replacing the file atomically so concurrent
+// readers never see it half written. A failure to write only costs a
+// later cache miss, so it is counted rather than returned.
+func (c *CachedEmbedder) store(key string, vec []float32) {
+	if !c.validSize(len(vec)) {
+		return
+	}
+	if err := c.write(key, vec); err != nil {
+		c.mu.Lock()
+		c.stats.WriteErrors++
+		c.mu.Unlock()
+		return
+	}
+
+	size := int64(4 * len(vec))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.bytes -= elem.Value.(*cacheEntry).size
+		c.lru.Remove(elem)
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key, size})
+	c.bytes += size
+	c.evict()
+}
+
+func (c *CachedEmbedder) write(key string, vec []float32) error {
+	data := make([]byte, 4*len(vec))
+	for i, v := range vec {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(v))
+	}
+
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (c *CachedEmbedder) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.bytes -= elem.Value.(*cacheEntry).size
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+	}
+	os.Remove(c.path(key))
+}
+
+// evict removes least recently used entries until the cache is within its
+// limits. c.mu must be held.
+func (c *CachedEmbedder) evict() {
+	for c.lru.Len() > 0 && (c.bytes > c.opts.MaxBytes || c.opts.MaxEntries > 0 && c.lru.Len() > c.opts.MaxEntries) {
+		e := c.lru.Remove(c.lru.Back()).(*cacheEntry)
+		delete(c.entries, e.key)
+		c.bytes -= e.size
+		c.stats.Evictions++
+		os.Remove(c.path(e.key))
+	}
+}
+
+func (c *CachedEmbedder) count(hits, misses int) {
+	c.mu.Lock()
+	c.stats.Hits += int64(hits)
+	c.stats.Misses += int64(misses)
+	c.mu.Unlock()
+}
+
+// Stats returns the cache statistics
+func (c *CachedEmbedder) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Entries = c.lru.Len()
+	s.Bytes = c.bytes
+	return s
+}
+
+// Embed generates an embedding for a single text
+func (c *CachedEmbedder) Embed(text string) ([]float32, error) {
+	return c.EmbedContext(context.Background(), text)
+}
+
+// EmbedContext returns the cached embedding of text, or embeds and caches
+// it
+func (c *CachedEmbedder) EmbedContext(ctx context.Context, text string) ([]float32, error) {
+	key := c.key(text)
+	if vec, ok := c.lookup(key); ok {
+		c.count(1, 0)
+		return vec, nil
+	}
+	c.count(0, 1)
+
+	vec, err := c.inner.EmbedContext(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	c.store(key, vec)
+	return vec, nil
+}
+
+// EmbedBatch generates embeddings for multiple texts
+func (c *CachedEmbedder) EmbedBatch(texts []string) ([][]float32, error) {
+	return c.EmbedBatchWithProgressContext(context.Background(), texts, nil)
+}
+
+// EmbedBatchContext is EmbedBatch with a context
+func (c *CachedEmbedder) EmbedBatchContext(ctx context.Context, texts []string) ([][]float32, error) {
+	return c.EmbedBatchWithProgressContext(ctx, texts, nil)
+}
+
+// EmbedBatchWithProgressContext embeds the texts missing from the cache in
+// one batch of the inner embedder, each distinct text once. progressFn is
+// called with (completed, total), counting cached texts as completed, and
+// forwarded to the inner embedder if it reports progress itself.
+func (c *CachedEmbedder) EmbedBatchWithProgressContext(ctx context.Context, texts []string, progressFn func(int, int)) ([][]float32, error) {
+	embeddings := make([][]float32, len(texts))
+	var missing []string
+	var missingKeys []string
+	positions := make(map[string][]int) // Texts waiting for each missing key
+	for i, text := range texts {
+		key := c.key(text)
+		if _, ok := positions[key]; ok {
+			positions[key] = append(positions[key], i)
+			continue
+		}
+		if vec, ok := c.lookup(key); ok {
+			embeddings[i] = vec
+			continue
+		}
+		positions[key] = []int{i}
+		missing = append(missing, text)
+		missingKeys = append(missingKeys, key)
+	}
+	// Repeated texts are served without the model, like hits
+	hits := len(texts) - len(missing)
+	c.count(hits, len(missing))
+
+	forwarded := false
+	if len(missing) > 0 {
+		var vecs [][]float32
+		var err error
+		if p, ok := c.inner.(interface {
+			EmbedBatchWithProgressContext(context.Context, []string, func(int, int)) ([][]float32, error)
+		}); ok && progressFn != nil {
+			forwarded = true
+			vecs, err = p.EmbedBatchWithProgressContext(ctx, missing, func(done, _ int) {
+				progressFn(hits+done, len(texts))
+			})
+		} else {
+			vecs, err = c.inner.EmbedBatchContext(ctx, missing)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for i, key := range missingKeys {
+			for _, pos := range positions[key] {
+				embeddings[pos] = vecs[i]
+			}
+			c.store(key, vecs[i])
+		}
+	}
+
+	if progressFn != nil && !forwarded {
+		progressFn(len(texts), len(texts))
+	}
+	return embeddings, nil
+}
+
+// Dimension returns the embedding dimension of the inner embedder
+func (c *CachedEmbedder) Dimension() int {
+	return c.inner.Dimension()
+}
+
+// ModelInfo returns the inner embedder's model information, as cached
+// embeddings are the model's own
+func (c *CachedEmbedder) ModelInfo() string {
+	return c.inner.ModelInfo()
+}
@@ -0,0 +1,188 @@
+package embedder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// countingEmbedder records the texts sent to the model
+type countingEmbedder struct {
+	*SimpleEmbedder
+	model string
+	mu    sync.Mutex
+	texts []string
+}
+
+func newCountingEmbedder(model string) *countingEmbedder {
+	return &countingEmbedder{SimpleEmbedder: NewSimpleEmbedder(4), model: model}
+}
+
+func (c *countingEmbedder) EmbedContext(ctx context.Context, text string) ([]float32, error) {
+	c.mu.Lock()
+	c.texts = append(c.texts, text)
+	c.mu.Unlock()
+	return c.SimpleEmbedder.EmbedContext(ctx, text)
+}
+
+func (c *countingEmbedder) EmbedBatchContext(ctx context.Context, texts []string) ([][]float32, error) {
+	c.mu.Lock()
+	c.texts = append(c.texts, texts...)
+	c.mu.Unlock()
+	return c.SimpleEmbedder.EmbedBatchContext(ctx, texts)
+}
+
+func (c *countingEmbedder) ModelInfo() string { return c.model }
+
+func TestCachedEmbedder(t *testing.T) {
+	dir := t.TempDir()
+	inner := newCountingEmbedder("m1")
+	c, err := NewCachedEmbedder(inner, dir, CacheOptions{})
+	if err != nil {
+		t.Fatalf("NewCachedEmbedder: %v", err)
+	}
+
+	first, _ := c.Embed("hello")
+	second, _ := c.Embed("hello")
+	if !slices.Equal(first, second) || len(inner.texts) != 1 {
+		t.Fatalf("Expected one model call for a repeated text, got %v", inner.texts)
+	}
+
+	vecs, err := c.EmbedBatch([]string{"a", "hello", "b", "a"})
+	if err != nil {
+		t.Fatalf("EmbedBatch: %v", err)
+	}
+	if want := []string{"hello", "a", "b"}; !slices.Equal(inner.texts, want) {
+		t.Errorf("Expected model calls %v, got %v", want, inner.texts)
+	}
+	if !slices.Equal(vecs[0], vecs[3]) || !slices.Equal(vecs[1], first) {
+		t.Error("Expected batch results in input order")
+	}
+	if s := c.Stats(); s.Hits != 3 || s.Misses != 3 || s.Entries != 3 || s.Bytes != 3*16 {
+		t.Errorf("Unexpected stats %+v", s)
+	}
+
+	// A new process finds the stored embeddings, but not another model's
+	reopened, err := NewCachedEmbedder(inner, dir, CacheOptions{})
+	if err != nil {
+		t.Fatalf("NewCachedEmbedder: %v", err)
+	}
+	if v, _ := reopened.Embed("a"); !slices.Equal(v, vecs[0]) || len(inner.texts) != 3 {
+		t.Errorf("Expected a hit after reopening, model calls %v", inner.texts)
+	}
+	other := newCountingEmbedder("m2")
+	shared, _ := NewCachedEmbedder(other, dir, CacheOptions{})
+	shared.Embed("a")
+	if len(other.texts) != 1 {
+		t.Error("Expected another model to miss")
+	}
+}
+
+func TestCachedEmbedderRejectsBadEntries(t *testing.T) {
+	dir := t.TempDir()
+	inner := newCountingEmbedder("m")
+	c, _ := NewCachedEmbedder(inner, dir, CacheOptions{})
+	want, _ := c.Embed("a")
+
+	// Truncated, or written for a model of another dimension
+	for _, data := range [][]byte{make([]byte, 6), make([]byte, 12), make([]byte, 32)} {
+		path := c.path(c.key("a"))
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		inner.texts = nil
+		reopened, _ := NewCachedEmbedder(inner, dir, CacheOptions{})
+		got, err := reopened.Embed("a")
+		if err != nil || !slices.Equal(got, want) || len(inner.texts) != 1 {
+			t.Errorf("%d bytes: expected a miss returning the model's embedding, got %v: %v", len(data), got, err)
+		}
+		if info, err := os.Stat(path); err != nil || info.Size() != 16 {
+			t.Errorf("%d bytes: expected the entry to be replaced", len(data))
+		}
+	}
+}
+
+func TestCachedEmbedderKey(t *testing.T) {
+	// The same model behind another endpoint or at another size does not
+	// share entries
+	var keys []string
+	for _, opts := range []OpenAIOptions{
+		{BaseURL: "http://a.invalid/v1"},
+		{BaseURL: "http://b.invalid/v1"},
+		{BaseURL: "http://a.invalid/v1", Dimensions: 256},
+		{BaseURL: "http://a.invalid", APIKey: "key", APIVersion: "2024-02-01", Deployment: "small"},
+		{BaseURL: "http://a.invalid", APIKey: "key", APIVersion: "2024-02-01", Deployment: "large"},
+	} {
+		e, err := NewOpenAIEmbedderWithOptions("text-embedding-3-small", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, _ := NewCachedEmbedder(e, t.TempDir(), CacheOptions{})
+		keys = append(keys, c.key("text"))
+	}
+	slices.Sort(keys)
+	if len(slices.Compact(keys)) != 5 {
+		t.Errorf("Expected 5 distinct keys, got %v", keys)
+	}
+}
+
+func TestCachedEmbedderEviction(t *testing.T) {
+	dir := t.TempDir()
+	inner := newCountingEmbedder("m")
+	c, _ := NewCachedEmbedder(inner, dir, CacheOptions{MaxEntries: 2})
+
+	c.Embed("a")
+	c.Embed("b")
+	c.Embed("a") // b is now the least recently used
+	c.Embed("c")
+
+	if s := c.Stats(); s.Evictions != 1 || s.Entries != 2 {
+		t.Errorf("Expected one eviction and 2 entries, got %+v", s)
+	}
+	inner.texts = nil
+	c.Embed("a")
+	c.Embed("b")
+	if !slices.Equal(inner.texts, []string{"b"}) {
+		t.Errorf("Expected only b to be evicted, model calls %v", inner.texts)
+	}
+
+	// A smaller size limit evicts on open
+	small, _ := NewCachedEmbedder(inner, dir, CacheOptions{MaxBytes: 20})
+	if s := small.Stats(); s.Entries != 1 || s.Bytes != 16 {
+		t.Errorf("Expected 1 entry of 16 bytes within 20, got %+v", s)
+	}
+}
+
+func TestCachedEmbedderConcurrent(t *testing.T) {
+	inner := newCountingEmbedder("m")
+	c, _ := NewCachedEmbedder(inner, t.TempDir(), CacheOptions{MaxEntries: 20})
+
+	var wg sync.WaitGroup
+	var failed atomic.Int32
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 50 {
+				text := fmt.Sprint((g + i) % 30)
+				v, err := c.Embed(text)
+				want, _ := inner.SimpleEmbedder.Embed(text)
+				if err != nil || !slices.Equal(v, want) {
+					failed.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if failed.Load() > 0 {
+		t.Errorf("%d lookups returned a wrong embedding", failed.Load())
+	}
+	if s := c.Stats(); s.Hits+s.Misses != 400 || s.Entries > 20 {
+		t.Errorf("Unexpected stats %+v", s)
+	}
+}
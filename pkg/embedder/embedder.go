@@ -1,33 +1,79 @@
 package embedder
 
 import (
+	"context"
 	"fmt"
 )
 
 // Embedder interface for generating embeddings
+// The Context variants give up and return the context's error once it is
+// done; Embed and EmbedBatch behave like them with context.Background()
 type Embedder interface {
+	BasicEmbedder
+	EmbedContext(ctx context.Context, text string) ([]float32, error)
+	EmbedBatchContext(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// BasicEmbedder is the context-free part of Embedder, as implemented by
+// embedders written before the Context variants existed
+type BasicEmbedder interface {
 	Embed(text string) ([]float32, error)
 	EmbedBatch(texts []string) ([][]float32, error)
 	Dimension() int
 	ModelInfo() string
 }
 
-// SimpleEmbedder is a placeholder implementation using basic hashing
-// TODO: Replace with spago-based transformer embeddings
+// WithContext adapts a BasicEmbedder to Embedder. An e that already
+// implements Embedder is returned as is. The adapter checks the context
+// before each call but cannot interrupt a call in progress.
+func WithContext(e BasicEmbedder) Embedder {
+	if full, ok := e.(Embedder); ok {
+		return full
+	}
+	return contextAdapter{e}
+}
+
+type contextAdapter struct {
+	BasicEmbedder
+}
+
+func (a contextAdapter) EmbedContext(ctx context.Context, text string) ([]float32, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.Embed(text)
+}
+
+func (a contextAdapter) EmbedBatchContext(ctx context.Context, texts []string) ([][]float32, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.EmbedBatch(texts)
+}
+
+// SimpleEmbedder is a placeholder implementation using basic hashing. Its
+// vectors carry no semantic signal; use HashEmbedder or BERTEmbedder for
+// offline search.
 type SimpleEmbedder struct {
 	dim int
 }
 
-// NewSimpleEmbedder creates a basic embedder (temporary until spago is integrated)
+// NewSimpleEmbedder creates a basic embedder
 func NewSimpleEmbedder(dimension int) *SimpleEmbedder {
 	return &SimpleEmbedder{dim: dimension}
 }
 
 // Embed generates a simple embedding vector from text
-// This is a placeholder - will be replaced with actual transformer embeddings
 func (e *SimpleEmbedder) Embed(text string) ([]float32, error) {
-	// Simple word-based embedding for now
-	// TODO: Use spago BERT/sentence transformers
+	return e.EmbedContext(context.Background(), text)
+}
+
+// EmbedContext is Embed with a context
+func (e *SimpleEmbedder) EmbedContext(ctx context.Context, text string) ([]float32, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	vec := make([]float32, e.dim)
 
 	// Basic hash-based encoding (just for testing structure)
@@ -36,26 +82,20 @@ func (e *SimpleEmbedder) Embed(text string) ([]float32, error) {
 		vec[idx] += float32(char) / 1000.0
 	}
 
-	// Normalize
-	var norm float32
-	for _, v := range vec {
-		norm += v * v
-	}
-	if norm > 0 {
-		norm = float32(1.0 / float32(norm))
-		for i := range vec {
-			vec[i] *= norm
-		}
-	}
-
+	l2normalize(vec)
 	return vec, nil
 }
 
 // EmbedBatch generates embeddings for multiple texts
 func (e *SimpleEmbedder) EmbedBatch(texts []string) ([][]float32, error) {
+	return e.EmbedBatchContext(context.Background(), texts)
+}
+
+// EmbedBatchContext is EmbedBatch with a context, checked between texts
+func (e *SimpleEmbedder) EmbedBatchContext(ctx context.Context, texts []string) ([][]float32, error) {
 	embeddings := make([][]float32, len(texts))
 	for i, text := range texts {
-		emb, err := e.Embed(text)
+		emb, err := e.EmbedContext(ctx, text)
 		if err != nil {
 			return nil, fmt.Errorf("embedding text %d: %w", i, err)
 		}
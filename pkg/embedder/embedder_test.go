@@ -0,0 +1,63 @@
+package embedder
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSimpleEmbedderContext(t *testing.T) {
+	e := NewSimpleEmbedder(16)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := e.EmbedContext(ctx, "hello"); err != nil {
+		t.Fatalf("EmbedContext: %v", err)
+	}
+	cancel()
+
+	if _, err := e.EmbedContext(ctx, "hello"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if _, err := e.EmbedBatchContext(ctx, []string{"a", "b"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from batch, got %v", err)
+	}
+}
+
+// basicEmbedder implements only the context-free methods
+type basicEmbedder struct{ calls int }
+
+func (b *basicEmbedder) Embed(text string) ([]float32, error) {
+	b.calls++
+	return []float32{1}, nil
+}
+
+func (b *basicEmbedder) EmbedBatch(texts []string) ([][]float32, error) {
+	b.calls++
+	return make([][]float32, len(texts)), nil
+}
+
+func (b *basicEmbedder) Dimension() int    { return 1 }
+func (b *basicEmbedder) ModelInfo() string { return "basic" }
+
+func TestWithContext(t *testing.T) {
+	basic := &basicEmbedder{}
+	e := WithContext(basic)
+
+	if _, err := e.EmbedContext(context.Background(), "x"); err != nil || basic.calls != 1 {
+		t.Fatalf("Expected the call to reach the wrapped embedder, err=%v calls=%d", err, basic.calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := e.EmbedBatchContext(ctx, []string{"x"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if basic.calls != 1 {
+		t.Errorf("Expected no call after cancellation, got %d calls", basic.calls)
+	}
+
+	simple := NewSimpleEmbedder(4)
+	if WithContext(simple) != Embedder(simple) {
+		t.Error("Expected an Embedder to be returned unwrapped")
+	}
+}
@@ -0,0 +1,207 @@
+package embedder
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// HashConfig configures a HashEmbedder. Zero fields pick the defaults.
+type HashConfig struct {
+	Dimension    int     // Hash buckets; 0 picks 512
+	WordNGrams   int     // Longest word n-gram; 0 picks 2
+	MinCharNGram int     // Shortest character n-gram; 0 picks 3
+	MaxCharNGram int     // Longest character n-gram; 0 picks 5
+	CharWeight   float32 // Weight of character n-grams relative to words; 0 picks 0.5
+}
+
+func (c HashConfig) withDefaults() HashConfig {
+	if c.Dimension <= 0 {
+		c.Dimension = 512
+	}
+	if c.WordNGrams <= 0 {
+		c.WordNGrams = 2
+	}
+	if c.MinCharNGram <= 0 {
+		c.MinCharNGram = 3
+	}
+	if c.MaxCharNGram <= 0 {
+		c.MaxCharNGram = max(5, c.MinCharNGram)
+	}
+	if c.CharWeight <= 0 {
+		c.CharWeight = 0.5
+	}
+	return c
+}
+
+// HashEmbedder embeds text without a model or network by hashing word and
+// character n-grams into Dimension buckets. Texts sharing words, phrases
+// or word stems land close together; it knows nothing of synonyms.
+//
+// Each feature is weighted by 1+ln(tf) and, after Fit, by its inverse
+// document frequency in the corpus, then added with a hash-derived sign to
+// its bucket, and the vector is L2 normalized.
+type HashEmbedder struct {
+	cfg HashConfig
+	idf map[uint64]float32 // nil until Fit
+	// IDF of features not seen by Fit, which are rarer than any seen one
+	unseenIDF float32
+}
+
+// NewHashEmbedder creates a hashed n-gram embedder
+func NewHashEmbedder(cfg HashConfig) *HashEmbedder {
+	return &HashEmbedder{cfg: cfg.withDefaults()}
+}
+
+// Fit computes inverse document frequencies over a corpus, so features
+// common to many texts, like stop words, weigh less. Embeddings made before
+// and after Fit are not comparable. Fit must not run concurrently with
+// Embed.
+func (e *HashEmbedder) Fit(texts []string) {
+	df := make(map[uint64]int)
+	for _, text := range texts {
+		for h := range e.features(text) {
+			df[h]++
+		}
+	}
+
+	// Smoothed as if one extra document contained every feature
+	n := float64(len(texts))
+	e.idf = make(map[uint64]float32, len(df))
+	for h, count := range df {
+		e.idf[h] = float32(math.Log((1+n)/(1+float64(count))) + 1)
+	}
+	e.unseenIDF = float32(math.Log(1+n) + 1)
+}
+
+// feature is a hashed feature's count in a text and the weight of its kind
+type feature struct {
+	tf, weight float32
+}
+
+// features counts the hashed features of text
+func (e *HashEmbedder) features(text string) map[uint64]feature {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	features := make(map[uint64]feature)
+	add := func(kind byte, s string, weight float32) {
+		h := hashFeature(kind, s)
+		f := features[h]
+		features[h] = feature{f.tf + 1, weight}
+	}
+	for i := range words {
+		// Word n-grams ending at word i
+		gram := words[i]
+		add('w', gram, 1)
+		for n := 2; n <= e.cfg.WordNGrams && n <= i+1; n++ {
+			gram = words[i-n+1] + " " + gram
+			add('w', gram, 1)
+		}
+
+		// Character n-grams of the word with boundary markers, so "index"
+		// and "indexes" share most of their features
+		runes := []rune("<" + words[i] + ">")
+		for n := e.cfg.MinCharNGram; n <= e.cfg.MaxCharNGram; n++ {
+			for start := 0; start+n <= len(runes); start++ {
+				add('c', string(runes[start:start+n]), e.cfg.CharWeight)
+			}
+		}
+	}
+	return features
+}
+
+// hashFeature hashes a feature, namespaced by kind so a word and a
+// character n-gram with the same text stay distinct
+func hashFeature(kind byte, s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte{kind})
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// Embed generates an embedding for a single text. An empty text embeds as
+// the zero vector.
+func (e *HashEmbedder) Embed(text string) ([]float32, error) {
+	vec := make([]float32, e.cfg.Dimension)
+	for h, f := range e.features(text) {
+		// Sublinear TF damps repeated terms
+		weight := f.weight * float32(1+math.Log(float64(f.tf)))
+		if e.idf != nil {
+			idf, ok := e.idf[h]
+			if !ok {
+				idf = e.unseenIDF
+			}
+			weight *= idf
+		}
+
+		// The top bit picks the sign, so colliding features tend to cancel
+		// rather than add up
+		if h>>63 == 1 {
+			weight = -weight
+		}
+		vec[h%uint64(len(vec))] += weight
+	}
+
+	l2normalize(vec)
+	return vec, nil
+}
+
+// EmbedContext is Embed with a context
+func (e *HashEmbedder) EmbedContext(ctx context.Context, text string) ([]float32, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return e.Embed(text)
+}
+
+// EmbedBatch generates embeddings for multiple texts
+func (e *HashEmbedder) EmbedBatch(texts []string) ([][]float32, error) {
+	return e.EmbedBatchContext(context.Background(), texts)
+}
+
+// EmbedBatchContext is EmbedBatch with a context, checked between texts
+func (e *HashEmbedder) EmbedBatchContext(ctx context.Context, texts []string) ([][]float32, error) {
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		emb, err := e.EmbedContext(ctx, text)
+		if err != nil {
+			return nil, fmt.Errorf("embedding text %d: %w", i, err)
+		}
+		embeddings[i] = emb
+	}
+	return embeddings, nil
+}
+
+// Dimension returns the embedding dimension
+func (e *HashEmbedder) Dimension() int {
+	return e.cfg.Dimension
+}
+
+// ModelInfo describes the configuration, with an "-idf" suffix once
+// fitted, in the form accepted by ParseHashModelInfo
+func (e *HashEmbedder) ModelInfo() string {
+	c := e.cfg
+	info := fmt.Sprintf("hash-d%d-w%d-c%d:%d-cw%g", c.Dimension, c.WordNGrams, c.MinCharNGram, c.MaxCharNGram, c.CharWeight)
+	if e.idf != nil {
+		info += "-idf"
+	}
+	return info
+}
+
+// ParseHashModelInfo recovers the configuration from a HashEmbedder's
+// ModelInfo, and whether it was fitted. Refitting on the same corpus
+// reproduces the embedder, so queries can be embedded against an index
+// built with it.
+func ParseHashModelInfo(info string) (cfg HashConfig, fitted bool, err error) {
+	rest, fitted := strings.CutSuffix(info, "-idf")
+	_, err = fmt.Sscanf(rest, "hash-d%d-w%d-c%d:%d-cw%g", &cfg.Dimension, &cfg.WordNGrams, &cfg.MinCharNGram, &cfg.MaxCharNGram, &cfg.CharWeight)
+	if err != nil {
+		return HashConfig{}, false, fmt.Errorf("not a hash embedder model %q: %w", info, err)
+	}
+	return cfg, fitted, nil
+}
@@ -0,0 +1,103 @@
+package embedder
+
+import (
+	"math"
+	"testing"
+)
+
+func dot(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+func TestHashEmbedderSimilarity(t *testing.T) {
+	e := NewHashEmbedder(HashConfig{})
+
+	texts := []string{
+		"Configure the connection pool size for the database",
+		"Set the database connection pool limits",
+		"Bake the bread at 220 degrees for forty minutes",
+	}
+	v, err := e.EmbedBatch(texts)
+	if err != nil {
+		t.Fatalf("EmbedBatch: %v", err)
+	}
+
+	for i, x := range v {
+		if norm := math.Sqrt(float64(dot(x, x))); math.Abs(norm-1) > 1e-5 {
+			t.Errorf("Text %d: expected unit norm, got %.6f", i, norm)
+		}
+	}
+	if related, unrelated := dot(v[0], v[1]), dot(v[0], v[2]); related <= unrelated+0.2 {
+		t.Errorf("Expected related texts closer: related %.3f, unrelated %.3f", related, unrelated)
+	}
+
+	// Character n-grams match inflected forms
+	a, _ := e.Embed("indexing documents")
+	b, _ := e.Embed("indexes document")
+	c, _ := e.Embed("rendering pictures")
+	if dot(a, b) <= dot(a, c) {
+		t.Errorf("Expected inflections closer: %.3f vs %.3f", dot(a, b), dot(a, c))
+	}
+
+	again, _ := e.Embed(texts[0])
+	if dot(again, v[0]) < 0.9999 {
+		t.Error("Expected embeddings to be deterministic")
+	}
+
+	empty, _ := e.Embed("")
+	if len(empty) != 512 || dot(empty, empty) != 0 {
+		t.Error("Expected the zero vector for an empty text")
+	}
+}
+
+func TestHashEmbedderFit(t *testing.T) {
+	corpus := []string{
+		"the server starts the worker",
+		"the client calls the server",
+		"the worker retries the request",
+		"the cache stores the response",
+	}
+	e := NewHashEmbedder(HashConfig{Dimension: 1024})
+	plain, _ := e.Embed("the cache")
+	e.Fit(corpus)
+	fitted, _ := e.Embed("the cache")
+
+	// "the" is in every text, so IDF leaves "cache" to tell the documents
+	// apart
+	docs, _ := e.EmbedBatch(corpus)
+	plainDocs, _ := NewHashEmbedder(HashConfig{Dimension: 1024}).EmbedBatch(corpus)
+	fittedMargin := dot(fitted, docs[3]) - dot(fitted, docs[0])
+	plainMargin := dot(plain, plainDocs[3]) - dot(plain, plainDocs[0])
+	if fittedMargin <= plainMargin || fittedMargin <= 0 {
+		t.Errorf("Expected IDF to widen the cache document's lead: %.3f vs %.3f", fittedMargin, plainMargin)
+	}
+}
+
+func TestParseHashModelInfo(t *testing.T) {
+	cfg := HashConfig{Dimension: 256, WordNGrams: 3, MinCharNGram: 2, MaxCharNGram: 4, CharWeight: 0.25}
+	e := NewHashEmbedder(cfg)
+	e.Fit([]string{"a b"})
+
+	got, fitted, err := ParseHashModelInfo(e.ModelInfo())
+	if err != nil {
+		t.Fatalf("ParseHashModelInfo(%q): %v", e.ModelInfo(), err)
+	}
+	if got != cfg || !fitted {
+		t.Errorf("Expected %+v fitted, got %+v fitted=%v", cfg, got, fitted)
+	}
+
+	if _, _, err := ParseHashModelInfo("openai-text-embedding-3-small"); err == nil {
+		t.Error("Expected an error for another model")
+	}
+}
+
+func TestSimpleEmbedderNormalized(t *testing.T) {
+	v, _ := NewSimpleEmbedder(8).Embed("hello world")
+	if norm := math.Sqrt(float64(dot(v, v))); math.Abs(norm-1) > 1e-5 {
+		t.Errorf("Expected unit norm, got %.6f", norm)
+	}
+}
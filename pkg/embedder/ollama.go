@@ -0,0 +1,224 @@
+package embedder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultOllamaHost      = "http://localhost:11434"
+	defaultOllamaBatchSize = 32
+)
+
+// OllamaEmbedder uses a local Ollama server for embeddings
+type OllamaEmbedder struct {
+	// Batch calls send up to MaxBatchSize texts per request. Ollama
+	// evaluates a request's inputs one after another, so larger batches
+	// only save round trips.
+	MaxBatchSize int
+
+	// HTTPClient sends the requests; nil uses http.DefaultClient
+	HTTPClient *http.Client
+
+	host  string
+	model string
+
+	mu  sync.Mutex
+	dim int // 0 until the first response
+}
+
+// NewOllamaEmbedder creates an embedder for a model served by Ollama. An
+// empty host reads OLLAMA_HOST, falling back to localhost:11434.
+func NewOllamaEmbedder(host, model string) *OllamaEmbedder {
+	if host == "" {
+		host = os.Getenv("OLLAMA_HOST")
+	}
+	if host == "" {
+		host = defaultOllamaHost
+	}
+	// OLLAMA_HOST is commonly given as host:port
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+
+	return &OllamaEmbedder{
+		MaxBatchSize: defaultOllamaBatchSize,
+		host:         strings.TrimRight(host, "/"),
+		model:        model,
+	}
+}
+
+// Embed generates an embedding for a single text
+func (e *OllamaEmbedder) Embed(text string) ([]float32, error) {
+	return e.EmbedContext(context.Background(), text)
+}
+
+// EmbedContext generates an embedding for a single text, aborting the
+// request when ctx is done
+func (e *OllamaEmbedder) EmbedContext(ctx context.Context, text string) ([]float32, error) {
+	if len(text) == 0 {
+		return nil, errors.New("cannot embed empty text")
+	}
+
+	embeddings, err := e.embedRequest(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+// EmbedBatch generates embeddings for multiple texts
+func (e *OllamaEmbedder) EmbedBatch(texts []string) ([][]float32, error) {
+	return e.EmbedBatchWithProgressContext(context.Background(), texts, nil)
+}
+
+// EmbedBatchContext is EmbedBatch with a context
+func (e *OllamaEmbedder) EmbedBatchContext(ctx context.Context, texts []string) ([][]float32, error) {
+	return e.EmbedBatchWithProgressContext(ctx, texts, nil)
+}
+
+// EmbedBatchWithProgressContext sends texts in requests of up to
+// MaxBatchSize, one at a time, calling progressFn with (completed, total)
+// after each request
+func (e *OllamaEmbedder) EmbedBatchWithProgressContext(ctx context.Context, texts []string, progressFn func(int, int)) ([][]float32, error) {
+	for i, text := range texts {
+		if len(text) == 0 {
+			return nil, fmt.Errorf("embedding text %d: cannot embed empty text", i)
+		}
+	}
+
+	size := e.MaxBatchSize
+	if size <= 0 {
+		size = defaultOllamaBatchSize
+	}
+
+	embeddings := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += size {
+		end := min(start+size, len(texts))
+		embs, err := e.embedRequest(ctx, texts[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("embedding texts %d-%d: %w", start, end-1, err)
+		}
+		embeddings = append(embeddings, embs...)
+		if progressFn != nil {
+			progressFn(end, len(texts))
+		}
+	}
+	return embeddings, nil
+}
+
+// embedRequest embeds texts with a single call to /api/embed
+func (e *OllamaEmbedder) embedRequest(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(struct {
+		Model string   `json:"model"`
+		Input []string `json:"input"`
+	}{e.model, texts})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.host+"/api/embed", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := e.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Ollama request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Embeddings [][]float32 `json:"embeddings"`
+		Error      string      `json:"error"`
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading Ollama response: %w", err)
+	}
+	if err := json.Unmarshal(data, &out); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("decoding Ollama response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg := out.Error
+		if msg == "" {
+			msg = strings.TrimSpace(string(data))
+		}
+		return nil, fmt.Errorf("Ollama API error (HTTP %d): %s", resp.StatusCode, msg)
+	}
+
+	if len(out.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("API returned %d embeddings for %d texts", len(out.Embeddings), len(texts))
+	}
+	for _, v := range out.Embeddings {
+		if err := e.checkDimension(len(v)); err != nil {
+			return nil, err
+		}
+		l2normalize(v)
+	}
+	return out.Embeddings, nil
+}
+
+// checkDimension records the dimension of the first embedding and rejects
+// embeddings of any other size
+func (e *OllamaEmbedder) checkDimension(n int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if n == 0 {
+		return errors.New("API returned an empty embedding")
+	}
+	if e.dim == 0 {
+		e.dim = n
+	}
+	if n != e.dim {
+		return fmt.Errorf("API returned a %d-dimensional embedding, expected %d", n, e.dim)
+	}
+	return nil
+}
+
+// Dimension returns the embedding dimension, which Ollama does not
+// advertise: 0 until a request has returned an embedding. Call Probe to
+// find it out up front.
+func (e *OllamaEmbedder) Dimension() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.dim
+}
+
+// Probe embeds a short text, unless an earlier request already did, and
+// returns the embedding dimension. It also makes Ollama load the model.
+func (e *OllamaEmbedder) Probe(ctx context.Context) (int, error) {
+	if dim := e.Dimension(); dim > 0 {
+		return dim, nil
+	}
+	v, err := e.EmbedContext(ctx, "dimension probe")
+	if err != nil {
+		return 0, err
+	}
+	return len(v), nil
+}
+
+// ModelInfo returns model information
+func (e *OllamaEmbedder) ModelInfo() string {
+	return "ollama-" + e.model
+}
+
+// cacheIdentity adds the server to ModelInfo, leaving out the dimension,
+// which is unknown until the first response
+func (e *OllamaEmbedder) cacheIdentity() string {
+	return e.ModelInfo() + "\x00" + e.host
+}
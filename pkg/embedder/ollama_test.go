@@ -0,0 +1,177 @@
+package embedder
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeOllama serves /api/embed for a single model, embedding the text "n"
+// as the unit vector along axis n%dim
+type fakeOllama struct {
+	model    string
+	dim      int
+	requests atomic.Int32
+	block    chan struct{} // If set, requests signal started and wait for it to be closed
+	started  chan struct{}
+}
+
+func (f *fakeOllama) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.requests.Add(1)
+	if r.Method != http.MethodPost || r.URL.Path != "/api/embed" {
+		http.NotFound(w, r)
+		return
+	}
+
+	var req struct {
+		Model string   `json:"model"`
+		Input []string `json:"input"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	if f.block != nil {
+		f.started <- struct{}{}
+		select {
+		case <-f.block:
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if req.Model != f.model {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "model \"" + req.Model + "\" not found, try pulling it first"})
+		return
+	}
+
+	embeddings := make([][]float32, len(req.Input))
+	for i, text := range req.Input {
+		id, _ := strconv.Atoi(text)
+		embeddings[i] = make([]float32, f.dim)
+		embeddings[i][id%f.dim] = 3
+	}
+	json.NewEncoder(w).Encode(map[string]any{"model": req.Model, "embeddings": embeddings})
+}
+
+func newTestOllama(t *testing.T, fake *fakeOllama, model string) *OllamaEmbedder {
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	return NewOllamaEmbedder(srv.URL, model)
+}
+
+func TestOllamaEmbedBatch(t *testing.T) {
+	fake := &fakeOllama{model: "nomic-embed-text", dim: 16}
+	e := newTestOllama(t, fake, "nomic-embed-text")
+	e.MaxBatchSize = 4
+
+	var progress []int
+	embeddings, err := e.EmbedBatchWithProgressContext(context.Background(), numberedTexts(10), func(completed, total int) {
+		progress = append(progress, completed)
+	})
+	if err != nil {
+		t.Fatalf("EmbedBatch: %v", err)
+	}
+
+	if got := fake.requests.Load(); got != 3 {
+		t.Errorf("Expected 3 requests, got %d", got)
+	}
+	if len(progress) != 3 || progress[2] != 10 {
+		t.Errorf("Expected progress after each request, got %v", progress)
+	}
+	for i, v := range embeddings {
+		if v[i%16] != 1 {
+			t.Fatalf("Embedding %d not normalized or out of order: %v", i, v)
+		}
+	}
+}
+
+func TestOllamaDimension(t *testing.T) {
+	fake := &fakeOllama{model: "all-minilm", dim: 384}
+	e := newTestOllama(t, fake, "all-minilm")
+
+	if got := e.Dimension(); got != 0 || fake.requests.Load() != 0 {
+		t.Fatalf("Expected dimension 0 without a request, got %d after %d requests", got, fake.requests.Load())
+	}
+	if got, err := e.Probe(context.Background()); err != nil || got != 384 {
+		t.Fatalf("Expected dimension 384, got %d: %v", got, err)
+	}
+	if _, err := e.Embed("1"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	e.Probe(context.Background())
+	if got := fake.requests.Load(); got != 2 {
+		t.Errorf("Expected a single probe request, got %d requests", got-1)
+	}
+	if got := e.Dimension(); got != 384 {
+		t.Errorf("Expected dimension 384 after a request, got %d", got)
+	}
+	if got := e.ModelInfo(); got != "ollama-all-minilm" {
+		t.Errorf("Expected ModelInfo ollama-all-minilm, got %s", got)
+	}
+
+	// Probing reports why the model cannot be used
+	missing := newTestOllama(t, fake, "missing-model")
+	if _, err := missing.Probe(context.Background()); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected a model not found error, got %v", err)
+	}
+	down := NewOllamaEmbedder("http://127.0.0.1:1", "all-minilm")
+	if _, err := down.Probe(context.Background()); err == nil {
+		t.Error("Expected an error without a server")
+	}
+}
+
+func TestOllamaErrors(t *testing.T) {
+	fake := &fakeOllama{model: "nomic-embed-text", dim: 8}
+	e := newTestOllama(t, fake, "missing-model")
+
+	_, err := e.Embed("1")
+	if err == nil || !strings.Contains(err.Error(), "try pulling it first") {
+		t.Errorf("Expected the server's error message, got %v", err)
+	}
+
+	if _, err := e.EmbedBatch([]string{"1", ""}); err == nil {
+		t.Error("Expected an error for an empty text")
+	}
+	if got := fake.requests.Load(); got != 1 {
+		t.Errorf("Expected no request for an empty text, got %d requests", got-1)
+	}
+}
+
+func TestOllamaCancel(t *testing.T) {
+	fake := &fakeOllama{model: "m", dim: 8, block: make(chan struct{}), started: make(chan struct{}, 100)}
+	defer close(fake.block)
+	e := newTestOllama(t, fake, "m")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-fake.started
+		cancel()
+	}()
+	if _, err := e.EmbedBatchContext(ctx, numberedTexts(100)); err == nil {
+		t.Fatal("Expected an error after cancellation")
+	}
+	if got := fake.requests.Load(); got != 1 {
+		t.Errorf("Expected no request after the cancelled one, got %d requests", got)
+	}
+}
+
+func TestNewOllamaEmbedderHost(t *testing.T) {
+	t.Setenv("OLLAMA_HOST", "0.0.0.0:8080")
+	if got := NewOllamaEmbedder("", "m").host; got != "http://0.0.0.0:8080" {
+		t.Errorf("Expected OLLAMA_HOST with a scheme, got %s", got)
+	}
+	t.Setenv("OLLAMA_HOST", "")
+	if got := NewOllamaEmbedder("", "m").host; got != defaultOllamaHost {
+		t.Errorf("Expected the default host, got %s", got)
+	}
+	if got := NewOllamaEmbedder("https://ollama.internal/", "m").host; got != "https://ollama.internal" {
+		t.Errorf("Expected the trailing slash trimmed, got %s", got)
+	}
+}
@@ -3,27 +3,214 @@ package embedder
 import (
 	"context"
 	"errors"
+	"fmt"
 	"math"
+	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 
 	openai "github.com/sashabaranov/go-openai"
 )
 
+// Request limits of the OpenAI embeddings endpoint, with some headroom
+const (
+	defaultBatchSize   = 256     // The API accepts up to 2048 inputs per request
+	defaultBatchTokens = 200_000 // The API accepts up to 300k tokens per request
+	defaultConcurrency = 10
+)
+
 // OpenAIEmbedder uses OpenAI API for embeddings
 type OpenAIEmbedder struct {
-	client *openai.Client
-	model  string
-	dim    int
+	// Batch calls pack up to MaxBatchSize texts, and about MaxBatchTokens
+	// estimated tokens, into one request, and keep at most Concurrency
+	// requests in flight
+	MaxBatchSize   int
+	MaxBatchTokens int
+	Concurrency    int
+
+	// Retry and RateLimit apply to each request; set them before the first
+	// call
+	Retry     RetryPolicy
+	RateLimit RateLimit
+
+	client      *openai.Client
+	model       string
+	dim         int
+	reduceTo    int    // Sent as the request's dimensions, for models that shorten embeddings
+	endpoint    string // Base URL and Azure deployment, for cache keys
+	limiterOnce sync.Once
+	rateLimiter *rateLimiter
+}
+
+// OpenAIOptions configures the connection of an OpenAIEmbedder, so it can
+// talk to Azure OpenAI or a self-hosted OpenAI-compatible gateway (vLLM,
+// LiteLLM, LocalAI). Empty fields use the API defaults.
+type OpenAIOptions struct {
+	APIKey       string            // OPENAI_API_KEY; optional with a BaseURL
+	BaseURL      string            // OPENAI_BASE_URL, e.g. http://localhost:8000/v1
+	APIVersion   string            // OPENAI_API_VERSION; setting it selects Azure OpenAI
+	Deployment   string            // AZURE_OPENAI_DEPLOYMENT; defaults to the model name without dots
+	Organization string            // OPENAI_ORG_ID
+	Headers      map[string]string // OPENAI_HEADERS as "Name=value,Name=value"; sent with every request
+	Proxy        string            // OPENAI_PROXY; otherwise HTTPS_PROXY applies as usual
+	HTTPClient   *http.Client      // Not read from the environment
+
+	// Dimensions is the embedding size (OPENAI_EMBEDDING_DIMENSIONS); 0
+	// picks the full size of the known OpenAI models. text-embedding-3
+	// models are asked to shorten their embeddings to it; for other models
+	// it only declares their native size, for gateway models this package
+	// does not know.
+	Dimensions int
+}
+
+// OpenAIOptionsFromEnv reads OpenAIOptions from the environment variables
+// named in its field comments
+func OpenAIOptionsFromEnv() (OpenAIOptions, error) {
+	opts := OpenAIOptions{
+		APIKey:       os.Getenv("OPENAI_API_KEY"),
+		BaseURL:      os.Getenv("OPENAI_BASE_URL"),
+		APIVersion:   os.Getenv("OPENAI_API_VERSION"),
+		Deployment:   os.Getenv("AZURE_OPENAI_DEPLOYMENT"),
+		Organization: os.Getenv("OPENAI_ORG_ID"),
+		Proxy:        os.Getenv("OPENAI_PROXY"),
+	}
+
+	if v := os.Getenv("OPENAI_HEADERS"); v != "" {
+		opts.Headers = make(map[string]string)
+		for _, pair := range strings.Split(v, ",") {
+			name, value, ok := strings.Cut(pair, "=")
+			name = strings.TrimSpace(name)
+			if !ok || name == "" {
+				return opts, fmt.Errorf("OPENAI_HEADERS: expected Name=value, got %q", pair)
+			}
+			opts.Headers[name] = strings.TrimSpace(value)
+		}
+	}
+
+	if v := os.Getenv("OPENAI_EMBEDDING_DIMENSIONS"); v != "" {
+		dim, err := strconv.Atoi(v)
+		if err != nil || dim <= 0 {
+			return opts, fmt.Errorf("OPENAI_EMBEDDING_DIMENSIONS: invalid dimension %q", v)
+		}
+		opts.Dimensions = dim
+	}
+	return opts, nil
 }
 
-// NewOpenAIEmbedder creates an OpenAI embedder
+// NewOpenAIEmbedder creates an OpenAI embedder configured from the
+// environment, see OpenAIOptionsFromEnv
 func NewOpenAIEmbedder(model string) (*OpenAIEmbedder, error) {
-	key := os.Getenv("OPENAI_API_KEY")
-	if key == "" {
+	opts, err := OpenAIOptionsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if opts.APIKey == "" && opts.BaseURL == "" {
 		return nil, errors.New("OPENAI_API_KEY environment variable not set")
 	}
+	return NewOpenAIEmbedderWithOptions(model, opts)
+}
 
-	client := openai.NewClient(key)
+// NewOpenAIEmbedderWithOptions creates an OpenAI embedder with explicit
+// connection options. The environment is not consulted.
+func NewOpenAIEmbedderWithOptions(model string, opts OpenAIOptions) (*OpenAIEmbedder, error) {
+	var cfg openai.ClientConfig
+	switch {
+	case opts.APIVersion != "":
+		if opts.APIKey == "" || opts.BaseURL == "" {
+			return nil, errors.New("Azure OpenAI requires an API key and a base URL")
+		}
+		cfg = openai.DefaultAzureConfig(opts.APIKey, opts.BaseURL)
+		cfg.APIVersion = opts.APIVersion
+		if opts.Deployment != "" {
+			cfg.AzureModelMapperFunc = func(string) string { return opts.Deployment }
+		}
+	case opts.APIKey == "" && opts.BaseURL == "":
+		return nil, errors.New("OpenAI requires an API key")
+	default:
+		cfg = openai.DefaultConfig(opts.APIKey)
+		if opts.BaseURL != "" {
+			cfg.BaseURL = strings.TrimRight(opts.BaseURL, "/")
+		}
+	}
+	cfg.OrgID = opts.Organization
+
+	client, err := httpClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	cfg.HTTPClient = client
+	if len(opts.Headers) > 0 {
+		cfg.HTTPClient = headerSetter{client, opts.Headers}
+	}
+
+	e := newOpenAIEmbedder(cfg, model)
+	if opts.Dimensions > 0 {
+		e.dim = opts.Dimensions
+		if strings.HasPrefix(model, "text-embedding-3-") {
+			e.reduceTo = opts.Dimensions
+		}
+	}
+	return e, nil
+}
+
+// httpClient returns the client requests are sent with, routed through
+// opts.Proxy if set
+func httpClient(opts OpenAIOptions) (*http.Client, error) {
+	client := opts.HTTPClient
+	if client == nil {
+		client = &http.Client{}
+	}
+	if opts.Proxy == "" {
+		return client, nil
+	}
+
+	proxy, err := url.Parse(opts.Proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	transport, ok := base.(*http.Transport)
+	if !ok {
+		return nil, errors.New("a proxy cannot be combined with a custom HTTP transport")
+	}
+	transport = transport.Clone()
+	transport.Proxy = http.ProxyURL(proxy)
+
+	c := *client
+	c.Transport = transport
+	return &c, nil
+}
+
+// headerSetter adds fixed headers to every request, overriding those set by
+// the client library, so a gateway may replace the Authorization header
+type headerSetter struct {
+	openai.HTTPDoer
+	headers map[string]string
+}
+
+func (h headerSetter) Do(req *http.Request) (*http.Response, error) {
+	for name, value := range h.headers {
+		req.Header.Set(name, value)
+	}
+	return h.HTTPDoer.Do(req)
+}
+
+func newOpenAIEmbedder(cfg openai.ClientConfig, model string) *OpenAIEmbedder {
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{}
+	}
+	cfg.HTTPClient = retryAfterRecorder{cfg.HTTPClient}
+
+	endpoint := cfg.BaseURL
+	if cfg.APIType == openai.APITypeAzure || cfg.APIType == openai.APITypeAzureAD {
+		endpoint += " deployment=" + cfg.AzureModelMapperFunc(model)
+	}
 
 	// Set dimension based on model
 	dim := 1536 // default for text-embedding-3-small
@@ -32,91 +219,199 @@ func NewOpenAIEmbedder(model string) (*OpenAIEmbedder, error) {
 	}
 
 	return &OpenAIEmbedder{
-		client: client,
-		model:  model,
-		dim:    dim,
-	}, nil
+		MaxBatchSize:   defaultBatchSize,
+		MaxBatchTokens: defaultBatchTokens,
+		Concurrency:    defaultConcurrency,
+		Retry:          DefaultRetryPolicy,
+		client:         openai.NewClientWithConfig(cfg),
+		model:          model,
+		dim:            dim,
+		endpoint:       endpoint,
+	}
 }
 
 // Embed generates an embedding for a single text
 func (e *OpenAIEmbedder) Embed(text string) ([]float32, error) {
+	return e.EmbedContext(context.Background(), text)
+}
+
+// EmbedContext generates an embedding for a single text, aborting the
+// request when ctx is done
+func (e *OpenAIEmbedder) EmbedContext(ctx context.Context, text string) ([]float32, error) {
 	// Validate input
 	if len(text) == 0 {
 		return nil, errors.New("cannot embed empty text")
 	}
 
-	ctx := context.Background()
+	embeddings, err := e.embedRequest(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+// embedRequest embeds texts with a single API call, retried as the policy
+// allows
+func (e *OpenAIEmbedder) embedRequest(ctx context.Context, texts []string) ([][]float32, error) {
+	tokens := 0
+	for _, text := range texts {
+		tokens += estimateTokens(text)
+	}
 
-	resp, err := e.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
-		Model: openai.EmbeddingModel(e.model),
-		Input: []string{text},
+	var resp openai.EmbeddingResponse
+	err := e.withRetry(ctx, tokens, func(ctx context.Context) error {
+		var err error
+		resp, err = e.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+			Model:      openai.EmbeddingModel(e.model),
+			Input:      texts,
+			Dimensions: e.reduceTo,
+		})
+		return err
 	})
 	if err != nil {
-		return nil, errors.New("OpenAI API error: " + err.Error())
+		return nil, fmt.Errorf("OpenAI API error: %w", err)
 	}
 
-	if len(resp.Data) == 0 {
-		return nil, errors.New("no embedding data returned from API")
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("API returned %d embeddings for %d texts", len(resp.Data), len(texts))
 	}
 
-	// Convert float64 to float32
-	v64 := resp.Data[0].Embedding
-	v := make([]float32, len(v64))
-	for i := range v64 {
-		v[i] = float32(v64[i])
-	}
+	// The response carries the input index of each embedding, which need
+	// not match its position
+	embeddings := make([][]float32, len(texts))
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= len(texts) || embeddings[d.Index] != nil {
+			return nil, fmt.Errorf("API returned invalid embedding index %d", d.Index)
+		}
+		if len(d.Embedding) != e.dim {
+			return nil, fmt.Errorf("API returned a %d-dimensional embedding, expected %d (set the model's Dimensions)", len(d.Embedding), e.dim)
+		}
+		v := make([]float32, len(d.Embedding))
+		copy(v, d.Embedding)
 
-	// L2 normalize (important for cosine similarity)
-	l2normalize(v)
+		// L2 normalize (important for cosine similarity)
+		l2normalize(v)
+		embeddings[d.Index] = v
+	}
 
-	return v, nil
+	return embeddings, nil
 }
 
 // EmbedBatch generates embeddings for multiple texts with parallel processing
 func (e *OpenAIEmbedder) EmbedBatch(texts []string) ([][]float32, error) {
-	return e.EmbedBatchWithProgress(texts, nil)
+	return e.EmbedBatchWithProgressContext(context.Background(), texts, nil)
+}
+
+// EmbedBatchContext is EmbedBatch with a context
+func (e *OpenAIEmbedder) EmbedBatchContext(ctx context.Context, texts []string) ([][]float32, error) {
+	return e.EmbedBatchWithProgressContext(ctx, texts, nil)
 }
 
 // EmbedBatchWithProgress generates embeddings with optional progress callback
-// progressFn is called with (completed, total) after each embedding
+// progressFn is called with (completed, total) after each API request
 func (e *OpenAIEmbedder) EmbedBatchWithProgress(texts []string, progressFn func(int, int)) ([][]float32, error) {
-	embeddings := make([][]float32, len(texts))
-	errChan := make(chan error, len(texts))
-	sem := make(chan struct{}, 10) // Limit concurrent API calls to 10
-	completed := make(chan int, len(texts))
-
-	for i := range texts {
-		sem <- struct{}{} // Acquire semaphore
-		go func(idx int) {
-			defer func() { <-sem }() // Release semaphore
-
-			emb, err := e.Embed(texts[idx])
-			if err != nil {
-				errChan <- err
-				completed <- 0
-				return
+	return e.EmbedBatchWithProgressContext(context.Background(), texts, progressFn)
+}
+
+// EmbedBatchWithProgressContext is EmbedBatchWithProgress with a context.
+// Texts are packed into as few requests as the batch limits allow. The
+// first error, including cancellation of ctx, aborts the requests still in
+// flight.
+func (e *OpenAIEmbedder) EmbedBatchWithProgressContext(ctx context.Context, texts []string, progressFn func(int, int)) ([][]float32, error) {
+	for i, text := range texts {
+		if len(text) == 0 {
+			return nil, fmt.Errorf("embedding text %d: cannot embed empty text", i)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		batch batch
+		embs  [][]float32
+		err   error
+	}
+
+	batches := e.batches(texts)
+	jobs := make(chan batch, len(batches))
+	for _, b := range batches {
+		jobs <- b
+	}
+	close(jobs)
+
+	// Buffered for every batch, so workers never block once we stop reading
+	results := make(chan result, len(batches))
+	for range min(max(1, e.Concurrency), len(batches)) {
+		go func() {
+			for b := range jobs {
+				if err := ctx.Err(); err != nil {
+					results <- result{batch: b, err: err}
+					continue
+				}
+				embs, err := e.embedRequest(ctx, texts[b.start:b.end])
+				results <- result{batch: b, embs: embs, err: err}
 			}
-			embeddings[idx] = emb
-			errChan <- nil
-			completed <- 1
-		}(i)
+		}()
 	}
 
-	// Wait for all goroutines to complete and track progress
-	count := 0
-	for i := 0; i < len(texts); i++ {
-		if err := <-errChan; err != nil {
-			return nil, err
+	embeddings := make([][]float32, len(texts))
+	completed := 0
+	for range batches {
+		r := <-results
+		if r.err != nil {
+			return nil, fmt.Errorf("embedding texts %d-%d: %w", r.batch.start, r.batch.end-1, r.err)
 		}
-		count += <-completed
+		copy(embeddings[r.batch.start:r.batch.end], r.embs)
+		completed += r.batch.end - r.batch.start
 		if progressFn != nil {
-			progressFn(count, len(texts))
+			progressFn(completed, len(texts))
 		}
 	}
 
 	return embeddings, nil
 }
 
+// batch is a range of texts sent in one request
+type batch struct {
+	start, end int
+}
+
+// batches packs consecutive texts into requests of at most MaxBatchSize
+// texts and about MaxBatchTokens tokens. A text over the token budget is
+// sent on its own.
+func (e *OpenAIEmbedder) batches(texts []string) []batch {
+	maxSize, maxTokens := e.MaxBatchSize, e.MaxBatchTokens
+	if maxSize <= 0 {
+		maxSize = defaultBatchSize
+	}
+	if maxTokens <= 0 {
+		maxTokens = defaultBatchTokens
+	}
+
+	var batches []batch
+	start, tokens := 0, 0
+	for i, text := range texts {
+		t := estimateTokens(text)
+		if i > start && (i-start >= maxSize || tokens+t > maxTokens) {
+			batches = append(batches, batch{start, i})
+			start, tokens = i, 0
+		}
+		tokens += t
+	}
+	if start < len(texts) {
+		batches = append(batches, batch{start, len(texts)})
+	}
+	return batches
+}
+
+// estimateTokens approximates the token count of text. OpenAI's tokenizers
+// average about four bytes per token on English prose; code and non-Latin
+// scripts use more tokens, which the batch budget's headroom absorbs.
+func estimateTokens(text string) int {
+	return len(text)/4 + 1
+}
+
 // Dimension returns the embedding dimension
 func (e *OpenAIEmbedder) Dimension() int {
 	return e.dim
@@ -127,6 +422,12 @@ func (e *OpenAIEmbedder) ModelInfo() string {
 	return "openai-" + e.model
 }
 
+// cacheIdentity adds the dimension and endpoint to ModelInfo, as a gateway
+// or Azure deployment may serve another model under the same name
+func (e *OpenAIEmbedder) cacheIdentity() string {
+	return fmt.Sprintf("%s\x00%d\x00%s", e.ModelInfo(), e.dim, e.endpoint)
+}
+
 // l2normalize normalizes a vector to unit length
 func l2normalize(v []float32) {
 	var sum float32
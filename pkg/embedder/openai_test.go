@@ -0,0 +1,510 @@
+package embedder
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// fakeOpenAI serves /embeddings, embedding the text "n" as the unit vector
+// along axis n%dim. handle may inject failures; it returns false to let the
+// request through.
+type fakeOpenAI struct {
+	dim      int
+	requests atomic.Int32
+	inputs   atomic.Int32
+	handle   func(w http.ResponseWriter, r *http.Request, n int32) bool
+}
+
+func (f *fakeOpenAI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := f.requests.Add(1)
+	if f.handle != nil && f.handle(w, r, n) {
+		return
+	}
+
+	var req struct {
+		Input      []string `json:"input"`
+		Model      string   `json:"model"`
+		Dimensions int      `json:"dimensions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.inputs.Add(int32(len(req.Input)))
+	dim := f.dim
+	if req.Dimensions > 0 {
+		dim = req.Dimensions
+	}
+
+	// Reverse the order to check that indices are honoured
+	data := make([]openai.Embedding, len(req.Input))
+	for i, text := range req.Input {
+		id, _ := strconv.Atoi(text)
+		v := make([]float32, dim)
+		v[id%dim] = 2
+		data[len(data)-1-i] = openai.Embedding{Object: "embedding", Embedding: v, Index: i}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(openai.EmbeddingResponse{Object: "list", Data: data, Model: openai.EmbeddingModel(req.Model)})
+}
+
+func newTestEmbedder(t *testing.T, fake *fakeOpenAI) *OpenAIEmbedder {
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	cfg := openai.DefaultConfig("test-key")
+	cfg.BaseURL = srv.URL
+	e := newOpenAIEmbedder(cfg, "text-embedding-3-small")
+	e.dim = fake.dim
+	e.Retry = RetryPolicy{MaxAttempts: 4, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+	return e
+}
+
+func numberedTexts(n int) []string {
+	texts := make([]string, n)
+	for i := range texts {
+		texts[i] = strconv.Itoa(i)
+	}
+	return texts
+}
+
+func TestOpenAIEmbedBatchPacksRequests(t *testing.T) {
+	fake := &fakeOpenAI{dim: 64}
+	e := newTestEmbedder(t, fake)
+	e.MaxBatchSize = 100
+
+	var lastCompleted int
+	embeddings, err := e.EmbedBatchWithProgress(numberedTexts(1000), func(completed, total int) {
+		if completed <= lastCompleted || total != 1000 {
+			t.Errorf("Unexpected progress %d/%d after %d", completed, total, lastCompleted)
+		}
+		lastCompleted = completed
+	})
+	if err != nil {
+		t.Fatalf("EmbedBatch: %v", err)
+	}
+
+	if got := fake.requests.Load(); got != 10 {
+		t.Errorf("Expected 10 requests, got %d", got)
+	}
+	if lastCompleted != 1000 {
+		t.Errorf("Expected final progress 1000, got %d", lastCompleted)
+	}
+	for i, v := range embeddings {
+		if v[i%64] != 1 {
+			t.Fatalf("Embedding %d not mapped back to its text: %v", i, v)
+		}
+	}
+}
+
+func TestOpenAIBatchesTokenBudget(t *testing.T) {
+	e := &OpenAIEmbedder{MaxBatchSize: 100, MaxBatchTokens: 1000}
+
+	long := string(make([]byte, 1996)) // 500 tokens
+	huge := string(make([]byte, 8000)) // over budget on its own
+	texts := []string{long, long, long, huge, "a", "b"}
+
+	got := fmt.Sprint(e.batches(texts))
+	if want := "[{0 2} {2 3} {3 4} {4 6}]"; got != want {
+		t.Errorf("Expected batches %s, got %s", want, got)
+	}
+}
+
+func TestOpenAIEmbedBatchCancel(t *testing.T) {
+	started := make(chan struct{}, 100)
+	fake := &fakeOpenAI{dim: 8}
+	fake.handle = func(w http.ResponseWriter, r *http.Request, n int32) bool {
+		// The server only notices a closed connection once the body is read
+		io.Copy(io.Discard, r.Body)
+		started <- struct{}{}
+		<-r.Context().Done()
+		return true
+	}
+	e := newTestEmbedder(t, fake)
+	e.MaxBatchSize = 1
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	if _, err := e.EmbedBatchContext(ctx, numberedTexts(50)); err == nil {
+		t.Fatal("Expected an error after cancellation")
+	}
+	if got := fake.requests.Load(); got > int32(defaultConcurrency) {
+		t.Errorf("Expected no requests after cancellation, got %d", got)
+	}
+}
+
+func TestOpenAIEmbedBatchRejectsEmptyText(t *testing.T) {
+	fake := &fakeOpenAI{dim: 8}
+	e := newTestEmbedder(t, fake)
+
+	if _, err := e.EmbedBatch([]string{"1", ""}); err == nil {
+		t.Error("Expected an error for an empty text")
+	}
+	if fake.requests.Load() != 0 {
+		t.Error("Expected no request to be sent")
+	}
+}
+
+// apiError writes an error response in OpenAI's format
+func apiError(w http.ResponseWriter, status int, typ string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"error":{"message":"injected","type":%q}}`, typ)
+}
+
+func TestOpenAIRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		fail     func(w http.ResponseWriter)
+		failures int32 // Requests that fail before the server recovers
+		requests int32
+		ok       bool
+	}{
+		{"rate limited", func(w http.ResponseWriter) { apiError(w, 429, "requests") }, 2, 3, true},
+		{"server error", func(w http.ResponseWriter) { apiError(w, 503, "server_error") }, 1, 2, true},
+		{"gives up", func(w http.ResponseWriter) { apiError(w, 500, "server_error") }, 100, 4, false},
+		{"bad request", func(w http.ResponseWriter) { apiError(w, 400, "invalid_request_error") }, 1, 1, false},
+		{"unauthorized", func(w http.ResponseWriter) { apiError(w, 401, "invalid_request_error") }, 1, 1, false},
+		{"quota", func(w http.ResponseWriter) { apiError(w, 429, "insufficient_quota") }, 1, 1, false},
+		{"connection reset", func(w http.ResponseWriter) {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		}, 2, 3, true},
+	}
+	for _, tt := range tests {
+		fake := &fakeOpenAI{dim: 8}
+		fake.handle = func(w http.ResponseWriter, r *http.Request, n int32) bool {
+			if n > tt.failures {
+				return false
+			}
+			tt.fail(w)
+			return true
+		}
+		e := newTestEmbedder(t, fake)
+
+		_, err := e.Embed("3")
+		if tt.ok && err != nil {
+			t.Errorf("%s: expected success, got %v", tt.name, err)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+		if got := fake.requests.Load(); got != tt.requests {
+			t.Errorf("%s: expected %d requests, got %d", tt.name, tt.requests, got)
+		}
+	}
+}
+
+func TestOpenAIRetryAfter(t *testing.T) {
+	fake := &fakeOpenAI{dim: 8}
+	fake.handle = func(w http.ResponseWriter, r *http.Request, n int32) bool {
+		if n > 1 {
+			return false
+		}
+		w.Header().Set("Retry-After", "1")
+		apiError(w, 429, "requests")
+		return true
+	}
+	e := newTestEmbedder(t, fake)
+	e.Retry.MaxDelay = 5 * time.Second
+
+	start := time.Now()
+	if _, err := e.Embed("1"); err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Expected the retry to wait for Retry-After, took %v", elapsed)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header, value string
+		want          time.Duration
+		ok            bool
+	}{
+		{"Retry-After", "2", 2 * time.Second, true},
+		{"Retry-After", "0.5", 500 * time.Millisecond, true},
+		{"Retry-After", now.Add(3 * time.Second).Format(http.TimeFormat), 3 * time.Second, true},
+		{"Retry-After-Ms", "250", 250 * time.Millisecond, true},
+		{"Retry-After", "soon", 0, false},
+		{"X-Other", "1", 0, false},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		h.Set(tt.header, tt.value)
+		got, ok := parseRetryAfter(h, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: %s: expected %v %v, got %v %v", tt.header, tt.value, tt.want, tt.ok, got, ok)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	post := func(err error) error {
+		return &url.Error{Op: "Post", URL: "https://api.openai.com/v1/embeddings", Err: err}
+	}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"timeout", post(os.ErrDeadlineExceeded), true},
+		{"refused", post(&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}), true},
+		{"reset", post(&net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}), true},
+		{"truncated", post(io.ErrUnexpectedEOF), true},
+		{"server error", &openai.APIError{HTTPStatusCode: 502}, true},
+		{"unsupported scheme", post(errors.New("unsupported protocol scheme \"ftp\"")), false},
+		{"bad certificate", post(x509.UnknownAuthorityError{}), false},
+		{"undecodable response", &json.SyntaxError{}, false},
+		{"cancelled", post(context.Canceled), false},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.err); got != tt.want {
+			t.Errorf("%s: expected retryable %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	// A certificate the client does not trust fails on the first attempt
+	var attempts atomic.Int32
+	e, err := NewOpenAIEmbedderWithOptions("text-embedding-3-small", OpenAIOptions{
+		APIKey: "key",
+		HTTPClient: &http.Client{Transport: roundTripper(func(*http.Request) (*http.Response, error) {
+			attempts.Add(1)
+			return nil, x509.UnknownAuthorityError{}
+		})},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Retry = RetryPolicy{MaxAttempts: 4, BaseDelay: time.Millisecond}
+	if _, err := e.Embed("1"); err == nil || attempts.Load() != 1 {
+		t.Errorf("Expected one failed attempt, got %d: %v", attempts.Load(), err)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt := 1; attempt <= 8; attempt++ {
+		limit := min(p.BaseDelay<<(attempt-1), p.MaxDelay)
+		for range 20 {
+			if d := p.backoff(attempt, 0); d <= 0 || d > limit {
+				t.Fatalf("Attempt %d: expected a delay in (0, %v], got %v", attempt, limit, d)
+			}
+		}
+	}
+	if d := p.backoff(1, 500*time.Millisecond); d != 500*time.Millisecond {
+		t.Errorf("Expected Retry-After to set the delay, got %v", d)
+	}
+	if d := p.backoff(1, time.Hour); d != p.MaxDelay {
+		t.Errorf("Expected Retry-After capped at MaxDelay, got %v", d)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(60)
+	b.now = func() time.Time { return now }
+
+	if d := b.reserve(60); d != 0 {
+		t.Errorf("Expected the full burst to pass, waited %v", d)
+	}
+	if d := b.reserve(30); d != 30*time.Second {
+		t.Errorf("Expected to wait 30s for 30 tokens at 1/s, got %v", d)
+	}
+
+	// The debt is paid back at the refill rate
+	now = now.Add(40 * time.Second)
+	if d := b.reserve(5); d != 0 {
+		t.Errorf("Expected 10 tokens available after 40s, waited %v", d)
+	}
+
+	if newTokenBucket(0).reserve(1000) != 0 {
+		t.Error("Expected an unlimited bucket never to wait")
+	}
+}
+
+func TestOpenAIRateLimit(t *testing.T) {
+	fake := &fakeOpenAI{dim: 8}
+	e := newTestEmbedder(t, fake)
+	e.MaxBatchSize = 1
+	e.RateLimit = RateLimit{RequestsPerMinute: 60} // A burst of 60, then 1/s
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if _, err := e.EmbedBatchContext(ctx, numberedTexts(62)); err == nil {
+		t.Fatal("Expected the limiter to hold requests past the deadline")
+	}
+	if got := fake.requests.Load(); got != 60 {
+		t.Errorf("Expected 60 requests within the burst, got %d", got)
+	}
+}
+
+func TestOpenAIOptions(t *testing.T) {
+	fake := &fakeOpenAI{dim: 8}
+	var got *http.Request
+	fake.handle = func(w http.ResponseWriter, r *http.Request, n int32) bool {
+		got = r.Clone(context.Background())
+		return false
+	}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		opts   OpenAIOptions
+		check  func(r *http.Request) string
+		errMsg string
+	}{
+		{"gateway", OpenAIOptions{BaseURL: srv.URL + "/v1/", Organization: "org", Headers: map[string]string{"X-Gateway-Key": "secret"}}, func(r *http.Request) string {
+			switch {
+			case r.URL.Path != "/v1/embeddings":
+				return "path " + r.URL.Path
+			case r.Header.Get("Authorization") != "":
+				return "unexpected Authorization header"
+			case r.Header.Get("X-Gateway-Key") != "secret":
+				return "missing custom header"
+			case r.Header.Get("OpenAI-Organization") != "org":
+				return "missing organization"
+			}
+			return ""
+		}, ""},
+		{"override auth", OpenAIOptions{APIKey: "key", BaseURL: srv.URL, Headers: map[string]string{"Authorization": "Basic abc"}}, func(r *http.Request) string {
+			if a := r.Header.Get("Authorization"); a != "Basic abc" {
+				return "Authorization " + a
+			}
+			return ""
+		}, ""},
+		{"azure", OpenAIOptions{APIKey: "key", BaseURL: srv.URL, APIVersion: "2024-02-01", Deployment: "embed"}, func(r *http.Request) string {
+			switch {
+			case r.URL.Path != "/openai/deployments/embed/embeddings":
+				return "path " + r.URL.Path
+			case r.URL.Query().Get("api-version") != "2024-02-01":
+				return "query " + r.URL.RawQuery
+			case r.Header.Get("api-key") != "key":
+				return "missing api-key header"
+			}
+			return ""
+		}, ""},
+		{"proxy", OpenAIOptions{APIKey: "key", BaseURL: "http://gateway.invalid/v1", Proxy: srv.URL}, func(r *http.Request) string {
+			if r.Host != "gateway.invalid" {
+				return "host " + r.Host
+			}
+			return ""
+		}, ""},
+		{"no key", OpenAIOptions{}, nil, "requires an API key"},
+		{"azure without key", OpenAIOptions{BaseURL: srv.URL, APIVersion: "2024-02-01"}, nil, "requires an API key"},
+		{"proxy with custom transport", OpenAIOptions{APIKey: "key", Proxy: srv.URL, HTTPClient: &http.Client{Transport: roundTripper(nil)}}, nil, "custom HTTP transport"},
+	}
+	for _, tt := range tests {
+		tt.opts.Dimensions = 8
+		e, err := NewOpenAIEmbedderWithOptions("text-embedding-3-small", tt.opts)
+		if tt.errMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("%s: expected error %q, got %v", tt.name, tt.errMsg, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		got = nil
+		if _, err := e.Embed("1"); err != nil {
+			t.Errorf("%s: Embed: %v", tt.name, err)
+			continue
+		}
+		if msg := tt.check(got); msg != "" {
+			t.Errorf("%s: %s", tt.name, msg)
+		}
+	}
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestOpenAIDimensionMismatch(t *testing.T) {
+	fake := &fakeOpenAI{dim: 8}
+	e := newTestEmbedder(t, fake)
+	e.dim = 16
+
+	if _, err := e.Embed("1"); err == nil || !strings.Contains(err.Error(), "8-dimensional") {
+		t.Errorf("Expected a dimension error, got %v", err)
+	}
+}
+
+func TestOpenAIReducedDimensions(t *testing.T) {
+	fake := &fakeOpenAI{dim: 64}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	opts := OpenAIOptions{BaseURL: srv.URL, Dimensions: 16}
+
+	// text-embedding-3 models shorten their embeddings on request
+	e, err := NewOpenAIEmbedderWithOptions("text-embedding-3-large", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := e.Embed("1"); err != nil || len(v) != 16 {
+		t.Errorf("Expected a 16-dimensional embedding, got %d: %v", len(v), err)
+	}
+
+	// Other models are assumed to produce the declared size natively
+	e, err = NewOpenAIEmbedderWithOptions("bge-m3", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Embed("1"); err == nil || !strings.Contains(err.Error(), "64-dimensional") {
+		t.Errorf("Expected a dimension error, got %v", err)
+	}
+}
+
+func TestOpenAIOptionsFromEnv(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "key")
+	t.Setenv("OPENAI_BASE_URL", "http://localhost:4000")
+	t.Setenv("OPENAI_HEADERS", "X-A=1, X-B = two=2")
+	t.Setenv("OPENAI_EMBEDDING_DIMENSIONS", "1024")
+
+	opts, err := OpenAIOptionsFromEnv()
+	if err != nil {
+		t.Fatalf("OpenAIOptionsFromEnv: %v", err)
+	}
+	if opts.APIKey != "key" || opts.BaseURL != "http://localhost:4000" || opts.Dimensions != 1024 {
+		t.Errorf("Unexpected options %+v", opts)
+	}
+	if opts.Headers["X-A"] != "1" || opts.Headers["X-B"] != "two=2" {
+		t.Errorf("Unexpected headers %v", opts.Headers)
+	}
+
+	t.Setenv("OPENAI_HEADERS", "broken")
+	if _, err := OpenAIOptionsFromEnv(); err == nil {
+		t.Error("Expected an error for a malformed header")
+	}
+	t.Setenv("OPENAI_HEADERS", "")
+	t.Setenv("OPENAI_EMBEDDING_DIMENSIONS", "-1")
+	if _, err := OpenAIOptionsFromEnv(); err == nil {
+		t.Error("Expected an error for an invalid dimension")
+	}
+}
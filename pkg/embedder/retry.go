@@ -0,0 +1,264 @@
+package embedder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// RetryPolicy controls how OpenAIEmbedder retries failed requests. Rate
+// limits (429), server errors (5xx) and transient network errors (timeouts,
+// refused or reset connections) are retried; other errors, such as a bad
+// request, an invalid key or an untrusted certificate, fail at once.
+type RetryPolicy struct {
+	MaxAttempts int           // Attempts per request, including the first; 1 disables retries
+	BaseDelay   time.Duration // Delay before the first retry, doubled on each further retry
+	MaxDelay    time.Duration // Upper bound of a single delay, including one asked for by Retry-After
+}
+
+// DefaultRetryPolicy is used by NewOpenAIEmbedder
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 6,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    time.Minute,
+}
+
+// backoff returns the delay before retry number attempt (starting at 1):
+// a random duration up to BaseDelay*2^(attempt-1), capped at MaxDelay. A
+// server-requested delay takes precedence when it is longer.
+func (p RetryPolicy) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 {
+		d = min(d, p.MaxDelay)
+	}
+	// Full jitter keeps parallel workers that failed together from retrying
+	// together
+	if d > 0 {
+		d = rand.N(d) + 1
+	}
+	if retryAfter > d {
+		d = retryAfter
+		if p.MaxDelay > 0 {
+			d = min(d, p.MaxDelay)
+		}
+	}
+	return d
+}
+
+// retryable reports whether a failed request may succeed when sent again
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		// An exhausted quota is reported as a 429 but will not recover
+		if apiErr.Type == "insufficient_quota" || apiErr.Code == "insufficient_quota" {
+			return false
+		}
+		return retryableStatus(apiErr.HTTPStatusCode)
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return retryableStatus(reqErr.HTTPStatusCode)
+	}
+
+	// No response at all. Only transient transport failures are worth
+	// another attempt, not a bad URL, TLS failure or undecodable response.
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func retryableStatus(code int) bool {
+	switch {
+	case code == http.StatusRequestTimeout, code == http.StatusConflict, code == http.StatusTooManyRequests:
+		return true
+	case code >= 500:
+		return true
+	}
+	return false
+}
+
+type retryAfterKey struct{}
+
+// retryAfterRecorder notes the delay asked for by a failed response in the
+// *time.Duration stored in the request context, as go-openai's errors do not
+// carry the response headers
+type retryAfterRecorder struct {
+	openai.HTTPDoer
+}
+
+func (r retryAfterRecorder) Do(req *http.Request) (*http.Response, error) {
+	resp, err := r.HTTPDoer.Do(req)
+	if err != nil || resp.StatusCode < 400 {
+		return resp, err
+	}
+	if hint, ok := req.Context().Value(retryAfterKey{}).(*time.Duration); ok {
+		if d, ok := parseRetryAfter(resp.Header, time.Now()); ok {
+			*hint = d
+		}
+	}
+	return resp, err
+}
+
+// parseRetryAfter reads OpenAI's retry-after-ms header, or the standard
+// Retry-After header in seconds or as an HTTP date
+func parseRetryAfter(h http.Header, now time.Time) (time.Duration, bool) {
+	if v := h.Get("Retry-After-Ms"); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil && ms >= 0 {
+			return time.Duration(ms * float64(time.Millisecond)), true
+		}
+	}
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if s, err := strconv.ParseFloat(v, 64); err == nil && s >= 0 {
+		return time.Duration(s * float64(time.Second)), true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(0, t.Sub(now)), true
+	}
+	return 0, false
+}
+
+// RateLimit caps the request rate of an OpenAIEmbedder on the client side,
+// so a large indexing run stays under the account's limits instead of
+// relying on 429 responses. Zero fields are unlimited.
+type RateLimit struct {
+	RequestsPerMinute int
+	TokensPerMinute   int // Estimated from the text length, like the batch budget
+}
+
+// rateLimiter enforces a RateLimit with one token bucket per quantity
+type rateLimiter struct {
+	requests, tokens *tokenBucket
+}
+
+func newRateLimiter(l RateLimit) *rateLimiter {
+	return &rateLimiter{
+		requests: newTokenBucket(l.RequestsPerMinute),
+		tokens:   newTokenBucket(l.TokensPerMinute),
+	}
+}
+
+// wait blocks until a request of the given token count may be sent
+func (l *rateLimiter) wait(ctx context.Context, tokens int) error {
+	d := max(l.requests.reserve(1), l.tokens.reserve(tokens))
+	if d <= 0 {
+		return ctx.Err()
+	}
+	return sleep(ctx, d)
+}
+
+// tokenBucket refills perMinute tokens per minute up to a burst of one
+// minute's worth. A nil bucket is unlimited.
+type tokenBucket struct {
+	mu       sync.Mutex
+	rate     float64 // Tokens per second
+	capacity float64
+	tokens   float64
+	last     time.Time
+	now      func() time.Time
+}
+
+func newTokenBucket(perMinute int) *tokenBucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &tokenBucket{
+		rate:     float64(perMinute) / 60,
+		capacity: float64(perMinute),
+		tokens:   float64(perMinute),
+		now:      time.Now,
+	}
+}
+
+// reserve takes n tokens and returns how long the caller must wait before
+// using them. The bucket may go into debt, so a request larger than the
+// burst waits for the refill rather than forever.
+func (b *tokenBucket) reserve(n int) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if !b.last.IsZero() {
+		b.tokens = min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// withRetry sends a request through the rate limiter, retrying it as the
+// policy allows. send receives a context that collects the Retry-After hint
+// of a failed response.
+func (e *OpenAIEmbedder) withRetry(ctx context.Context, tokens int, send func(context.Context) error) error {
+	attempts := max(1, e.Retry.MaxAttempts)
+	for attempt := 1; ; attempt++ {
+		if err := e.limiter().wait(ctx, tokens); err != nil {
+			return err
+		}
+
+		var retryAfter time.Duration
+		err := send(context.WithValue(ctx, retryAfterKey{}, &retryAfter))
+		if err == nil {
+			return nil
+		}
+		if attempt >= attempts || ctx.Err() != nil || !retryable(err) {
+			if attempt > 1 {
+				return fmt.Errorf("%w (after %d attempts)", err, attempt)
+			}
+			return err
+		}
+
+		if err := sleep(ctx, e.Retry.backoff(attempt, retryAfter)); err != nil {
+			return err
+		}
+	}
+}
+
+// limiter returns the rate limiter, built from RateLimit on first use
+func (e *OpenAIEmbedder) limiter() *rateLimiter {
+	e.limiterOnce.Do(func() {
+		e.rateLimiter = newRateLimiter(e.RateLimit)
+	})
+	return e.rateLimiter
+}
@@ -0,0 +1,118 @@
+package embedder
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+)
+
+// tensor is a weight loaded from a safetensors file, converted to float32
+// and stored row-major
+type tensor struct {
+	shape []int
+	data  []float32
+}
+
+// loadSafetensors reads every tensor of a .safetensors file: an 8-byte
+// little-endian header size, a JSON header mapping names to dtype, shape
+// and byte range, and the raw data. F32, F16 and BF16 tensors are
+// supported.
+func loadSafetensors(path string) (map[string]tensor, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < 8 {
+		return nil, errors.New("safetensors: file too short")
+	}
+	size := binary.LittleEndian.Uint64(raw)
+	if size > uint64(len(raw)-8) {
+		return nil, fmt.Errorf("safetensors: header size %d exceeds file size", size)
+	}
+
+	var header map[string]json.RawMessage
+	if err := json.Unmarshal(raw[8:8+size], &header); err != nil {
+		return nil, fmt.Errorf("safetensors: header: %w", err)
+	}
+	data := raw[8+size:]
+
+	tensors := make(map[string]tensor, len(header))
+	for name, msg := range header {
+		if name == "__metadata__" {
+			continue
+		}
+		var info struct {
+			Dtype       string   `json:"dtype"`
+			Shape       []int    `json:"shape"`
+			DataOffsets [2]int64 `json:"data_offsets"`
+		}
+		if err := json.Unmarshal(msg, &info); err != nil {
+			return nil, fmt.Errorf("safetensors: tensor %s: %w", name, err)
+		}
+
+		n := 1
+		for _, d := range info.Shape {
+			n *= d
+		}
+		start, end := info.DataOffsets[0], info.DataOffsets[1]
+		if start < 0 || start > end || end > int64(len(data)) {
+			return nil, fmt.Errorf("safetensors: tensor %s: invalid data offsets %d-%d", name, start, end)
+		}
+
+		values, err := decodeFloats(info.Dtype, data[start:end], n)
+		if err != nil {
+			return nil, fmt.Errorf("safetensors: tensor %s: %w", name, err)
+		}
+		tensors[name] = tensor{shape: info.Shape, data: values}
+	}
+	return tensors, nil
+}
+
+// decodeFloats converts n little-endian floats of the given dtype
+func decodeFloats(dtype string, b []byte, n int) ([]float32, error) {
+	width := map[string]int{"F32": 4, "F16": 2, "BF16": 2}[dtype]
+	if width == 0 {
+		return nil, fmt.Errorf("unsupported dtype %s", dtype)
+	}
+	if len(b) != n*width {
+		return nil, fmt.Errorf("expected %d bytes for %d %s values, got %d", n*width, n, dtype, len(b))
+	}
+
+	values := make([]float32, n)
+	for i := range values {
+		switch dtype {
+		case "F32":
+			values[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+		case "BF16":
+			values[i] = math.Float32frombits(uint32(binary.LittleEndian.Uint16(b[2*i:])) << 16)
+		case "F16":
+			values[i] = float16to32(binary.LittleEndian.Uint16(b[2*i:]))
+		}
+	}
+	return values, nil
+}
+
+// float16to32 converts an IEEE 754 half-precision value
+func float16to32(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1f
+	frac := uint32(h) & 0x3ff
+
+	switch {
+	case exp == 0x1f: // Inf and NaN
+		return math.Float32frombits(sign | 0xff<<23 | frac<<13)
+	case exp == 0 && frac == 0:
+		return math.Float32frombits(sign)
+	case exp == 0: // Subnormal, normalized for float32
+		for frac&0x400 == 0 {
+			frac <<= 1
+			exp--
+		}
+		exp++
+		frac &= 0x3ff
+	}
+	return math.Float32frombits(sign | (exp+127-15)<<23 | frac<<13)
+}
@@ -0,0 +1,158 @@
+#!/usr/bin/env python3
+"""Generate the tiny BERT fixture used by bert_test.go.
+
+Writes a randomly initialised sentence-transformer model directory (config,
+WordPiece vocab, safetensors weights, pooling config) and expected.json with
+the token ids of a few sentences, from transformers' BertTokenizer, and
+their embeddings, from SentenceTransformer.encode with normalization.
+
+Needs sentence-transformers (which pulls in transformers and torch).
+Run from this directory: python3 generate.py
+"""
+
+import json
+import math
+import os
+import random
+import struct
+
+import sentence_transformers
+import transformers
+from sentence_transformers import SentenceTransformer
+from transformers import BertTokenizer
+
+HIDDEN = 16
+LAYERS = 2
+HEADS = 2
+INTERMEDIATE = 32
+MAX_POSITIONS = 32
+MAX_SEQ_LENGTH = 16
+EPS = 1e-12
+
+SENTENCES = [
+    "The quick brown fox jumps over the lazy dog.",
+    "Embeddings for vector search!",
+    "Café, HELLO world?",
+    "unbelievable",
+    "xyz qqq",
+    "",
+    "the dog, the fox, the dog, the fox, the dog, the fox, the dog",
+]
+
+VOCAB = (
+    ["[PAD]", "[UNK]", "[CLS]", "[SEP]", "[MASK]"]
+    + list(".,!?-")
+    + "the quick brown fox jump over lazy dog search index vector embed cafe hello world un a".split()
+    + ["##s", "##ed", "##ing", "##ding", "##dings", "##believ", "##able"]
+    + [chr(c) for c in range(ord("b"), ord("z") + 1)]
+    + ["##" + chr(c) for c in range(ord("a"), ord("z") + 1) if chr(c) != "q"]
+)
+
+
+# Weights
+
+def make_weights(rng):
+    shapes = {
+        "embeddings.word_embeddings.weight": [len(VOCAB), HIDDEN],
+        "embeddings.position_embeddings.weight": [MAX_POSITIONS, HIDDEN],
+        "embeddings.token_type_embeddings.weight": [2, HIDDEN],
+        "embeddings.LayerNorm.weight": [HIDDEN],
+        "embeddings.LayerNorm.bias": [HIDDEN],
+        "pooler.dense.weight": [HIDDEN, HIDDEN],
+        "pooler.dense.bias": [HIDDEN],
+    }
+    for l in range(LAYERS):
+        p = "encoder.layer.%d." % l
+        for name in ("attention.self.query", "attention.self.key", "attention.self.value", "attention.output.dense"):
+            shapes[p + name + ".weight"] = [HIDDEN, HIDDEN]
+            shapes[p + name + ".bias"] = [HIDDEN]
+        shapes[p + "intermediate.dense.weight"] = [INTERMEDIATE, HIDDEN]
+        shapes[p + "intermediate.dense.bias"] = [INTERMEDIATE]
+        shapes[p + "output.dense.weight"] = [HIDDEN, INTERMEDIATE]
+        shapes[p + "output.dense.bias"] = [HIDDEN]
+        for name in ("attention.output.LayerNorm", "output.LayerNorm"):
+            shapes[p + name + ".weight"] = [HIDDEN]
+            shapes[p + name + ".bias"] = [HIDDEN]
+
+    weights = {}
+    for name, shape in sorted(shapes.items()):
+        n = math.prod(shape)
+        if name.endswith("LayerNorm.weight"):
+            flat = [1 + rng.gauss(0, 0.1) for _ in range(n)]
+        else:
+            flat = [rng.gauss(0, 0.3) for _ in range(n)]
+        # Round to float32 so Python and Go start from the same values
+        flat = list(struct.unpack("<%df" % n, struct.pack("<%df" % n, *flat)))
+        weights[name] = (shape, flat)
+    return weights
+
+
+def write_safetensors(path, weights):
+    header, blobs, offset = {"__metadata__": {"format": "pt"}}, [], 0
+    for name, (shape, flat) in weights.items():
+        blob = struct.pack("<%df" % len(flat), *flat)
+        header[name] = {"dtype": "F32", "shape": shape, "data_offsets": [offset, offset + len(blob)]}
+        blobs.append(blob)
+        offset += len(blob)
+    raw = json.dumps(header, separators=(",", ":")).encode()
+    raw += b" " * (-len(raw) % 8)
+    with open(path, "wb") as f:
+        f.write(struct.pack("<Q", len(raw)))
+        f.write(raw)
+        for blob in blobs:
+            f.write(blob)
+
+
+def main():
+    rng = random.Random(42)
+    weights = make_weights(rng)
+    write_safetensors("model.safetensors", weights)
+
+    with open("vocab.txt", "w") as f:
+        f.write("\n".join(VOCAB) + "\n")
+    with open("config.json", "w") as f:
+        json.dump({
+            "architectures": ["BertModel"],
+            "model_type": "bert",
+            "hidden_size": HIDDEN,
+            "num_hidden_layers": LAYERS,
+            "num_attention_heads": HEADS,
+            "intermediate_size": INTERMEDIATE,
+            "hidden_act": "gelu",
+            "max_position_embeddings": MAX_POSITIONS,
+            "type_vocab_size": 2,
+            "vocab_size": len(VOCAB),
+            "layer_norm_eps": EPS,
+        }, f, indent=2)
+    with open("tokenizer_config.json", "w") as f:
+        json.dump({"tokenizer_class": "BertTokenizer", "do_lower_case": True}, f, indent=2)
+    with open("sentence_bert_config.json", "w") as f:
+        json.dump({"max_seq_length": MAX_SEQ_LENGTH, "do_lower_case": False}, f, indent=2)
+
+    os.makedirs("1_Pooling", exist_ok=True)
+    with open("1_Pooling/config.json", "w") as f:
+        json.dump({"word_embedding_dimension": HIDDEN, "pooling_mode_mean_tokens": True}, f, indent=2)
+    with open("modules.json", "w") as f:
+        json.dump([
+            {"idx": 0, "name": "0", "path": "", "type": "sentence_transformers.models.Transformer"},
+            {"idx": 1, "name": "1", "path": "1_Pooling", "type": "sentence_transformers.models.Pooling"},
+        ], f, indent=2)
+
+    tokenizer = BertTokenizer("vocab.txt", do_lower_case=True)
+    ids = [tokenizer(text, truncation=True, max_length=MAX_SEQ_LENGTH)["input_ids"] for text in SENTENCES]
+    model = SentenceTransformer(".", device="cpu")
+    embeddings = model.encode(SENTENCES, normalize_embeddings=True, convert_to_numpy=True)
+
+    expected = {
+        "generator": "sentence-transformers %s, transformers %s" % (sentence_transformers.__version__, transformers.__version__),
+        "sentences": [
+            {"text": text, "ids": i, "embedding": [round(float(v), 7) for v in e]}
+            for text, i, e in zip(SENTENCES, ids, embeddings)
+        ],
+    }
+    with open("expected.json", "w") as f:
+        json.dump(expected, f, indent=1)
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,216 @@
+package embedder
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// wordPiece is BERT's tokenizer: text is cleaned, lowercased, stripped of
+// accents and split on whitespace and punctuation, then each word is split
+// greedily into the longest pieces found in the vocabulary
+type wordPiece struct {
+	vocab     map[string]int32
+	size      int // Lines in the vocabulary, one past the largest id
+	lowercase bool
+	unk       int32
+	cls, sep  int32
+}
+
+// maxWordChars is the longest word split into pieces; longer ones are unknown
+const maxWordChars = 100
+
+// loadWordPiece reads a vocab.txt with one token per line, the line number
+// being its id
+func loadWordPiece(path string, lowercase bool) (*wordPiece, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	wp := &wordPiece{vocab: make(map[string]int32), lowercase: lowercase}
+	scanner := bufio.NewScanner(f)
+	for id := int32(0); scanner.Scan(); id++ {
+		token := strings.TrimRight(scanner.Text(), "\r")
+		// A duplicated token maps to its last line, as in transformers
+		wp.vocab[token] = id
+		wp.size++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, special := range []struct {
+		token string
+		id    *int32
+	}{{"[UNK]", &wp.unk}, {"[CLS]", &wp.cls}, {"[SEP]", &wp.sep}} {
+		id, ok := wp.vocab[special.token]
+		if !ok {
+			return nil, fmt.Errorf("vocabulary has no %s token", special.token)
+		}
+		*special.id = id
+	}
+	return wp, nil
+}
+
+// encode returns the token ids of text between [CLS] and [SEP], truncated
+// to maxLen ids in total
+func (wp *wordPiece) encode(text string, maxLen int) []int32 {
+	ids := []int32{wp.cls}
+	for _, word := range wp.words(text) {
+		ids = wp.appendPieces(ids, word)
+		if len(ids) >= maxLen-1 {
+			ids = ids[:maxLen-1]
+			break
+		}
+	}
+	return append(ids, wp.sep)
+}
+
+// words splits text into lowercased words, single punctuation marks and
+// single CJK ideographs
+func (wp *wordPiece) words(text string) []string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = word[:0]
+		}
+	}
+
+	for _, r := range text {
+		switch {
+		case r == 0 || r == unicode.ReplacementChar || isControl(r):
+			continue
+		case isWhitespace(r):
+			flush()
+			continue
+		}
+
+		if wp.lowercase {
+			r = unicode.ToLower(r)
+			if unicode.Is(unicode.Mn, r) {
+				continue
+			}
+			r = stripAccent(r)
+		}
+		if isPunctuation(r) || isCJK(r) {
+			flush()
+			words = append(words, string(r))
+			continue
+		}
+		word = append(word, r)
+	}
+	flush()
+	return words
+}
+
+// appendPieces appends the ids of word's longest-match-first pieces, or
+// [UNK] if word cannot be covered by the vocabulary
+func (wp *wordPiece) appendPieces(ids []int32, word string) []int32 {
+	runes := []rune(word)
+	if len(runes) > maxWordChars {
+		return append(ids, wp.unk)
+	}
+
+	n := len(ids)
+	for start := 0; start < len(runes); {
+		end := len(runes)
+		for ; end > start; end-- {
+			piece := string(runes[start:end])
+			if start > 0 {
+				piece = "##" + piece
+			}
+			if id, ok := wp.vocab[piece]; ok {
+				ids = append(ids, id)
+				break
+			}
+		}
+		if end == start {
+			return append(ids[:n], wp.unk)
+		}
+		start = end
+	}
+	return ids
+}
+
+func isWhitespace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r' || unicode.Is(unicode.Zs, r)
+}
+
+func isControl(r rune) bool {
+	if r == '\t' || r == '\n' || r == '\r' {
+		return false
+	}
+	return unicode.In(r, unicode.Cc, unicode.Cf)
+}
+
+// isPunctuation treats all non-alphanumeric ASCII as punctuation, as BERT
+// does, besides Unicode's punctuation classes
+func isPunctuation(r rune) bool {
+	if r >= 33 && r <= 47 || r >= 58 && r <= 64 || r >= 91 && r <= 96 || r >= 123 && r <= 126 {
+		return true
+	}
+	return unicode.IsPunct(r)
+}
+
+// isCJK reports whether r is a CJK ideograph, which BERT treats as a word
+// of its own
+func isCJK(r rune) bool {
+	return r >= 0x4E00 && r <= 0x9FFF || r >= 0x3400 && r <= 0x4DBF ||
+		r >= 0x20000 && r <= 0x2CEAF || r >= 0xF900 && r <= 0xFAFF ||
+		r >= 0x2F800 && r <= 0x2FA1F
+}
+
+// stripAccent returns the base letter of a precomposed accented letter.
+// The standard library has no Unicode normalization, so this covers the
+// Latin, Greek and Cyrillic letters that decompose into a base letter and
+// combining marks; already decomposed marks are dropped by words.
+func stripAccent(r rune) rune {
+	if base, ok := accentBase[r]; ok {
+		return base
+	}
+	return r
+}
+
+var accentBase = func() map[rune]rune {
+	pairs := []rune(accentPairs)
+	m := make(map[rune]rune, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		m[pairs[i]] = pairs[i+1]
+	}
+	return m
+}()
+
+// accentPairs lists each accented letter followed by its base letter, from
+// the NFD decompositions of U+00C0-024F, U+0370-04FF and U+1E00-1FFF
+const accentPairs = "" +
+	"ÀAÁAÂAÃAÄAÅAÇCÈEÉEÊEËEÌIÍIÎIÏIÑNÒOÓOÔOÕOÖOÙUÚUÛUÜUÝYàaáaâaãaäaåa" +
+	"çcèeéeêeëeìiíiîiïiñnòoóoôoõoöoùuúuûuüuýyÿyĀAāaĂAăaĄAąaĆCćcĈCĉcĊC" +
+	"ċcČCčcĎDďdĒEēeĔEĕeĖEėeĘEęeĚEěeĜGĝgĞGğgĠGġgĢGģgĤHĥhĨIĩiĪIīiĬIĭiĮI" +
+	"įiİIĴJĵjĶKķkĹLĺlĻLļlĽLľlŃNńnŅNņnŇNňnŌOōoŎOŏoŐOőoŔRŕrŖRŗrŘRřrŚSśs" +
+	"ŜSŝsŞSşsŠSšsŢTţtŤTťtŨUũuŪUūuŬUŭuŮUůuŰUűuŲUųuŴWŵwŶYŷyŸYŹZźzŻZżzŽZ" +
+	"žzƠOơoƯUưuǍAǎaǏIǐiǑOǒoǓUǔuǕUǖuǗUǘuǙUǚuǛUǜuǞAǟaǠAǡaǢÆǣæǦGǧgǨKǩkǪO" +
+	"ǫoǬOǭoǮƷǯʒǰjǴGǵgǸNǹnǺAǻaǼÆǽæǾØǿøȀAȁaȂAȃaȄEȅeȆEȇeȈIȉiȊIȋiȌOȍoȎOȏo" +
+	"ȐRȑrȒRȓrȔUȕuȖUȗuȘSșsȚTțtȞHȟhȦAȧaȨEȩeȪOȫoȬOȭoȮOȯoȰOȱoȲYȳy΅¨ΆΑΈΕΉΗ" +
+	"ΊΙΌΟΎΥΏΩΐιΪΙΫΥάαέεήηίιΰυϊιϋυόούυώωϓϒϔϒЀЕЁЕЃГЇІЌКЍИЎУЙИйиѐеёеѓгїі" +
+	"ќкѝиўуѶѴѷѵӁЖӂжӐАӑаӒАӓаӖЕӗеӚӘӛәӜЖӝжӞЗӟзӢИӣиӤИӥиӦОӧоӪӨӫөӬЭӭэӮУӯуӰУ" +
+	"ӱуӲУӳуӴЧӵчӸЫӹыḀAḁaḂBḃbḄBḅbḆBḇbḈCḉcḊDḋdḌDḍdḎDḏdḐDḑdḒDḓdḔEḕeḖEḗeḘE" +
+	"ḙeḚEḛeḜEḝeḞFḟfḠGḡgḢHḣhḤHḥhḦHḧhḨHḩhḪHḫhḬIḭiḮIḯiḰKḱkḲKḳkḴKḵkḶLḷlḸL" +
+	"ḹlḺLḻlḼLḽlḾMḿmṀMṁmṂMṃmṄNṅnṆNṇnṈNṉnṊNṋnṌOṍoṎOṏoṐOṑoṒOṓoṔPṕpṖPṗpṘR" +
+	"ṙrṚRṛrṜRṝrṞRṟrṠSṡsṢSṣsṤSṥsṦSṧsṨSṩsṪTṫtṬTṭtṮTṯtṰTṱtṲUṳuṴUṵuṶUṷuṸU" +
+	"ṹuṺUṻuṼVṽvṾVṿvẀWẁwẂWẃwẄWẅwẆWẇwẈWẉwẊXẋxẌXẍxẎYẏyẐZẑzẒZẓzẔZẕzẖhẗtẘw" +
+	"ẙyẛſẠAạaẢAảaẤAấaẦAầaẨAẩaẪAẫaẬAậaẮAắaẰAằaẲAẳaẴAẵaẶAặaẸEẹeẺEẻeẼEẽe" +
+	"ẾEếeỀEềeỂEểeỄEễeỆEệeỈIỉiỊIịiỌOọoỎOỏoỐOốoỒOồoỔOổoỖOỗoỘOộoỚOớoỜOờo" +
+	"ỞOởoỠOỡoỢOợoỤUụuỦUủuỨUứuỪUừuỬUửuỮUữuỰUựuỲYỳyỴYỵyỶYỷyỸYỹyἀαἁαἂαἃα" +
+	"ἄαἅαἆαἇαἈΑἉΑἊΑἋΑἌΑἍΑἎΑἏΑἐεἑεἒεἓεἔεἕεἘΕἙΕἚΕἛΕἜΕἝΕἠηἡηἢηἣηἤηἥηἦηἧη" +
+	"ἨΗἩΗἪΗἫΗἬΗἭΗἮΗἯΗἰιἱιἲιἳιἴιἵιἶιἷιἸΙἹΙἺΙἻΙἼΙἽΙἾΙἿΙὀοὁοὂοὃοὄοὅοὈΟὉΟ" +
+	"ὊΟὋΟὌΟὍΟὐυὑυὒυὓυὔυὕυὖυὗυὙΥὛΥὝΥὟΥὠωὡωὢωὣωὤωὥωὦωὧωὨΩὩΩὪΩὫΩὬΩὭΩὮΩὯΩ" +
+	"ὰαάαὲεέεὴηήηὶιίιὸοόοὺυύυὼωώωᾀαᾁαᾂαᾃαᾄαᾅαᾆαᾇαᾈΑᾉΑᾊΑᾋΑᾌΑᾍΑᾎΑᾏΑᾐηᾑη" +
+	"ᾒηᾓηᾔηᾕηᾖηᾗηᾘΗᾙΗᾚΗᾛΗᾜΗᾝΗᾞΗᾟΗᾠωᾡωᾢωᾣωᾤωᾥωᾦωᾧωᾨΩᾩΩᾪΩᾫΩᾬΩᾭΩᾮΩᾯΩᾰαᾱα" +
+	"ᾲαᾳαᾴαᾶαᾷαᾸΑᾹΑᾺΑΆΑᾼΑ῁¨ῂηῃηῄηῆηῇηῈΕΈΕῊΗΉΗῌΗ῍᾿῎᾿῏᾿ῐιῑιῒιΐιῖιῗιῘΙῙΙ" +
+	"ῚΙΊΙ῝῾῞῾῟῾ῠυῡυῢυΰυῤρῥρῦυῧυῨΥῩΥῪΥΎΥῬΡ῭¨΅¨ῲωῳωῴωῶωῷωῸΟΌΟῺΩΏΩῼΩ"
@@ -1,12 +1,15 @@
 package loader
 
 import (
-	"bufio"
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
 	"fmt"
 	"io/fs"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/perbu/minirag/pkg/minirag"
 )
@@ -51,48 +54,103 @@ func LoadDocuments(fsys embed.FS, root string) (map[string]string, error) {
 }
 
 // ChunkDocument splits a document into semantic chunks based on markdown headings
+// Front matter fields, if any, become the Metadata of every chunk
+//
+// Each chunk is given a stable ID built from the path and heading hierarchy,
+// so it keeps its ID when its text is edited, along with its line and byte
+// range, heading breadcrumb and level, the document title, a content hash
+// and an approximate token count.
 func ChunkDocument(path, content string) []minirag.Chunk {
 	var chunks []minirag.Chunk
 
-	scanner := bufio.NewScanner(strings.NewReader(content))
+	metadata, bodyStart := splitFrontMatter(content)
+	body := content[bodyStart:]
+	bodyLine := strings.Count(content[:bodyStart], "\n") + 1
+
+	// Open headings, outermost first
+	type heading struct {
+		level int
+		text  string
+	}
+	var headings []heading
+	title := metadata["title"]
+	ids := make(map[string]int) // Chunks seen per ID, to number repeats
 
-	var currentHeading string
 	var currentContent strings.Builder
-	var currentOffset int
-	lineOffset := 0
+	currentOffset, currentLine := bodyStart, bodyLine
+	endOffset, endLine := bodyStart, bodyLine // End of the last non-blank line
+	lineOffset, lineNumber := bodyStart, bodyLine
+	fence := "" // Marker of the open code fence
 
 	flushChunk := func() {
-		if currentContent.Len() > 0 {
-			chunks = append(chunks, minirag.Chunk{
-				Path:    path,
-				Content: strings.TrimSpace(currentContent.String()),
-				Heading: currentHeading,
-				Offset:  currentOffset,
-			})
+		if currentContent.Len() == 0 {
+			return
+		}
+		c := minirag.Chunk{
+			Path:      path,
+			Content:   strings.TrimSpace(currentContent.String()),
+			Offset:    currentOffset,
+			EndOffset: endOffset,
+			StartLine: currentLine,
+			EndLine:   endLine,
+			Metadata:  metadata,
 		}
+		if len(headings) > 0 {
+			c.Heading = headings[len(headings)-1].text
+			c.HeadingLevel = headings[len(headings)-1].level
+			c.HeadingPath = make([]string, len(headings))
+			for i, h := range headings {
+				c.HeadingPath[i] = h.text
+			}
+		}
+		c.ID = chunkID(path, c.HeadingPath, ids)
+		chunks = append(chunks, c)
 	}
 
-	for scanner.Scan() {
-		line := scanner.Text()
+	for rest := body; rest != ""; {
+		line, next, _ := strings.Cut(rest, "\n")
+		line = strings.TrimSuffix(line, "\r")
+		lineEnd := lineOffset + len(line)
+
+		// Lines in fenced code blocks, such as shell comments, are never
+		// headings
+		inFence := fence != ""
+		if !inFence {
+			fence = openFence(line)
+		} else if closesFence(line, fence) {
+			fence = ""
+		}
 
 		// Check if this is a heading (starts with #)
-		if strings.HasPrefix(line, "#") {
+		if level, text, ok := parseHeading(line); ok && !inFence {
 			// Flush previous chunk before starting new one
 			flushChunk()
 
-			// Start new chunk
-			currentHeading = strings.TrimSpace(strings.TrimLeft(line, "#"))
+			// Start new chunk, closing the headings it is not nested in
+			for len(headings) > 0 && headings[len(headings)-1].level >= level {
+				headings = headings[:len(headings)-1]
+			}
+			headings = append(headings, heading{level, text})
+			if title == "" && level == 1 {
+				title = text
+			}
 			currentContent.Reset()
-			currentOffset = lineOffset
+			currentOffset, currentLine = lineOffset, lineNumber
+			endOffset, endLine = lineEnd, lineNumber
 		} else {
 			// Add line to current chunk
 			if currentContent.Len() > 0 {
 				currentContent.WriteString("\n")
 			}
 			currentContent.WriteString(line)
+			if strings.TrimSpace(line) != "" {
+				endOffset, endLine = lineEnd, lineNumber
+			}
 		}
 
-		lineOffset += len(line) + 1 // +1 for newline
+		lineOffset += len(rest) - len(next) // The line and its newline
+		lineNumber++
+		rest = next
 	}
 
 	// Flush final chunk
@@ -100,17 +158,146 @@ func ChunkDocument(path, content string) []minirag.Chunk {
 
 	// If no chunks were created (no headings), treat whole doc as one chunk
 	if len(chunks) == 0 {
+		trimmed := strings.TrimRightFunc(body, unicode.IsSpace)
 		chunks = append(chunks, minirag.Chunk{
-			Path:    path,
-			Content: strings.TrimSpace(content),
-			Heading: "",
-			Offset:  0,
+			ID:        path,
+			Path:      path,
+			Content:   strings.TrimSpace(body),
+			Heading:   "",
+			Offset:    bodyStart,
+			EndOffset: bodyStart + len(trimmed),
+			StartLine: bodyLine,
+			EndLine:   bodyLine + strings.Count(trimmed, "\n"),
+			Metadata:  metadata,
 		})
 	}
 
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	for i := range chunks {
+		c := &chunks[i]
+		c.Title = title
+		c.ContentHash = contentHash(c.Content)
+		c.Tokens = estimateTokens(c.Content)
+	}
 	return chunks
 }
 
+// parseHeading recognizes an ATX heading: one to six "#" followed by a
+// space or the end of the line, and optionally closed by "#"s
+func parseHeading(line string) (level int, text string, ok bool) {
+	rest := strings.TrimLeft(line, "#")
+	level = len(line) - len(rest)
+	if level == 0 || level > 6 || rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+		return 0, "", false
+	}
+	text = strings.TrimSpace(rest)
+	if closed := strings.TrimRight(text, "#"); closed == "" || strings.HasSuffix(closed, " ") {
+		text = strings.TrimSpace(closed)
+	}
+	return level, text, true
+}
+
+// openFence returns the marker of the code fence line opens, or ""
+func openFence(line string) string {
+	line = strings.TrimLeft(line, " ")
+	for _, c := range []string{"`", "~"} {
+		marker := line[:len(line)-len(strings.TrimLeft(line, c))]
+		if len(marker) >= 3 {
+			return marker
+		}
+	}
+	return ""
+}
+
+// closesFence reports whether line closes the code fence opened by marker
+func closesFence(line, marker string) bool {
+	line = strings.TrimSpace(line)
+	return strings.HasPrefix(line, marker) && strings.Trim(line, marker[:1]) == ""
+}
+
+// chunkID names a chunk by its path and heading hierarchy, as in
+// "guide.md#install/linux". Text before the first heading is named by the
+// path alone. Repeated names in a document are numbered from the second,
+// as in "guide.md#faq~2", counting in ids.
+func chunkID(path string, headingPath []string, ids map[string]int) string {
+	id := path
+	if len(headingPath) > 0 {
+		slugs := make([]string, len(headingPath))
+		for i, h := range headingPath {
+			slugs[i] = slug(h)
+		}
+		id += "#" + strings.Join(slugs, "/")
+	}
+	ids[id]++
+	if n := ids[id]; n > 1 {
+		id += "~" + strconv.Itoa(n)
+	}
+	return id
+}
+
+// slug lowercases a heading and joins its words with "-"
+func slug(heading string) string {
+	words := strings.FieldsFunc(strings.ToLower(heading), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, "-")
+}
+
+// contentHash returns the hex SHA-256 of a chunk's content
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// estimateTokens approximates the token count of text at about four bytes
+// per token, the average of OpenAI's tokenizers on English prose
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// splitFrontMatter parses a front matter block of "key: value" lines between
+// two "---" lines at the very start of a document. It returns the fields and
+// the offset where the body begins; without front matter it returns nil, 0.
+// Only flat string values are supported: nested keys and lists are skipped.
+func splitFrontMatter(content string) (map[string]string, int) {
+	rest, ok := strings.CutPrefix(content, "---\n")
+	if !ok {
+		return nil, 0
+	}
+
+	metadata := make(map[string]string)
+	offset := len(content) - len(rest)
+	for rest != "" {
+		line, next, _ := strings.Cut(rest, "\n")
+		offset += len(line) + 1
+		rest = next
+
+		line = strings.TrimRight(line, "\r")
+		if line == "---" {
+			return metadata, min(offset, len(content))
+		}
+		if line == "" || line[0] == ' ' || line[0] == '\t' || line[0] == '#' || line[0] == '-' {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		if value != "" {
+			metadata[strings.TrimSpace(key)] = value
+		}
+	}
+
+	// No closing line, so this was not front matter
+	return nil, 0
+}
+
 // LoadAndChunkAll loads all documents and chunks them
 func LoadAndChunkAll(fsys embed.FS, root string) ([]minirag.Chunk, error) {
 	docs, err := LoadDocuments(fsys, root)
@@ -2,6 +2,7 @@ package loader
 
 import (
 	"embed"
+	"strings"
 	"testing"
 )
 
@@ -60,3 +61,118 @@ func TestChunkDocument_NoHeadings(t *testing.T) {
 func contains(s, substr string) bool {
 	return len(s) > 0 && len(substr) > 0 && len(s) >= len(substr) && s[:len(substr)] == substr || len(s) > len(substr) && contains(s[1:], substr)
 }
+
+func TestChunkDocument_FrontMatter(t *testing.T) {
+	content := "---\ntitle: \"Getting started\"\nsection: guide\ntags:\n  - intro\n---\n# Install\nRun the installer.\n"
+
+	chunks := ChunkDocument("test.md", content)
+
+	if len(chunks) != 1 {
+		t.Fatalf("Expected 1 chunk, got %d", len(chunks))
+	}
+	if got := chunks[0].Metadata["title"]; got != "Getting started" {
+		t.Errorf("Expected title 'Getting started', got '%s'", got)
+	}
+	if got := chunks[0].Metadata["section"]; got != "guide" {
+		t.Errorf("Expected section 'guide', got '%s'", got)
+	}
+	if _, ok := chunks[0].Metadata["tags"]; ok {
+		t.Errorf("List-valued key should be skipped")
+	}
+	if content[chunks[0].Offset:chunks[0].Offset+9] != "# Install" {
+		t.Errorf("Offset %d does not point at the heading", chunks[0].Offset)
+	}
+	if contains(chunks[0].Content, "section") {
+		t.Errorf("Front matter leaked into chunk content: %q", chunks[0].Content)
+	}
+}
+
+func TestChunkDocument_Hierarchy(t *testing.T) {
+	content := "Preamble.\n\n# Guide\nWelcome.\n\n## Install\n### Linux\nApt.\n#### Debian\ndpkg\n### Linux\nAgain.\n## Usage\nUse it.\n"
+
+	chunks := ChunkDocument("docs/guide.md", content)
+
+	want := []struct {
+		id, breadcrumb string
+		level          int
+	}{
+		{"docs/guide.md", "", 0},
+		{"docs/guide.md#guide", "Guide", 1},
+		{"docs/guide.md#guide/install/linux", "Guide > Install > Linux", 3},
+		{"docs/guide.md#guide/install/linux/debian", "Guide > Install > Linux > Debian", 4},
+		{"docs/guide.md#guide/install/linux~2", "Guide > Install > Linux", 3},
+		{"docs/guide.md#guide/usage", "Guide > Usage", 2},
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("Expected %d chunks, got %d", len(want), len(chunks))
+	}
+	for i, w := range want {
+		c := chunks[i]
+		if c.ID != w.id || c.Breadcrumb() != w.breadcrumb || c.HeadingLevel != w.level {
+			t.Errorf("Chunk %d: expected %s [%s] level %d, got %s [%s] level %d", i, w.id, w.breadcrumb, w.level, c.ID, c.Breadcrumb(), c.HeadingLevel)
+		}
+		if c.Title != "Guide" {
+			t.Errorf("Chunk %d: expected title 'Guide' from the first heading, got '%s'", i, c.Title)
+		}
+	}
+
+	// Editing a section keeps its ID but changes its hash
+	edited := ChunkDocument("docs/guide.md", strings.Replace(content, "Apt.", "Use apt-get.", 1))
+	if edited[2].ID != chunks[2].ID || edited[2].ContentHash == chunks[2].ContentHash {
+		t.Errorf("Expected an edited chunk to keep ID %s with a new hash", chunks[2].ID)
+	}
+	if edited[2].Tokens <= chunks[2].Tokens {
+		t.Errorf("Expected more tokens for longer content, got %d and %d", chunks[2].Tokens, edited[2].Tokens)
+	}
+}
+
+func TestChunkDocument_Positions(t *testing.T) {
+	content := "---\ntitle: Manual\n---\n# Intro\r\nFirst line.\r\n\r\n## Setup\r\nStep one.\r\nStep two.\r\n\r\n\r\n"
+
+	chunks := ChunkDocument("manual.md", content)
+
+	if len(chunks) != 2 {
+		t.Fatalf("Expected 2 chunks, got %d", len(chunks))
+	}
+	wantText := []string{"# Intro\r\nFirst line.", "## Setup\r\nStep one.\r\nStep two."}
+	wantLines := [][2]int{{4, 5}, {7, 9}}
+	for i, c := range chunks {
+		if got := content[c.Offset:c.EndOffset]; got != wantText[i] {
+			t.Errorf("Chunk %d: expected text %q, got %q", i, wantText[i], got)
+		}
+		if c.StartLine != wantLines[i][0] || c.EndLine != wantLines[i][1] {
+			t.Errorf("Chunk %d: expected lines %v, got %d-%d", i, wantLines[i], c.StartLine, c.EndLine)
+		}
+		if c.Title != "Manual" {
+			t.Errorf("Chunk %d: expected title from front matter, got '%s'", i, c.Title)
+		}
+	}
+	if chunks[1].Content != "Step one.\nStep two." {
+		t.Errorf("Expected carriage returns stripped, got %q", chunks[1].Content)
+	}
+
+	// Without headings or a title, the file name stands in
+	single := ChunkDocument("notes/todo.md", "Buy milk.\n\n")
+	if c := single[0]; c.ID != "notes/todo.md" || c.Title != "todo" || c.StartLine != 1 || c.EndLine != 1 || c.EndOffset != 9 {
+		t.Errorf("Unexpected single chunk %+v", c)
+	}
+}
+
+func TestChunkDocument_CodeFences(t *testing.T) {
+	content := "# Setup\n```bash\n# Install the tool\nmake install\n```\n#hashtag is text\n\n## Configure ##\n~~~~\n## not a heading\n~~~\n~~~~\nDone.\n"
+
+	chunks := ChunkDocument("setup.md", content)
+
+	if len(chunks) != 2 {
+		t.Fatalf("Expected 2 chunks, got %d: %+v", len(chunks), chunks)
+	}
+	if !strings.Contains(chunks[0].Content, "# Install the tool") || !strings.Contains(chunks[0].Content, "#hashtag") {
+		t.Errorf("Expected the code comment and hashtag in the first chunk, got %q", chunks[0].Content)
+	}
+	if chunks[1].Breadcrumb() != "Setup > Configure" {
+		t.Errorf("Expected breadcrumb 'Setup > Configure', got '%s'", chunks[1].Breadcrumb())
+	}
+	if !strings.Contains(chunks[1].Content, "## not a heading") {
+		t.Errorf("Expected the fenced line in the second chunk, got %q", chunks[1].Content)
+	}
+}
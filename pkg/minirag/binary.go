@@ -0,0 +1,139 @@
+package minirag
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// BinaryVectors holds one sign bit per embedding dimension. Search ranks all
+// chunks by the Hamming distance between their bits and the query's bits,
+// then rescores the closest candidates with exact cosine similarity. At
+// 1/32 of the float32 size the candidate pass fits in memory for very large
+// corpora. Attach to VectorIndex.Binary.
+type BinaryVectors struct {
+	// Candidates sets how many chunks, as a multiple of topK, survive the
+	// Hamming pass and are rescored. 0 picks 10.
+	Candidates int
+
+	dim   int
+	words int      // uint64 words per vector
+	bits  []uint64 // n*words sign bits, one vector after another
+}
+
+// QuantizeBinary computes the sign bits of every embedding of index
+func QuantizeBinary(index *VectorIndex) *BinaryVectors {
+	b := &BinaryVectors{
+		Candidates: 10,
+		dim:        index.Dimension,
+		words:      (index.Dimension + 63) / 64,
+	}
+	b.bits = make([]uint64, len(index.Embeddings)*b.words)
+	for i, v := range index.Embeddings {
+		signBits(v, b.bits[i*b.words:(i+1)*b.words])
+	}
+	return b
+}
+
+// signBits sets bit j of dst when v[j] is positive
+func signBits(v []float32, dst []uint64) {
+	for j, x := range v {
+		if x > 0 {
+			dst[j/64] |= 1 << (j % 64)
+		}
+	}
+}
+
+// Len returns the number of quantized vectors
+func (b *BinaryVectors) Len() int {
+	if b.words == 0 {
+		return 0
+	}
+	return len(b.bits) / b.words
+}
+
+// Hamming returns the number of differing sign bits between vectors i and j
+func (b *BinaryVectors) Hamming(i, j int) int {
+	return hamming(b.code(i), b.code(j))
+}
+
+func (b *BinaryVectors) code(i int) []uint64 {
+	return b.bits[i*b.words : (i+1)*b.words]
+}
+
+func hamming(a, b []uint64) int {
+	d := 0
+	for w := range a {
+		d += bits.OnesCount64(a[w] ^ b[w])
+	}
+	return d
+}
+
+// search runs the Hamming prefilter over the chunks accepted by mask and
+// rescores the survivors exactly
+func (b *BinaryVectors) search(vectors [][]float32, query []float32, mask chunkMask, topK int, threshold float32) []hit {
+	multiple := b.Candidates
+	if multiple <= 0 {
+		multiple = 10
+	}
+	n := b.Len()
+	candidates := n
+	if topK > 0 {
+		candidates = min(n, topK*multiple)
+	}
+
+	q := make([]uint64, b.words)
+	signBits(query, q)
+
+	// Smaller distances are better, so score by negated distance
+	prefilter := newBestHits(candidates)
+	for i := 0; i < n; i++ {
+		if !mask.has(i) {
+			continue
+		}
+		prefilter.push(hit{idx: i, score: -float32(hamming(q, b.code(i)))})
+	}
+
+	return rescoreHits(vectors, query, prefilter.hits(), topK, threshold)
+}
+
+// marshal encodes the sign bits as the payload of a BIN1 section:
+//
+//	candidates, dimension, vector count: uint32
+//	bits: count*ceil(dimension/64) uint64
+func (b *BinaryVectors) marshal() []byte {
+	var w binWriter
+	w.u32(uint32(b.Candidates))
+	w.u32(uint32(b.dim))
+	w.u32(uint32(b.Len()))
+	for _, word := range b.bits {
+		w.u64(word)
+	}
+	return w.buf
+}
+
+// unmarshalBinary decodes a BIN1 section for an index of n chunks and the
+// given dimension
+func unmarshalBinary(data []byte, n, dim int) (*BinaryVectors, error) {
+	r := &binReader{buf: data}
+	b := &BinaryVectors{Candidates: int(r.u32()), dim: int(r.u32())}
+	count := int(r.u32())
+	if r.err != nil {
+		return nil, r.err
+	}
+	if count != n {
+		return nil, fmt.Errorf("%w: %d binary vectors, index has %d chunks", ErrCountMismatch, count, n)
+	}
+	if b.dim != dim {
+		return nil, fmt.Errorf("%w: binary vectors have dimension %d, index has %d", ErrDimensionMismatch, b.dim, dim)
+	}
+
+	b.words = (dim + 63) / 64
+	if n*b.words > (len(data)-r.off)/8 {
+		return nil, fmt.Errorf("%w: section payload truncated", ErrCorruptIndex)
+	}
+	b.bits = make([]uint64, n*b.words)
+	for i := range b.bits {
+		b.bits[i] = r.u64()
+	}
+	return b, r.err
+}
@@ -0,0 +1,134 @@
+package minirag
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestQuantizeBinary(t *testing.T) {
+	index := BuildIndex(
+		[]Chunk{{Path: "a.md"}, {Path: "b.md"}, {Path: "c.md"}},
+		[][]float32{
+			{0.5, -0.5, 0.5, -0.5},
+			{0.5, -0.5, 0.5, 0.5},
+			{-0.5, 0.5, -0.5, 0.5},
+		},
+		4,
+	)
+	b := QuantizeBinary(index)
+
+	if b.Len() != 3 {
+		t.Fatalf("Expected 3 vectors, got %d", b.Len())
+	}
+	if d := b.Hamming(0, 1); d != 1 {
+		t.Errorf("Expected Hamming distance 1, got %d", d)
+	}
+	if d := b.Hamming(0, 2); d != 4 {
+		t.Errorf("Expected Hamming distance 4, got %d", d)
+	}
+}
+
+func TestBinaryRecall(t *testing.T) {
+	index := randomIndex(3000, 128, 13)
+	index.Binary = QuantizeBinary(index)
+	index.Binary.Candidates = 20
+
+	r := meanRecall(t, index, 50, 10)
+	t.Logf("binary recall@10 with 20x rescoring: %.3f", r)
+	if r < 0.9 {
+		t.Errorf("Expected recall@10 >= 0.9, got %.3f", r)
+	}
+
+	// Rescored scores are exact
+	q := index.Embeddings[0]
+	for _, res := range Search(index, q, 5, 0) {
+		if want := CosineSimilarity(q, index.Embeddings[res.Chunk.Offset]); res.Score != want {
+			t.Errorf("Expected exact score %.6f, got %.6f", want, res.Score)
+		}
+	}
+}
+
+func TestSearchModeSelection(t *testing.T) {
+	index := randomIndex(500, 64, 14)
+	index.Int8 = QuantizeInt8(index, PerVector)
+	index.Binary = QuantizeBinary(index)
+
+	tests := []struct {
+		mode SearchMode
+		topK int
+		want SearchMode
+	}{
+		{ModeAuto, 5, ModeInt8},
+		{ModeBinary, 5, ModeBinary},
+		{ModeExact, 5, ModeExact},
+		{ModeHNSW, 5, ModeExact},
+		{ModeIVF, 5, ModeExact},
+	}
+	for _, tt := range tests {
+		index.Mode = tt.mode
+		if got := index.resolveMode(tt.topK); got != tt.want {
+			t.Errorf("Mode %s: expected %s, got %s", tt.mode, tt.want, got)
+		}
+	}
+
+	index.HNSW = BuildHNSW(index, DefaultHNSWConfig())
+	index.Mode = ModeAuto
+	if got := index.resolveMode(5); got != ModeHNSW {
+		t.Errorf("Expected HNSW with topK 5, got %s", got)
+	}
+	if got := index.resolveMode(0); got != ModeExact {
+		t.Errorf("Expected exact scan with unlimited topK, got %s", got)
+	}
+	if got := index.ResolveMode(SearchOptions{TopK: 5}); got != ModeHNSW {
+		t.Errorf("Expected ResolveMode to pick HNSW, got %s", got)
+	}
+	if got := index.ResolveMode(SearchOptions{TopK: 5, Filter: Eq("path", "doc3.md")}); got != ModeExact {
+		t.Errorf("Expected exact scan with a selective filter, got %s", got)
+	}
+	// Hybrid and MMR search fetch candidates unless TopK is unlimited
+	for _, tt := range []struct {
+		opts SearchOptions
+		want SearchMode
+	}{
+		{HybridOptions{SearchOptions: SearchOptions{TopK: 5}}.VectorOptions(), ModeHNSW},
+		{HybridOptions{}.VectorOptions(), ModeExact},
+		{MMROptions{SearchOptions: SearchOptions{TopK: 1}}.VectorOptions(), ModeHNSW},
+		{MMROptions{}.VectorOptions(), ModeExact},
+	} {
+		if got := index.ResolveMode(tt.opts); got != tt.want {
+			t.Errorf("Candidates for %+v: expected %s, got %s", tt.opts, tt.want, got)
+		}
+	}
+
+	for _, name := range []string{"auto", "exact", "hnsw", "ivf", "int8", "binary", "pq"} {
+		m, err := ParseSearchMode(name)
+		if err != nil || m.String() != name {
+			t.Errorf("ParseSearchMode(%q) = %s, %v", name, m, err)
+		}
+	}
+	if _, err := ParseSearchMode("bogus"); err == nil {
+		t.Error("Expected error for unknown mode")
+	}
+}
+
+func TestBinaryPersistence(t *testing.T) {
+	index := randomIndex(300, 100, 15)
+	index.Binary = QuantizeBinary(index)
+	index.Binary.Candidates = 7
+	index.Mode = ModeBinary
+
+	var buf bytes.Buffer
+	if err := WriteIndex(&buf, index); err != nil {
+		t.Fatalf("WriteIndex: %v", err)
+	}
+	loaded, err := LoadIndexFromBytes(buf.Bytes())
+	if err != nil {
+		t.Fatalf("LoadIndexFromBytes: %v", err)
+	}
+	if loaded.Mode != ModeBinary {
+		t.Errorf("Expected mode binary, got %s", loaded.Mode)
+	}
+	if loaded.Binary == nil || loaded.Binary.Candidates != 7 || loaded.Binary.Hamming(1, 2) != index.Binary.Hamming(1, 2) {
+		t.Fatalf("Binary vectors not round-tripped")
+	}
+}
@@ -0,0 +1,255 @@
+package minirag
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// BM25Config holds the parameters of a BM25 lexical index
+type BM25Config struct {
+	K1            float32 // Term frequency saturation; 0 picks 1.2
+	B             float32 // Document length normalisation in [0, 1]; 0 picks 0.75
+	HeadingWeight float32 // How much a heading term counts relative to a content term; 0 picks 2
+}
+
+// BM25 is an inverted index over the content and headings of the chunks,
+// scored with Okapi BM25. It finds exact identifiers, error codes and config
+// keys that embeddings tend to miss. Attach to VectorIndex.BM25 for
+// LexicalSearch and HybridSearch.
+type BM25 struct {
+	K1, B, HeadingWeight float32
+
+	terms     map[string]int32 // term -> index into postings
+	postings  [][]posting      // per term, the chunks containing it in index order
+	lengths   []float32        // weighted term count of each chunk
+	avgLength float32
+}
+
+// posting records the weighted frequency of a term in one chunk
+type posting struct {
+	doc int32
+	tf  float32
+}
+
+// BuildBM25 indexes the content and headings of chunks
+func BuildBM25(chunks []Chunk, cfg BM25Config) *BM25 {
+	if cfg.K1 <= 0 {
+		cfg.K1 = 1.2
+	}
+	if cfg.B <= 0 {
+		cfg.B = 0.75
+	}
+	if cfg.HeadingWeight <= 0 {
+		cfg.HeadingWeight = 2
+	}
+
+	b := &BM25{
+		K1:            cfg.K1,
+		B:             cfg.B,
+		HeadingWeight: cfg.HeadingWeight,
+		terms:         make(map[string]int32),
+		lengths:       make([]float32, 0, len(chunks)),
+	}
+	tf := make(map[string]float32)
+	for i := range chunks {
+		b.add(&chunks[i], tf)
+	}
+	b.updateAverage()
+	return b
+}
+
+// add indexes c as the next chunk, using tf as scratch space. The caller
+// updates the average length once done adding.
+func (b *BM25) add(c *Chunk, tf map[string]float32) {
+	clear(tf)
+	for _, t := range Tokenize(c.Content) {
+		tf[t]++
+	}
+	for _, t := range Tokenize(c.Heading) {
+		tf[t] += b.HeadingWeight
+	}
+
+	doc := int32(len(b.lengths))
+	var length float32
+	for t, f := range tf {
+		length += f
+		id, ok := b.terms[t]
+		if !ok {
+			id = int32(len(b.postings))
+			b.terms[t] = id
+			b.postings = append(b.postings, nil)
+		}
+		b.postings[id] = append(b.postings[id], posting{doc: doc, tf: f})
+	}
+	b.lengths = append(b.lengths, length)
+}
+
+// clone returns a deep copy of the index, which can be extended
+// independently
+func (b *BM25) clone() *BM25 {
+	c := *b
+	c.terms = maps.Clone(b.terms)
+	c.postings = make([][]posting, len(b.postings))
+	for i, list := range b.postings {
+		c.postings[i] = slices.Clone(list)
+	}
+	c.lengths = slices.Clone(b.lengths)
+	return &c
+}
+
+func (b *BM25) updateAverage() {
+	var total float64
+	for _, l := range b.lengths {
+		total += float64(l)
+	}
+	b.avgLength = 0
+	if len(b.lengths) > 0 {
+		b.avgLength = float32(total / float64(len(b.lengths)))
+	}
+}
+
+// Len returns the number of indexed chunks
+func (b *BM25) Len() int {
+	return len(b.lengths)
+}
+
+// Tokenize splits text into the lowercase terms used by BM25. Identifiers
+// joined by "_", "." or "-", such as max_connections or ERR-404, are kept
+// whole and also split into their parts, so either form matches.
+func Tokenize(text string) []string {
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !isJoiner(r)
+	})
+
+	terms := make([]string, 0, len(fields))
+	for _, f := range fields {
+		f = strings.ToLower(strings.TrimFunc(f, isJoiner))
+		if f == "" {
+			continue
+		}
+		terms = append(terms, f)
+		if strings.IndexFunc(f, isJoiner) < 0 {
+			continue
+		}
+		for _, part := range strings.FieldsFunc(f, isJoiner) {
+			terms = append(terms, part)
+		}
+	}
+	return terms
+}
+
+func isJoiner(r rune) bool {
+	return r == '_' || r == '.' || r == '-'
+}
+
+// search scores the chunks accepted by mask that contain any query term and
+// returns the topK with a score of at least threshold, best first
+func (b *BM25) search(query string, mask chunkMask, topK int, threshold float32) []hit {
+	terms := Tokenize(query)
+	slices.Sort(terms)
+	terms = slices.Compact(terms)
+
+	scores := make([]float32, len(b.lengths))
+	var touched []int32
+	n := float64(len(b.lengths))
+	for _, t := range terms {
+		id, ok := b.terms[t]
+		if !ok {
+			continue
+		}
+		list := b.postings[id]
+		df := float64(len(list))
+		idf := float32(math.Log(1 + (n-df+0.5)/(df+0.5)))
+		for _, p := range list {
+			if !mask.has(int(p.doc)) {
+				continue
+			}
+			norm := b.K1 * (1 - b.B + b.B*b.lengths[p.doc]/b.avgLength)
+			if scores[p.doc] == 0 {
+				touched = append(touched, p.doc)
+			}
+			scores[p.doc] += idf * p.tf * (b.K1 + 1) / (p.tf + norm)
+		}
+	}
+
+	results := newBestHits(topK)
+	for _, doc := range touched {
+		if score := scores[doc]; score > 0 && score >= threshold {
+			results.push(hit{idx: int(doc), score: score})
+		}
+	}
+	return results.hits()
+}
+
+// marshal encodes the inverted index as the payload of a BM25 section:
+//
+//	k1, b, heading weight: float32
+//	chunk count uint32, chunk lengths: count float32
+//	term count uint32, per term in sorted order:
+//	  term length uint32, term bytes, posting count uint32,
+//	  postings: chunk index int32, frequency float32
+func (b *BM25) marshal() []byte {
+	var w binWriter
+	w.f32(b.K1)
+	w.f32(b.B)
+	w.f32(b.HeadingWeight)
+	w.u32(uint32(len(b.lengths)))
+	w.f32s(b.lengths)
+
+	terms := make([]string, 0, len(b.terms))
+	for t := range b.terms {
+		terms = append(terms, t)
+	}
+	slices.Sort(terms)
+	w.u32(uint32(len(terms)))
+	for _, t := range terms {
+		w.u32(uint32(len(t)))
+		w.bytes([]byte(t))
+		list := b.postings[b.terms[t]]
+		w.u32(uint32(len(list)))
+		for _, p := range list {
+			w.i32(p.doc)
+			w.f32(p.tf)
+		}
+	}
+	return w.buf
+}
+
+// unmarshalBM25 decodes a BM25 section for an index of n chunks
+func unmarshalBM25(data []byte, n int) (*BM25, error) {
+	r := &binReader{buf: data}
+	b := &BM25{K1: r.f32(), B: r.f32(), HeadingWeight: r.f32()}
+	count := r.count(4)
+	if r.err == nil && count != n {
+		return nil, fmt.Errorf("%w: BM25 index has %d chunks, index has %d", ErrCountMismatch, count, n)
+	}
+	b.lengths = r.f32s(count)
+
+	terms := r.count(8)
+	b.terms = make(map[string]int32, terms)
+	b.postings = make([][]posting, 0, terms)
+	for range terms {
+		term := string(r.take(r.count(1)))
+		list := make([]posting, r.count(8))
+		for j := range list {
+			list[j] = posting{doc: r.i32(), tf: r.f32()}
+			if list[j].doc < 0 || int(list[j].doc) >= n {
+				r.err = fmt.Errorf("%w: BM25 posting out of range", ErrCorruptIndex)
+			}
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		b.terms[term] = int32(len(b.postings))
+		b.postings = append(b.postings, list)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	b.updateAverage()
+	return b, nil
+}
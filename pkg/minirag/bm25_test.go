@@ -0,0 +1,124 @@
+package minirag
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("Set max_connections to 10, see ERR-404 (v1.2).")
+	want := []string{"set", "max_connections", "max", "connections", "to", "10", "see", "err-404", "err", "404", "v1.2", "v1", "2"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func lexicalIndex() *VectorIndex {
+	chunks := []Chunk{
+		{Path: "config.md", Heading: "Limits", Content: "The server accepts at most max_connections clients at once."},
+		{Path: "errors.md", Heading: "Error codes", Content: "ERR_CONN_REFUSED means the server is not listening."},
+		{Path: "intro.md", Heading: "Introduction", Content: "This server is a small server for serving files."},
+		{Path: "faq.md", Heading: "Connections", Content: "How many clients can connect? See the limits page."},
+	}
+	embeddings := [][]float32{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}, {1, 1, 0}}
+	index := BuildIndex(chunks, embeddings, 3)
+	index.BM25 = BuildBM25(index.Chunks, BM25Config{})
+	return index
+}
+
+func TestLexicalSearch(t *testing.T) {
+	index := lexicalIndex()
+
+	results := LexicalSearch(index, "err_conn_refused", SearchOptions{TopK: 3})
+	if len(results) != 1 || results[0].Chunk.Path != "errors.md" {
+		t.Fatalf("Expected only errors.md for an exact identifier, got %+v", results)
+	}
+
+	// The heading term counts double, so the FAQ outranks the chunk that
+	// only mentions connections inside an identifier
+	results = LexicalSearch(index, "connections", SearchOptions{TopK: 3})
+	if len(results) != 2 || results[0].Chunk.Path != "faq.md" {
+		t.Errorf("Expected faq.md first of 2 results, got %+v", results)
+	}
+
+	results = LexicalSearch(index, "server", SearchOptions{TopK: 3, Filter: Not(Eq("path", "intro.md"))})
+	for _, r := range results {
+		if r.Chunk.Path == "intro.md" {
+			t.Errorf("Filtered chunk returned")
+		}
+	}
+
+	if results := LexicalSearch(index, "nonexistent", SearchOptions{TopK: 3}); len(results) != 0 {
+		t.Errorf("Expected no results, got %d", len(results))
+	}
+}
+
+func TestHybridSearch(t *testing.T) {
+	index := lexicalIndex()
+	query := []float32{0, 0, 1} // semantically closest to intro.md
+
+	for _, fusion := range []Fusion{FusionRRF, FusionWeighted} {
+		results := HybridSearch(index, "ERR_CONN_REFUSED", query, HybridOptions{
+			SearchOptions: SearchOptions{TopK: 2, Threshold: -1},
+			Fusion:        fusion,
+		})
+		if len(results) != 2 {
+			t.Fatalf("fusion %d: expected 2 results, got %d", fusion, len(results))
+		}
+		paths := []string{results[0].Chunk.Path, results[1].Chunk.Path}
+		if !slices.Contains(paths, "errors.md") || !slices.Contains(paths, "intro.md") {
+			t.Errorf("fusion %d: expected the lexical and vector winners, got %v", fusion, paths)
+		}
+
+		// Favouring the lexical ranking puts the identifier match first
+		results = HybridSearch(index, "ERR_CONN_REFUSED", query, HybridOptions{
+			SearchOptions: SearchOptions{TopK: 2, Threshold: -1},
+			Fusion:        fusion,
+			VectorWeight:  0.5,
+			LexicalWeight: 1,
+		})
+		if results[0].Chunk.Path != "errors.md" {
+			t.Errorf("fusion %d: expected errors.md first, got %s", fusion, results[0].Chunk.Path)
+		}
+	}
+}
+
+func TestHybridSearchWithoutBM25(t *testing.T) {
+	index := lexicalIndex()
+	index.BM25 = nil
+
+	results := HybridSearch(index, "ERR_CONN_REFUSED", []float32{0, 0, 1}, HybridOptions{SearchOptions: SearchOptions{TopK: 1}})
+	if len(results) != 1 || results[0].Chunk.Path != "intro.md" {
+		t.Errorf("Expected the vector ranking alone, got %+v", results)
+	}
+}
+
+func TestBM25Persistence(t *testing.T) {
+	index := lexicalIndex()
+
+	var buf bytes.Buffer
+	if err := WriteIndex(&buf, index); err != nil {
+		t.Fatalf("WriteIndex: %v", err)
+	}
+	loaded, err := LoadIndexFromBytes(buf.Bytes())
+	if err != nil {
+		t.Fatalf("LoadIndexFromBytes: %v", err)
+	}
+	if loaded.BM25 == nil {
+		t.Fatal("Expected BM25 index to be loaded")
+	}
+
+	for _, q := range []string{"server", "max_connections", "limits clients"} {
+		want := LexicalSearch(index, q, SearchOptions{TopK: 4})
+		got := LexicalSearch(loaded, q, SearchOptions{TopK: 4})
+		if len(want) != len(got) {
+			t.Fatalf("%q: expected %d results, got %d", q, len(want), len(got))
+		}
+		for i := range want {
+			if want[i].Chunk.Path != got[i].Chunk.Path || want[i].Score != got[i].Score {
+				t.Errorf("%q: result %d differs: %+v vs %+v", q, i, want[i], got[i])
+			}
+		}
+	}
+}
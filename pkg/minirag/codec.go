@@ -0,0 +1,96 @@
+package minirag
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// binWriter appends little-endian values to a byte slice. It is used to
+// build the payloads of binary sections.
+type binWriter struct {
+	buf []byte
+}
+
+func (w *binWriter) u8(v uint8)    { w.buf = append(w.buf, v) }
+func (w *binWriter) u32(v uint32)  { w.buf = binary.LittleEndian.AppendUint32(w.buf, v) }
+func (w *binWriter) u64(v uint64)  { w.buf = binary.LittleEndian.AppendUint64(w.buf, v) }
+func (w *binWriter) i32(v int32)   { w.u32(uint32(v)) }
+func (w *binWriter) f32(v float32) { w.u32(math.Float32bits(v)) }
+func (w *binWriter) bytes(p []byte) {
+	w.buf = append(w.buf, p...)
+}
+
+func (w *binWriter) f32s(v []float32) {
+	for _, x := range v {
+		w.f32(x)
+	}
+}
+
+// binReader reads little-endian values from a section payload. The first
+// read past the end sets err; later reads return zero values.
+type binReader struct {
+	buf []byte
+	off int
+	err error
+}
+
+func (r *binReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.buf)-r.off {
+		r.err = fmt.Errorf("%w: section payload truncated", ErrCorruptIndex)
+		return nil
+	}
+	p := r.buf[r.off : r.off+n]
+	r.off += n
+	return p
+}
+
+func (r *binReader) u8() uint8 {
+	if p := r.take(1); p != nil {
+		return p[0]
+	}
+	return 0
+}
+
+func (r *binReader) u32() uint32 {
+	if p := r.take(4); p != nil {
+		return binary.LittleEndian.Uint32(p)
+	}
+	return 0
+}
+
+func (r *binReader) u64() uint64 {
+	if p := r.take(8); p != nil {
+		return binary.LittleEndian.Uint64(p)
+	}
+	return 0
+}
+
+func (r *binReader) i32() int32   { return int32(r.u32()) }
+func (r *binReader) f32() float32 { return math.Float32frombits(r.u32()) }
+
+// count reads a uint32 length and checks that at least size bytes per
+// element remain, so corrupt input cannot trigger huge allocations
+func (r *binReader) count(size int) int {
+	n := int(r.u32())
+	if r.err == nil && size > 0 && n > (len(r.buf)-r.off)/size {
+		r.err = fmt.Errorf("%w: section payload truncated", ErrCorruptIndex)
+		return 0
+	}
+	return n
+}
+
+func (r *binReader) f32s(n int) []float32 {
+	p := r.take(n * 4)
+	if p == nil {
+		return nil
+	}
+	v := make([]float32, n)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(p[i*4:]))
+	}
+	return v
+}
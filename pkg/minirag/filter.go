@@ -0,0 +1,217 @@
+package minirag
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Filter selects the chunks a search may return. Fields "path" and
+// "heading" refer to Chunk.Path and Chunk.Heading; any other field name is
+// looked up in Chunk.Metadata, and a missing key never matches.
+//
+// Build filters with Eq, In, Prefix, Glob, And, Or and Not, or parse one
+// from the command-line syntax with ParseFilter.
+type Filter interface {
+	Match(c *Chunk) bool
+	String() string
+}
+
+// field returns the value of a filter field for c
+func field(c *Chunk, name string) (string, bool) {
+	switch name {
+	case "path":
+		return c.Path, true
+	case "heading":
+		return c.Heading, true
+	}
+	v, ok := c.Metadata[name]
+	return v, ok
+}
+
+type eqFilter struct{ field, value string }
+
+// Eq matches chunks whose field equals value
+func Eq(field, value string) Filter { return eqFilter{field, value} }
+
+func (f eqFilter) Match(c *Chunk) bool {
+	v, ok := field(c, f.field)
+	return ok && v == f.value
+}
+
+func (f eqFilter) String() string { return f.field + "=" + f.value }
+
+type inFilter struct {
+	field  string
+	values []string
+}
+
+// In matches chunks whose field equals any of values
+func In(field string, values ...string) Filter { return inFilter{field, values} }
+
+func (f inFilter) Match(c *Chunk) bool {
+	v, ok := field(c, f.field)
+	if !ok {
+		return false
+	}
+	for _, want := range f.values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
+
+func (f inFilter) String() string { return f.field + "=" + strings.Join(f.values, "|") }
+
+type prefixFilter struct{ field, prefix string }
+
+// Prefix matches chunks whose field starts with prefix
+func Prefix(field, prefix string) Filter { return prefixFilter{field, prefix} }
+
+func (f prefixFilter) Match(c *Chunk) bool {
+	v, ok := field(c, f.field)
+	return ok && strings.HasPrefix(v, f.prefix)
+}
+
+func (f prefixFilter) String() string { return f.field + "^=" + f.prefix }
+
+type globFilter struct{ field, pattern string }
+
+// Glob matches chunks whose field matches a path.Match pattern. As with
+// path.Match, "*" does not cross "/"; use Prefix to select a directory tree.
+// A malformed pattern matches nothing; ParseFilter rejects it up front.
+func Glob(field, pattern string) Filter { return globFilter{field, pattern} }
+
+func (f globFilter) Match(c *Chunk) bool {
+	v, ok := field(c, f.field)
+	if !ok {
+		return false
+	}
+	matched, err := path.Match(f.pattern, v)
+	return err == nil && matched
+}
+
+func (f globFilter) String() string { return f.field + "~=" + f.pattern }
+
+type andFilter []Filter
+
+// And matches chunks that match every filter. And() matches everything.
+func And(filters ...Filter) Filter { return andFilter(filters) }
+
+func (f andFilter) Match(c *Chunk) bool {
+	for _, sub := range f {
+		if !sub.Match(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f andFilter) String() string { return joinFilters("and", f) }
+
+type orFilter []Filter
+
+// Or matches chunks that match at least one filter. Or() matches nothing.
+func Or(filters ...Filter) Filter { return orFilter(filters) }
+
+func (f orFilter) Match(c *Chunk) bool {
+	for _, sub := range f {
+		if sub.Match(c) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f orFilter) String() string { return joinFilters("or", f) }
+
+type notFilter struct{ f Filter }
+
+// Not matches chunks that do not match f
+func Not(f Filter) Filter { return notFilter{f} }
+
+func (f notFilter) Match(c *Chunk) bool { return !f.f.Match(c) }
+
+func (f notFilter) String() string { return "not(" + f.f.String() + ")" }
+
+func joinFilters(op string, filters []Filter) string {
+	parts := make([]string, len(filters))
+	for i, f := range filters {
+		parts[i] = f.String()
+	}
+	return op + "(" + strings.Join(parts, ", ") + ")"
+}
+
+// chunkMask marks the chunks accepted by a filter. A nil mask accepts every
+// chunk.
+type chunkMask []bool
+
+func (m chunkMask) has(i int) bool { return m == nil || m[i] }
+
+// filterMask evaluates f for every chunk and returns the mask along with the
+// number of matching chunks
+func filterMask(chunks []Chunk, f Filter) (chunkMask, int) {
+	mask := make(chunkMask, len(chunks))
+	matches := 0
+	for i := range chunks {
+		if f.Match(&chunks[i]) {
+			mask[i] = true
+			matches++
+		}
+	}
+	return mask, matches
+}
+
+// ParseFilter parses a single filter clause in the command-line syntax:
+//
+//	key=value       Eq
+//	key=a|b|c       In
+//	key!=value      Not(Eq), or Not(In) with "|"
+//	key^=prefix     Prefix
+//	key~=pattern    Glob
+//
+// A leading "!" negates any clause. Combine several clauses with And.
+func ParseFilter(expr string) (Filter, error) {
+	expr = strings.TrimSpace(expr)
+	if rest, ok := strings.CutPrefix(expr, "!"); ok {
+		f, err := ParseFilter(rest)
+		if err != nil {
+			return nil, err
+		}
+		return Not(f), nil
+	}
+
+	eq := strings.Index(expr, "=")
+	if eq <= 0 {
+		return nil, fmt.Errorf("invalid filter %q: want key=value, key!=value, key^=prefix or key~=pattern", expr)
+	}
+	key, value := expr[:eq], expr[eq+1:]
+	op := byte('=')
+	if last := key[len(key)-1]; last == '!' || last == '^' || last == '~' {
+		op, key = last, key[:len(key)-1]
+	}
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return nil, fmt.Errorf("invalid filter %q: missing key", expr)
+	}
+
+	switch op {
+	case '^':
+		return Prefix(key, value), nil
+	case '~':
+		if _, err := path.Match(value, ""); err != nil {
+			return nil, fmt.Errorf("invalid filter %q: %w", expr, err)
+		}
+		return Glob(key, value), nil
+	}
+
+	var f Filter = Eq(key, value)
+	if strings.Contains(value, "|") {
+		f = In(key, strings.Split(value, "|")...)
+	}
+	if op == '!' {
+		f = Not(f)
+	}
+	return f, nil
+}
@@ -0,0 +1,137 @@
+package minirag
+
+import (
+	"math/rand/v2"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	chunk := &Chunk{
+		Path:     "guide/install.md",
+		Heading:  "Install on Linux",
+		Metadata: map[string]string{"lang": "go", "version": "2"},
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"lang=go", true},
+		{"lang=rust", false},
+		{"lang=rust|go", true},
+		{"lang!=go", false},
+		{"lang!=rust|python", true},
+		{"path^=guide/", true},
+		{"path^=api/", false},
+		{"path~=guide/*.md", true},
+		{"path~=*.md", false},
+		{"heading~=Install*", true},
+		{"!heading~=Install*", false},
+		{"missing=x", false},
+		{"missing!=x", true},
+		{"version=2", true},
+	}
+	for _, tt := range tests {
+		f, err := ParseFilter(tt.expr)
+		if err != nil {
+			t.Errorf("ParseFilter(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := f.Match(chunk); got != tt.want {
+			t.Errorf("%q (%s): expected %v, got %v", tt.expr, f, tt.want, got)
+		}
+	}
+
+	for _, expr := range []string{"", "lang", "=go", "^=x", "path~=[", "!"} {
+		if _, err := ParseFilter(expr); err == nil {
+			t.Errorf("ParseFilter(%q): expected error", expr)
+		}
+	}
+}
+
+func TestFilterCombinators(t *testing.T) {
+	chunk := &Chunk{Path: "a.md", Metadata: map[string]string{"lang": "go"}}
+
+	if !And().Match(chunk) || Or().Match(chunk) {
+		t.Error("Expected empty And to match and empty Or not to")
+	}
+	if !And(Eq("path", "a.md"), In("lang", "go", "rust")).Match(chunk) {
+		t.Error("Expected And of matching filters to match")
+	}
+	if And(Eq("path", "a.md"), Eq("lang", "rust")).Match(chunk) {
+		t.Error("Expected And with a failing filter not to match")
+	}
+	if !Or(Eq("path", "b.md"), Prefix("lang", "g")).Match(chunk) {
+		t.Error("Expected Or with a matching filter to match")
+	}
+	if Not(Glob("path", "*.md")).Match(chunk) {
+		t.Error("Expected Not of a matching filter not to match")
+	}
+}
+
+// taggedIndex is randomIndex with a "group" metadata field of i%groups
+func taggedIndex(n, dim, groups int, seed uint64) *VectorIndex {
+	index := randomIndex(n, dim, seed)
+	for i := range index.Chunks {
+		index.Chunks[i].Metadata = map[string]string{"group": string(rune('a' + i%groups))}
+	}
+	return index
+}
+
+func TestSearchWithFilter(t *testing.T) {
+	index := taggedIndex(2000, 32, 4, 21)
+	structures := map[string]func(){
+		"exact":  func() {},
+		"hnsw":   func() { index.HNSW = BuildHNSW(index, HNSWConfig{Seed: 1}) },
+		"ivf":    func() { index.IVF = BuildIVF(index, IVFConfig{Lists: 16, NProbe: 4, Seed: 1}) },
+		"int8":   func() { index.Int8 = QuantizeInt8(index, PerVector) },
+		"binary": func() { index.Binary = QuantizeBinary(index) },
+		"pq":     func() { index.PQ = QuantizePQ(index, PQConfig{SubVectors: 8, Seed: 1}) },
+	}
+
+	rng := rand.New(rand.NewPCG(3, 3))
+	for name, build := range structures {
+		index.HNSW, index.IVF, index.Int8, index.Binary, index.PQ = nil, nil, nil, nil, nil
+		build()
+
+		for range 10 {
+			query := index.Embeddings[rng.IntN(len(index.Embeddings))]
+			results := SearchWithOptions(index, query, SearchOptions{TopK: 10, Threshold: -1, Filter: Eq("group", "b")})
+			if len(results) != 10 {
+				t.Errorf("%s: expected 10 results, got %d", name, len(results))
+			}
+			for _, r := range results {
+				if r.Chunk.Metadata["group"] != "b" {
+					t.Errorf("%s: result %q does not match the filter", name, r.Chunk.Content)
+				}
+			}
+		}
+	}
+}
+
+func TestSearchWithSelectiveFilter(t *testing.T) {
+	index := taggedIndex(2000, 32, 25, 22)
+	index.HNSW = BuildHNSW(index, HNSWConfig{Seed: 1})
+
+	query := index.Embeddings[0]
+	opts := SearchOptions{TopK: 10, Threshold: -1, Filter: Eq("group", "c")}
+	approx := SearchWithOptions(index, query, opts)
+
+	index.Mode = ModeExact
+	exact := SearchWithOptions(index, query, opts)
+
+	if len(exact) != 10 {
+		t.Fatalf("Expected 10 results, got %d", len(exact))
+	}
+	if r := recall(exact, approx); r != 1 {
+		t.Errorf("Expected a selective filter to fall back to an exact scan, recall %.3f", r)
+	}
+}
+
+func TestSearchWithFilterNoMatches(t *testing.T) {
+	index := taggedIndex(100, 8, 2, 23)
+	results := SearchWithOptions(index, index.Embeddings[0], SearchOptions{TopK: 5, Filter: Eq("group", "z")})
+	if len(results) != 0 {
+		t.Errorf("Expected no results, got %d", len(results))
+	}
+}
@@ -0,0 +1,595 @@
+package minirag
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"time"
+	"unsafe"
+)
+
+// Index file format, version 1
+//
+// All integers are little-endian. A file starts with a 16 byte header
+// followed by a sequence of sections:
+//
+//	header:  magic "MRAGIDX\n" [8]byte | version uint32 | section count uint32
+//	section: tag [4]byte | reserved uint32 | payload length uint64
+//	         payload | CRC-32C of payload uint32 | zero padding to 16 bytes
+//
+// Every section starts on a 16 byte boundary, so payloads are aligned for
+// direct float32 access. Readers skip sections with unknown tags.
+//
+// Sections written by this version:
+//
+//	META  JSON object: model, dimension, chunks, built_at (RFC 3339),
+//	      source_hash, search_mode (optional)
+//	CHNK  JSON array of chunks, in index order
+//	VECS  chunks*dimension float32 values, one vector after another
+//	HNSW  optional HNSW graph, see (*HNSW).marshal
+//	IVFL  optional inverted file, see (*IVF).marshal
+//	INT8  optional int8 quantized vectors, see (*Int8Vectors).marshal
+//	BIN1  optional sign bits, see (*BinaryVectors).marshal
+//	PQCB  optional product-quantized codes, see (*PQCodes).marshal
+//	BM25  optional lexical inverted index, see (*BM25).marshal
+//
+// VECS is omitted when INT8, PQCB or the PQ codes of IVFL have DropFloat32
+// set; the embeddings are then reconstructed from the int8 codes, or failing
+// that the PQ codes, on load.
+//
+// Files that do not start with the magic are decoded as the legacy gob
+// encoding of EmbeddingData.
+const (
+	formatMagic   = "MRAGIDX\n"
+	FormatVersion = 1
+
+	headerSize        = 16
+	sectionHeaderSize = 16
+	sectionAlign      = 16
+)
+
+// Section tags
+const (
+	sectionMeta    = "META"
+	sectionChunks  = "CHNK"
+	sectionVectors = "VECS"
+	sectionHNSW    = "HNSW"
+	sectionIVF     = "IVFL"
+	sectionInt8    = "INT8"
+	sectionBinary  = "BIN1"
+	sectionPQ      = "PQCB"
+	sectionBM25    = "BM25"
+)
+
+// Errors returned when an index file cannot be decoded
+var (
+	ErrCorruptIndex       = errors.New("minirag: corrupt index file")
+	ErrChecksumMismatch   = errors.New("minirag: section checksum mismatch")
+	ErrUnsupportedVersion = errors.New("minirag: unsupported index format version")
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// indexMeta is the JSON payload of the META section
+type indexMeta struct {
+	Model      string    `json:"model"`
+	Dimension  int       `json:"dimension"`
+	Chunks     int       `json:"chunks"`
+	BuiltAt    time.Time `json:"built_at"`
+	SourceHash string    `json:"source_hash"`
+	SearchMode string    `json:"search_mode,omitempty"`
+}
+
+// SourceHash returns a hex SHA-256 over the path, heading and content of
+// every chunk, in order. It identifies the corpus an index was built from.
+func SourceHash(chunks []Chunk) string {
+	h := sha256.New()
+	var sep = []byte{0}
+	for _, c := range chunks {
+		h.Write([]byte(c.Path))
+		h.Write(sep)
+		h.Write([]byte(c.Heading))
+		h.Write(sep)
+		h.Write([]byte(c.Content))
+		h.Write(sep)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ChunkHash returns a hex SHA-256 over the path, heading and content of a
+// chunk. It identifies the chunk across rebuilds, wherever it moves within
+// its document.
+func ChunkHash(c Chunk) string {
+	h := sha256.New()
+	h.Write([]byte(c.Path))
+	h.Write([]byte{0})
+	h.Write([]byte(c.Heading))
+	h.Write([]byte{0})
+	h.Write([]byte(c.Content))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// formatWriter writes sections and keeps track of the output offset for padding
+type formatWriter struct {
+	w   *bufio.Writer
+	off int64
+	err error
+}
+
+func (fw *formatWriter) write(p []byte) {
+	if fw.err != nil {
+		return
+	}
+	n, err := fw.w.Write(p)
+	fw.off += int64(n)
+	fw.err = err
+}
+
+// section writes one section. fill must write exactly length bytes to its writer.
+func (fw *formatWriter) section(tag string, length int, fill func(w io.Writer) error) {
+	var hdr [sectionHeaderSize]byte
+	copy(hdr[0:4], tag)
+	binary.LittleEndian.PutUint64(hdr[8:16], uint64(length))
+	fw.write(hdr[:])
+	if fw.err != nil {
+		return
+	}
+
+	crc := crc32.New(crcTable)
+	cw := &countingWriter{w: io.MultiWriter(fw.w, crc)}
+	if err := fill(cw); err != nil {
+		fw.err = err
+		return
+	}
+	fw.off += cw.n
+	if cw.n != int64(length) {
+		fw.err = fmt.Errorf("section %s: wrote %d bytes, declared %d", tag, cw.n, length)
+		return
+	}
+
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], crc.Sum32())
+	fw.write(sum[:])
+	fw.write(make([]byte, padding(fw.off)))
+}
+
+// jsonSection writes v as a JSON section
+func (fw *formatWriter) jsonSection(tag string, v any) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		fw.err = fmt.Errorf("encoding section %s: %w", tag, err)
+		return
+	}
+	fw.bytesSection(tag, payload)
+}
+
+// bytesSection writes a section with a prepared payload
+func (fw *formatWriter) bytesSection(tag string, payload []byte) {
+	fw.section(tag, len(payload), func(w io.Writer) error {
+		_, err := w.Write(payload)
+		return err
+	})
+}
+
+// floatSection writes vectors as one contiguous block of float32 values
+func (fw *formatWriter) floatSection(tag string, vectors [][]float32, dim int) {
+	fw.section(tag, len(vectors)*dim*4, func(w io.Writer) error {
+		buf := make([]byte, dim*4)
+		for _, vec := range vectors {
+			for i, x := range vec {
+				binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(x))
+			}
+			if _, err := w.Write(buf); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// header writes the file header announcing count sections
+func (fw *formatWriter) header(count int) {
+	var hdr [headerSize]byte
+	copy(hdr[0:8], formatMagic)
+	binary.LittleEndian.PutUint32(hdr[8:12], FormatVersion)
+	binary.LittleEndian.PutUint32(hdr[12:16], uint32(count))
+	fw.write(hdr[:])
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// padding returns the number of zero bytes needed to align off
+func padding(off int64) int {
+	return int((sectionAlign - off%sectionAlign) % sectionAlign)
+}
+
+// encodeIndex writes the index in the current container format
+func encodeIndex(w io.Writer, index *VectorIndex) error {
+	builtAt := index.BuiltAt
+	if builtAt.IsZero() {
+		builtAt = time.Now()
+	}
+	sourceHash := index.SourceHash
+	if sourceHash == "" {
+		sourceHash = SourceHash(index.Chunks)
+	}
+
+	chunks := index.Chunks
+	if chunks == nil {
+		chunks = []Chunk{}
+	}
+
+	extras := optionalSections(index)
+	storeVectors := !index.dropsFloat32()
+
+	count := 2 + len(extras)
+	if storeVectors {
+		count++
+	}
+
+	fw := &formatWriter{w: bufio.NewWriter(w)}
+	fw.header(count)
+
+	fw.jsonSection(sectionMeta, indexMeta{
+		Model:      index.ModelInfo,
+		Dimension:  index.Dimension,
+		Chunks:     len(index.Chunks),
+		BuiltAt:    builtAt.UTC(),
+		SourceHash: sourceHash,
+		SearchMode: searchModeName(index.Mode),
+	})
+	fw.jsonSection(sectionChunks, chunks)
+	if storeVectors {
+		fw.floatSection(sectionVectors, index.Embeddings, index.Dimension)
+	}
+	for _, extra := range extras {
+		fw.bytesSection(extra.tag, extra.payload)
+	}
+
+	if fw.err != nil {
+		return fmt.Errorf("encoding index: %w", fw.err)
+	}
+	if err := fw.w.Flush(); err != nil {
+		return fmt.Errorf("encoding index: %w", err)
+	}
+	return nil
+}
+
+// dropsFloat32 reports whether the index is saved without its float32
+// embeddings, which are reconstructed from compressed codes on load
+func (index *VectorIndex) dropsFloat32() bool {
+	return index.Int8 != nil && index.Int8.DropFloat32 ||
+		index.PQ != nil && index.PQ.DropFloat32 ||
+		index.IVF != nil && index.IVF.PQ != nil && index.IVF.PQ.DropFloat32
+}
+
+// searchModeName returns the META name of a mode, empty for ModeAuto
+func searchModeName(m SearchMode) string {
+	if m == ModeAuto {
+		return ""
+	}
+	return m.String()
+}
+
+// rawSection is an encoded optional section
+type rawSection struct {
+	tag     string
+	payload []byte
+}
+
+// optionalSections encodes the search structures attached to index
+func optionalSections(index *VectorIndex) []rawSection {
+	var extras []rawSection
+	if index.HNSW != nil {
+		extras = append(extras, rawSection{sectionHNSW, index.HNSW.marshal()})
+	}
+	if index.IVF != nil {
+		extras = append(extras, rawSection{sectionIVF, index.IVF.marshal()})
+	}
+	if index.Int8 != nil {
+		extras = append(extras, rawSection{sectionInt8, index.Int8.marshal()})
+	}
+	if index.Binary != nil {
+		extras = append(extras, rawSection{sectionBinary, index.Binary.marshal()})
+	}
+	if index.PQ != nil {
+		extras = append(extras, rawSection{sectionPQ, index.PQ.marshal()})
+	}
+	if index.BM25 != nil {
+		extras = append(extras, rawSection{sectionBM25, index.BM25.marshal()})
+	}
+	return extras
+}
+
+// decodeIndex reads an index in either the container format or the legacy
+// gob format
+func decodeIndex(r io.Reader) (*VectorIndex, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(formatMagic))
+	if err != nil || string(magic) != formatMagic {
+		return decodeLegacyIndex(br)
+	}
+
+	var hdr [headerSize]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil {
+		return nil, fmt.Errorf("%w: reading header: %v", ErrCorruptIndex, err)
+	}
+	count, err := parseHeader(hdr[:])
+	if err != nil {
+		return nil, err
+	}
+
+	sections := make(map[string][]byte, count)
+	off := int64(headerSize)
+	for i := 0; i < count; i++ {
+		var sh [sectionHeaderSize]byte
+		if _, err := io.ReadFull(br, sh[:]); err != nil {
+			return nil, fmt.Errorf("%w: reading section %d header: %v", ErrCorruptIndex, i, err)
+		}
+		tag := string(sh[0:4])
+		length := binary.LittleEndian.Uint64(sh[8:16])
+		if length > math.MaxInt64-sectionAlign {
+			return nil, fmt.Errorf("%w: section %s too large", ErrCorruptIndex, tag)
+		}
+
+		// Read payload and trailing checksum together. The buffer grows as
+		// data arrives, so a corrupt length cannot force a huge allocation.
+		var buf bytes.Buffer
+		buf.Grow(int(min(length+4, 1<<26)))
+		if _, err := io.CopyN(&buf, br, int64(length)+4); err != nil {
+			return nil, fmt.Errorf("%w: reading section %s: %v", ErrCorruptIndex, tag, err)
+		}
+		payload, err := checkSection(tag, buf.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		sections[tag] = payload
+		off += sectionHeaderSize + int64(length) + 4
+
+		pad := padding(off)
+		if _, err := br.Discard(pad); err != nil {
+			return nil, fmt.Errorf("%w: reading section %s padding: %v", ErrCorruptIndex, tag, err)
+		}
+		off += int64(pad)
+	}
+
+	return decodeSections(sections)
+}
+
+// parseHeader validates a file header and returns the section count
+func parseHeader(hdr []byte) (int, error) {
+	if len(hdr) < headerSize || string(hdr[:len(formatMagic)]) != formatMagic {
+		return 0, fmt.Errorf("%w: bad magic", ErrCorruptIndex)
+	}
+	version := binary.LittleEndian.Uint32(hdr[8:12])
+	if version > FormatVersion {
+		return 0, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+	return int(binary.LittleEndian.Uint32(hdr[12:16])), nil
+}
+
+// checkSection verifies the trailing checksum of a payload and strips it
+func checkSection(tag string, data []byte) ([]byte, error) {
+	length := len(data) - 4
+	sum := binary.LittleEndian.Uint32(data[length:])
+	payload := data[:length:length]
+	if crc32.Checksum(payload, crcTable) != sum {
+		return nil, fmt.Errorf("%w: section %s", ErrChecksumMismatch, tag)
+	}
+	return payload, nil
+}
+
+// parseSections splits an in-memory container into its section payloads
+// without copying them
+func parseSections(data []byte) (map[string][]byte, error) {
+	count, err := parseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	sections := make(map[string][]byte, count)
+	off := uint64(headerSize)
+	size := uint64(len(data))
+	for i := 0; i < count; i++ {
+		if off > size || size-off < sectionHeaderSize {
+			return nil, fmt.Errorf("%w: section %d header past end of file", ErrCorruptIndex, i)
+		}
+		sh := data[off : off+sectionHeaderSize]
+		tag := string(sh[0:4])
+		length := binary.LittleEndian.Uint64(sh[8:16])
+		off += sectionHeaderSize
+
+		if length > size-off || size-off-length < 4 {
+			return nil, fmt.Errorf("%w: section %s past end of file", ErrCorruptIndex, tag)
+		}
+		payload, err := checkSection(tag, data[off:off+length+4])
+		if err != nil {
+			return nil, err
+		}
+		sections[tag] = payload
+		off += length + 4
+		off += uint64(padding(int64(off)))
+	}
+	return sections, nil
+}
+
+// decodeSections builds an index from the raw section payloads
+func decodeSections(sections map[string][]byte) (*VectorIndex, error) {
+	for _, tag := range []string{sectionMeta, sectionChunks} {
+		if _, ok := sections[tag]; !ok {
+			return nil, fmt.Errorf("%w: missing %s section", ErrCorruptIndex, tag)
+		}
+	}
+	_, hasVectors := sections[sectionVectors]
+
+	var meta indexMeta
+	if err := json.Unmarshal(sections[sectionMeta], &meta); err != nil {
+		return nil, fmt.Errorf("%w: decoding metadata: %v", ErrCorruptIndex, err)
+	}
+
+	var chunks []Chunk
+	if err := json.Unmarshal(sections[sectionChunks], &chunks); err != nil {
+		return nil, fmt.Errorf("%w: decoding chunks: %v", ErrCorruptIndex, err)
+	}
+	if len(chunks) != meta.Chunks {
+		return nil, fmt.Errorf("%w: metadata declares %d chunks, found %d", ErrCountMismatch, meta.Chunks, len(chunks))
+	}
+	if meta.Dimension < 0 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidDimension, meta.Dimension)
+	}
+
+	vecs := sections[sectionVectors]
+	if hasVectors && len(vecs) != meta.Chunks*meta.Dimension*4 {
+		return nil, fmt.Errorf("%w: vector section holds %d bytes, want %d", ErrDimensionMismatch, len(vecs), meta.Chunks*meta.Dimension*4)
+	}
+
+	mode := ModeAuto
+	if meta.SearchMode != "" {
+		// Modes added by newer versions fall back to automatic selection
+		mode, _ = ParseSearchMode(meta.SearchMode)
+	}
+
+	index := &VectorIndex{
+		Chunks:     chunks,
+		Dimension:  meta.Dimension,
+		ModelInfo:  meta.Model,
+		BuiltAt:    meta.BuiltAt,
+		SourceHash: meta.SourceHash,
+		Mode:       mode,
+	}
+
+	if payload, ok := sections[sectionInt8]; ok {
+		q, err := unmarshalInt8(payload, len(chunks), meta.Dimension)
+		if err != nil {
+			return nil, err
+		}
+		index.Int8 = q
+	}
+	if payload, ok := sections[sectionHNSW]; ok {
+		graph, err := unmarshalHNSW(payload, len(chunks))
+		if err != nil {
+			return nil, err
+		}
+		index.HNSW = graph
+	}
+	if payload, ok := sections[sectionIVF]; ok {
+		ivf, err := unmarshalIVF(payload, len(chunks), meta.Dimension)
+		if err != nil {
+			return nil, err
+		}
+		index.IVF = ivf
+	}
+	if payload, ok := sections[sectionBinary]; ok {
+		b, err := unmarshalBinary(payload, len(chunks), meta.Dimension)
+		if err != nil {
+			return nil, err
+		}
+		index.Binary = b
+	}
+	if payload, ok := sections[sectionPQ]; ok {
+		pq, err := unmarshalPQ(payload, len(chunks), meta.Dimension)
+		if err != nil {
+			return nil, err
+		}
+		index.PQ = pq
+	}
+	if payload, ok := sections[sectionBM25]; ok {
+		b, err := unmarshalBM25(payload, len(chunks))
+		if err != nil {
+			return nil, err
+		}
+		index.BM25 = b
+	}
+
+	if hasVectors {
+		index.Embeddings = vectorView(vecs, meta.Chunks, meta.Dimension)
+		return index, nil
+	}
+	switch {
+	case index.Int8 != nil:
+		index.Embeddings = index.Int8.dequantizeAll()
+	case index.PQ != nil:
+		index.Embeddings = index.PQ.decodeAll()
+	case index.IVF != nil && index.IVF.PQ != nil:
+		index.Embeddings = index.IVF.decodeAll()
+	default:
+		return nil, fmt.Errorf("%w: missing %s section", ErrCorruptIndex, sectionVectors)
+	}
+	// Rescoring against reconstructed embeddings would not be exact
+	if index.Int8 != nil {
+		index.Int8.dequantized = true
+	}
+	if index.PQ != nil {
+		index.PQ.dequantized = true
+	}
+	if index.IVF != nil && index.IVF.PQ != nil {
+		index.IVF.PQ.dequantized = true
+	}
+
+	return index, nil
+}
+
+// vectorView returns n vectors of dim values backed by data. On
+// little-endian hosts with 4 byte aligned data the vectors alias data
+// directly; otherwise the values are decoded into one new backing array.
+func vectorView(data []byte, n, dim int) [][]float32 {
+	return splitVectors(float32View(data), n, dim)
+}
+
+// float32View reinterprets data as little-endian float32 values, copying
+// only when the host or alignment requires it
+func float32View(data []byte) []float32 {
+	if len(data) == 0 {
+		return nil
+	}
+	if littleEndian && uintptr(unsafe.Pointer(&data[0]))%4 == 0 {
+		return unsafe.Slice((*float32)(unsafe.Pointer(&data[0])), len(data)/4)
+	}
+	flat := make([]float32, len(data)/4)
+	for i := range flat {
+		flat[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+	}
+	return flat
+}
+
+var littleEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}()
+
+// splitVectors slices a contiguous buffer into n vectors of dim values
+func splitVectors(flat []float32, n, dim int) [][]float32 {
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		vectors[i] = flat[i*dim : (i+1)*dim : (i+1)*dim]
+	}
+	return vectors
+}
+
+// decodeLegacyIndex reads the gob encoding of EmbeddingData used before the
+// container format existed
+func decodeLegacyIndex(r io.Reader) (*VectorIndex, error) {
+	var data EmbeddingData
+	if err := gob.NewDecoder(r).Decode(&data); err != nil {
+		return nil, fmt.Errorf("decoding index: %w", err)
+	}
+	return LoadIndex(&data), nil
+}
@@ -0,0 +1,162 @@
+package minirag
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFormatRoundTrip(t *testing.T) {
+	index := testIndex()
+
+	var buf bytes.Buffer
+	if err := WriteIndex(&buf, index); err != nil {
+		t.Fatalf("WriteIndex: %v", err)
+	}
+
+	data := buf.Bytes()
+	if string(data[:8]) != formatMagic {
+		t.Fatalf("Expected magic header, got %q", data[:8])
+	}
+
+	loaded, err := LoadIndexFromReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("LoadIndexFromReader: %v", err)
+	}
+
+	if loaded.SourceHash != index.SourceHash {
+		t.Errorf("Expected source hash %s, got %s", index.SourceHash, loaded.SourceHash)
+	}
+	if !loaded.BuiltAt.Equal(index.BuiltAt) {
+		t.Errorf("Expected build time %v, got %v", index.BuiltAt, loaded.BuiltAt)
+	}
+	if loaded.ModelInfo != index.ModelInfo || loaded.Dimension != index.Dimension {
+		t.Errorf("Metadata not round-tripped: %+v", loaded)
+	}
+	for i := range index.Embeddings {
+		for j := range index.Embeddings[i] {
+			if loaded.Embeddings[i][j] != index.Embeddings[i][j] {
+				t.Fatalf("Embedding %d differs: %v vs %v", i, loaded.Embeddings[i], index.Embeddings[i])
+			}
+		}
+	}
+}
+
+func TestFormatChunkFields(t *testing.T) {
+	index := testIndex()
+	index.Chunks[0] = Chunk{
+		ID: "guide.md#install/linux", Path: "guide.md", Content: "apt install", Heading: "Linux",
+		Offset: 40, EndOffset: 60, StartLine: 5, EndLine: 6,
+		HeadingPath: []string{"Install", "Linux"}, HeadingLevel: 2,
+		Title: "Guide", ContentHash: "abc", Tokens: 3,
+		Metadata: map[string]string{"lang": "en"},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteIndex(&buf, index); err != nil {
+		t.Fatalf("WriteIndex: %v", err)
+	}
+	loaded, err := LoadIndexFromReader(&buf)
+	if err != nil {
+		t.Fatalf("LoadIndexFromReader: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Chunks, index.Chunks) {
+		t.Errorf("Chunks not round-tripped:\n%+v\n%+v", index.Chunks, loaded.Chunks)
+	}
+	if got := loaded.Chunks[0].Breadcrumb(); got != "Install > Linux" {
+		t.Errorf("Expected breadcrumb 'Install > Linux', got '%s'", got)
+	}
+}
+
+func TestFormatLegacyGob(t *testing.T) {
+	index := testIndex()
+
+	var buf bytes.Buffer
+	data := EmbeddingData{
+		Chunks:     index.Chunks,
+		Embeddings: index.Embeddings,
+		ModelInfo:  index.ModelInfo,
+		Dimension:  index.Dimension,
+	}
+	if err := gob.NewEncoder(&buf).Encode(data); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadIndexFromReader(&buf)
+	if err != nil {
+		t.Fatalf("LoadIndexFromReader: %v", err)
+	}
+	if len(loaded.Chunks) != 2 || loaded.ModelInfo != "test-model" {
+		t.Errorf("Legacy index not loaded: %+v", loaded)
+	}
+}
+
+func TestFormatChecksumMismatch(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteIndex(&buf, testIndex()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Flip a bit in the last vector value
+	data := buf.Bytes()
+	vecs := bytes.LastIndex(data, []byte(sectionVectors))
+	data[vecs+sectionHeaderSize+20] ^= 0x01
+
+	if _, err := LoadIndexFromReader(bytes.NewReader(data)); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch, got %v", err)
+	}
+}
+
+func TestFormatUnsupportedVersion(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteIndex(&buf, testIndex()); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+	binary.LittleEndian.PutUint32(data[8:12], FormatVersion+1)
+
+	if _, err := LoadIndexFromReader(bytes.NewReader(data)); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("Expected ErrUnsupportedVersion, got %v", err)
+	}
+}
+
+func TestFormatTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteIndex(&buf, testIndex()); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()[:buf.Len()-10]
+	if _, err := LoadIndexFromReader(bytes.NewReader(data)); !errors.Is(err, ErrCorruptIndex) {
+		t.Errorf("Expected ErrCorruptIndex, got %v", err)
+	}
+}
+
+func TestFormatSkipsUnknownSections(t *testing.T) {
+	index := testIndex()
+
+	var buf bytes.Buffer
+	fw := &formatWriter{w: bufio.NewWriter(&buf)}
+	fw.header(4)
+	fw.jsonSection("XTRA", map[string]string{"future": "section"})
+	fw.jsonSection(sectionMeta, indexMeta{Model: "m", Dimension: 3, Chunks: 2})
+	fw.jsonSection(sectionChunks, index.Chunks)
+	fw.floatSection(sectionVectors, index.Embeddings, 3)
+	if fw.err != nil {
+		t.Fatal(fw.err)
+	}
+	fw.w.Flush()
+
+	loaded, err := LoadIndexFromReader(&buf)
+	if err != nil {
+		t.Fatalf("LoadIndexFromReader: %v", err)
+	}
+	if len(loaded.Chunks) != 2 {
+		t.Errorf("Expected 2 chunks, got %d", len(loaded.Chunks))
+	}
+}
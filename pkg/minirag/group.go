@@ -0,0 +1,139 @@
+package minirag
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Aggregation selects how a document is scored from its matching chunks
+type Aggregation uint8
+
+const (
+	// AggregateMax scores a document by its best chunk
+	AggregateMax Aggregation = iota
+	// AggregateSum adds the scores of all matching chunks, favouring
+	// documents that cover the query in several sections
+	AggregateSum
+	// AggregateMean averages the scores of the TopN best chunks
+	AggregateMean
+)
+
+var aggregationNames = []string{"max", "sum", "mean"}
+
+// String returns the aggregation name as accepted by ParseAggregation
+func (a Aggregation) String() string {
+	if int(a) < len(aggregationNames) {
+		return aggregationNames[a]
+	}
+	return fmt.Sprintf("Aggregation(%d)", a)
+}
+
+// ParseAggregation returns the aggregation with the given name
+func ParseAggregation(name string) (Aggregation, error) {
+	for i, n := range aggregationNames {
+		if n == name {
+			return Aggregation(i), nil
+		}
+	}
+	return AggregateMax, fmt.Errorf("unknown aggregation %q", name)
+}
+
+// GroupOptions configures GroupByDocument
+type GroupOptions struct {
+	Aggregation  Aggregation
+	TopN         int // Chunks averaged by AggregateMean; 0 picks 3
+	MaxChunks    int // Hits kept per document; 0 keeps all
+	MaxDocuments int // Documents returned; 0 returns all
+}
+
+// DocumentResult is one document in a grouped search result
+type DocumentResult struct {
+	Path  string
+	Score float32        // Aggregated score of the document's hits
+	Hits  []SearchResult // Matching chunks, best first
+	Total int            // Matching chunks before MaxChunks was applied
+}
+
+// GroupByDocument collapses results by Chunk.Path. Documents are ordered by
+// aggregated score, best first, then by path. Scores are only aggregated
+// over the chunks present in results, so search with a larger topK than
+// the number of documents wanted.
+func GroupByDocument(results []SearchResult, opts GroupOptions) []DocumentResult {
+	topN := opts.TopN
+	if topN <= 0 {
+		topN = 3
+	}
+
+	var docs []DocumentResult
+	byPath := make(map[string]int)
+	for _, r := range results {
+		i, ok := byPath[r.Chunk.Path]
+		if !ok {
+			i = len(docs)
+			byPath[r.Chunk.Path] = i
+			docs = append(docs, DocumentResult{Path: r.Chunk.Path})
+		}
+		docs[i].Hits = append(docs[i].Hits, r)
+	}
+
+	for i := range docs {
+		d := &docs[i]
+		sort.SliceStable(d.Hits, func(a, b int) bool { return d.Hits[a].Score > d.Hits[b].Score })
+		d.Total = len(d.Hits)
+
+		switch opts.Aggregation {
+		case AggregateSum:
+			for _, h := range d.Hits {
+				d.Score += h.Score
+			}
+		case AggregateMean:
+			n := min(topN, len(d.Hits))
+			for _, h := range d.Hits[:n] {
+				d.Score += h.Score
+			}
+			d.Score /= float32(n)
+		default:
+			d.Score = d.Hits[0].Score
+		}
+
+		if opts.MaxChunks > 0 && len(d.Hits) > opts.MaxChunks {
+			d.Hits = d.Hits[:opts.MaxChunks]
+		}
+	}
+
+	sort.Slice(docs, func(a, b int) bool {
+		if docs[a].Score != docs[b].Score {
+			return docs[a].Score > docs[b].Score
+		}
+		return docs[a].Path < docs[b].Path
+	})
+	if opts.MaxDocuments > 0 && len(docs) > opts.MaxDocuments {
+		docs = docs[:opts.MaxDocuments]
+	}
+	return docs
+}
+
+// DocumentSearchOptions configures SearchDocuments
+type DocumentSearchOptions struct {
+	SearchOptions // TopK is the number of documents
+	GroupOptions  // MaxDocuments is taken from TopK
+
+	// Candidates is how many chunks are searched before grouping;
+	// 0 picks max(50, 10*TopK)
+	Candidates int
+}
+
+// SearchDocuments runs a similarity search and groups the matching chunks
+// by document, answering "which files are relevant" rather than "which
+// chunks"
+func SearchDocuments(index *VectorIndex, queryEmbedding []float32, opts DocumentSearchOptions) []DocumentResult {
+	search := opts.SearchOptions
+	search.TopK = opts.Candidates
+	if search.TopK <= 0 && opts.TopK > 0 {
+		search.TopK = max(50, 10*opts.TopK)
+	}
+
+	group := opts.GroupOptions
+	group.MaxDocuments = opts.TopK
+	return GroupByDocument(SearchWithOptions(index, queryEmbedding, search), group)
+}
@@ -0,0 +1,88 @@
+package minirag
+
+import "testing"
+
+func groupResults() []SearchResult {
+	return []SearchResult{
+		{Chunk: Chunk{Path: "a.md", Heading: "A1"}, Score: 0.9},
+		{Chunk: Chunk{Path: "b.md", Heading: "B1"}, Score: 0.8},
+		{Chunk: Chunk{Path: "b.md", Heading: "B2"}, Score: 0.7},
+		{Chunk: Chunk{Path: "b.md", Heading: "B3"}, Score: 0.6},
+		{Chunk: Chunk{Path: "c.md", Heading: "C1"}, Score: 0.5},
+		{Chunk: Chunk{Path: "a.md", Heading: "A2"}, Score: 0.05},
+	}
+}
+
+func TestGroupByDocument(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  GroupOptions
+		order []string
+		score float32 // of the first document
+	}{
+		{"max", GroupOptions{Aggregation: AggregateMax}, []string{"a.md", "b.md", "c.md"}, 0.9},
+		{"sum", GroupOptions{Aggregation: AggregateSum}, []string{"b.md", "a.md", "c.md"}, 2.1},
+		{"mean of top 2", GroupOptions{Aggregation: AggregateMean, TopN: 2}, []string{"b.md", "c.md", "a.md"}, 0.75},
+		{"max documents", GroupOptions{MaxDocuments: 2}, []string{"a.md", "b.md"}, 0.9},
+	}
+	for _, tt := range tests {
+		docs := GroupByDocument(groupResults(), tt.opts)
+		if len(docs) != len(tt.order) {
+			t.Fatalf("%s: expected %d documents, got %d", tt.name, len(tt.order), len(docs))
+		}
+		for i, path := range tt.order {
+			if docs[i].Path != path {
+				t.Errorf("%s: document %d: expected %s, got %s", tt.name, i, path, docs[i].Path)
+			}
+		}
+		if diff := docs[0].Score - tt.score; diff > 1e-6 || diff < -1e-6 {
+			t.Errorf("%s: expected score %.2f, got %.2f", tt.name, tt.score, docs[0].Score)
+		}
+	}
+}
+
+func TestGroupByDocumentMaxChunks(t *testing.T) {
+	docs := GroupByDocument(groupResults(), GroupOptions{Aggregation: AggregateSum, MaxChunks: 2})
+
+	b := docs[0]
+	if b.Path != "b.md" || len(b.Hits) != 2 || b.Total != 3 {
+		t.Fatalf("Expected b.md with 2 of 3 hits, got %s with %d of %d", b.Path, len(b.Hits), b.Total)
+	}
+	if b.Hits[0].Chunk.Heading != "B1" || b.Hits[1].Chunk.Heading != "B2" {
+		t.Errorf("Expected the best hits kept, got %s and %s", b.Hits[0].Chunk.Heading, b.Hits[1].Chunk.Heading)
+	}
+	// The cap does not change the aggregate
+	if b.Score < 2.09 {
+		t.Errorf("Expected the sum over all 3 hits, got %.2f", b.Score)
+	}
+}
+
+func TestSearchDocuments(t *testing.T) {
+	index := randomIndex(500, 16, 31)
+
+	docs := SearchDocuments(index, index.Embeddings[0], DocumentSearchOptions{
+		SearchOptions: SearchOptions{TopK: 5, Threshold: -1},
+		GroupOptions:  GroupOptions{MaxChunks: 2},
+	})
+	if len(docs) != 5 {
+		t.Fatalf("Expected 5 documents, got %d", len(docs))
+	}
+	if docs[0].Path != index.Chunks[0].Path {
+		t.Errorf("Expected the query's own document first, got %s", docs[0].Path)
+	}
+	seen := make(map[string]bool)
+	for _, d := range docs {
+		if seen[d.Path] {
+			t.Errorf("Document %s returned twice", d.Path)
+		}
+		seen[d.Path] = true
+		if len(d.Hits) == 0 || len(d.Hits) > 2 {
+			t.Errorf("%s: expected 1-2 hits, got %d", d.Path, len(d.Hits))
+		}
+		for _, h := range d.Hits {
+			if h.Chunk.Path != d.Path {
+				t.Errorf("%s: hit from %s", d.Path, h.Chunk.Path)
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package minirag
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// hit is a scored reference to a chunk by its position in the index
+type hit struct {
+	idx   int
+	score float32
+}
+
+// minHeap keeps the lowest-scoring hit on top. Bounded to k entries it
+// holds the k best hits seen so far.
+type minHeap []hit
+
+func (h minHeap) Len() int           { return len(h) }
+func (h minHeap) Less(i, j int) bool { return h[i].score < h[j].score }
+func (h minHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *minHeap) Push(x any)        { *h = append(*h, x.(hit)) }
+func (h *minHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// maxHeap keeps the highest-scoring hit on top
+type maxHeap []hit
+
+func (h maxHeap) Len() int           { return len(h) }
+func (h maxHeap) Less(i, j int) bool { return h[i].score > h[j].score }
+func (h maxHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *maxHeap) Push(x any)        { *h = append(*h, x.(hit)) }
+func (h *maxHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// sortHits orders hits by score descending, breaking ties by index so that
+// results are deterministic
+func sortHits(hits []hit) {
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		return hits[i].idx < hits[j].idx
+	})
+}
+
+// toResults converts hits into search results
+func toResults(index *VectorIndex, hits []hit) []SearchResult {
+	results := make([]SearchResult, len(hits))
+	for i, h := range hits {
+		results[i] = SearchResult{
+			Chunk: index.Chunks[h.idx],
+			Score: h.score,
+		}
+	}
+	return results
+}
+
+// bestHits collects the k best hits offered to it. With k <= 0 every hit is kept.
+type bestHits struct {
+	k int
+	h minHeap
+}
+
+func newBestHits(k int) *bestHits {
+	c := &bestHits{k: k}
+	if k > 0 {
+		c.h = make(minHeap, 0, k+1)
+	}
+	return c
+}
+
+// push offers a hit to the collector
+func (c *bestHits) push(x hit) {
+	if c.k <= 0 {
+		c.h = append(c.h, x)
+		return
+	}
+	if len(c.h) < c.k {
+		heap.Push(&c.h, x)
+		return
+	}
+	if x.score > c.h[0].score {
+		c.h[0] = x
+		heap.Fix(&c.h, 0)
+	}
+}
+
+// hits returns the collected hits, best first
+func (c *bestHits) hits() []hit {
+	hits := []hit(c.h)
+	sortHits(hits)
+	return hits
+}
@@ -0,0 +1,372 @@
+package minirag
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+)
+
+// HNSWConfig holds the tuning parameters of an HNSW graph
+type HNSWConfig struct {
+	M              int    // Max neighbours per node on upper layers (2*M on layer 0)
+	EfConstruction int    // Candidate list size while building; higher = better graph, slower build
+	EfSearch       int    // Candidate list size while searching; higher = better recall, slower search
+	Seed           uint64 // Seed for level assignment, for reproducible builds
+}
+
+// DefaultHNSWConfig returns parameters that give high recall for typical
+// embedding corpora
+func DefaultHNSWConfig() HNSWConfig {
+	return HNSWConfig{
+		M:              16,
+		EfConstruction: 200,
+		EfSearch:       64,
+	}
+}
+
+// HNSW is a Hierarchical Navigable Small World graph over the embeddings of
+// a VectorIndex. Node i is the embedding index.Embeddings[i]. When attached
+// to VectorIndex.HNSW, Search uses the graph instead of a full scan.
+type HNSW struct {
+	M              int
+	EfConstruction int
+	EfSearch       int // May be changed between searches
+
+	entry    int         // Entry point node, -1 when empty
+	maxLevel int         // Level of the entry point
+	links    [][][]int32 // links[node][level] lists the node's neighbours
+	rng      *rand.Rand
+}
+
+// BuildHNSW builds an HNSW graph over all embeddings of index. Assign the
+// result to index.HNSW to enable approximate search.
+func BuildHNSW(index *VectorIndex, cfg HNSWConfig) *HNSW {
+	def := DefaultHNSWConfig()
+	if cfg.M < 2 {
+		cfg.M = def.M
+	}
+	if cfg.EfConstruction <= 0 {
+		cfg.EfConstruction = def.EfConstruction
+	}
+	if cfg.EfSearch <= 0 {
+		cfg.EfSearch = def.EfSearch
+	}
+
+	g := &HNSW{
+		M:              cfg.M,
+		EfConstruction: cfg.EfConstruction,
+		EfSearch:       cfg.EfSearch,
+		entry:          -1,
+		links:          make([][][]int32, 0, len(index.Embeddings)),
+		rng:            rand.New(rand.NewPCG(cfg.Seed, 0x9e3779b97f4a7c15)),
+	}
+	for i := range index.Embeddings {
+		g.insert(index.Embeddings, i)
+	}
+	return g
+}
+
+// Len returns the number of nodes in the graph
+func (g *HNSW) Len() int {
+	return len(g.links)
+}
+
+// clone returns a deep copy of the graph, which can be extended
+// independently
+func (g *HNSW) clone() *HNSW {
+	c := *g
+	c.rng = nil
+	c.links = make([][][]int32, len(g.links))
+	for i, levels := range g.links {
+		c.links[i] = make([][]int32, len(levels))
+		for l, links := range levels {
+			c.links[i][l] = slices.Clone(links)
+		}
+	}
+	return &c
+}
+
+// maxConn returns the neighbour limit for a layer
+func (g *HNSW) maxConn(level int) int {
+	if level == 0 {
+		return 2 * g.M
+	}
+	return g.M
+}
+
+// randomLevel draws a node level from the exponential distribution with
+// normalisation factor 1/ln(M)
+func (g *HNSW) randomLevel() int {
+	if g.rng == nil {
+		g.rng = rand.New(rand.NewPCG(uint64(len(g.links)), 0x9e3779b97f4a7c15))
+	}
+	level := int(-math.Log(1-g.rng.Float64()) / math.Log(float64(g.M)))
+	return min(level, 32)
+}
+
+// insert adds node id, whose vector is vectors[id], to the graph. Nodes
+// must be inserted in order.
+func (g *HNSW) insert(vectors [][]float32, id int) {
+	level := g.randomLevel()
+	g.links = append(g.links, make([][]int32, level+1))
+	q := vectors[id]
+
+	if g.entry < 0 {
+		g.entry = id
+		g.maxLevel = level
+		return
+	}
+
+	// Greedy descent through the layers above the new node's level
+	ep := []hit{{idx: g.entry, score: CosineSimilarity(q, vectors[g.entry])}}
+	for l := g.maxLevel; l > level; l-- {
+		ep = g.searchLayer(vectors, q, nil, ep, 1, l)
+	}
+
+	for l := min(level, g.maxLevel); l >= 0; l-- {
+		candidates := g.searchLayer(vectors, q, nil, ep, g.EfConstruction, l)
+		neighbours := g.selectNeighbours(vectors, candidates, g.M)
+
+		g.links[id][l] = make([]int32, len(neighbours))
+		for i, n := range neighbours {
+			g.links[id][l][i] = int32(n.idx)
+			g.connect(vectors, n.idx, id, l)
+		}
+		ep = candidates
+	}
+
+	if level > g.maxLevel {
+		g.entry = id
+		g.maxLevel = level
+	}
+}
+
+// connect adds a link from node to neighbour on level, pruning the node's
+// neighbour list if it grows past the limit
+func (g *HNSW) connect(vectors [][]float32, node, neighbour, level int) {
+	links := append(g.links[node][level], int32(neighbour))
+	if len(links) <= g.maxConn(level) {
+		g.links[node][level] = links
+		return
+	}
+
+	v := vectors[node]
+	candidates := make([]hit, len(links))
+	for i, n := range links {
+		candidates[i] = hit{idx: int(n), score: CosineSimilarity(v, vectors[n])}
+	}
+	kept := g.selectNeighbours(vectors, candidates, g.maxConn(level))
+
+	links = links[:0]
+	for _, n := range kept {
+		links = append(links, int32(n.idx))
+	}
+	g.links[node][level] = links
+}
+
+// selectNeighbours picks up to m neighbours from candidates using the
+// diversity heuristic from the HNSW paper: a candidate is kept only if it is
+// closer to the query than to every neighbour already kept. Remaining slots
+// are filled with the best pruned candidates.
+func (g *HNSW) selectNeighbours(vectors [][]float32, candidates []hit, m int) []hit {
+	sortHits(candidates)
+	if len(candidates) <= m {
+		return candidates
+	}
+
+	selected := make([]hit, 0, m)
+	var pruned []hit
+	for _, c := range candidates {
+		if len(selected) >= m {
+			break
+		}
+		keep := true
+		for _, s := range selected {
+			if CosineSimilarity(vectors[c.idx], vectors[s.idx]) > c.score {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			selected = append(selected, c)
+		} else {
+			pruned = append(pruned, c)
+		}
+	}
+	for _, c := range pruned {
+		if len(selected) >= m {
+			break
+		}
+		selected = append(selected, c)
+	}
+	return selected
+}
+
+// searchLayer runs a best-first search on one layer starting from entry
+// points and returns up to ef of the closest nodes found, unordered. Nodes
+// rejected by mask are traversed but never returned.
+func (g *HNSW) searchLayer(vectors [][]float32, q []float32, mask chunkMask, entries []hit, ef, level int) []hit {
+	visited := getVisited(len(g.links))
+	defer putVisited(visited)
+
+	candidates := make(maxHeap, 0, ef)
+	results := make(minHeap, 0, ef+1)
+	for _, e := range entries {
+		if visited.testAndSet(e.idx) {
+			continue
+		}
+		heap.Push(&candidates, e)
+		if mask.has(e.idx) {
+			heap.Push(&results, e)
+			if results.Len() > ef {
+				heap.Pop(&results)
+			}
+		}
+	}
+
+	for candidates.Len() > 0 {
+		c := heap.Pop(&candidates).(hit)
+		if results.Len() >= ef && c.score < results[0].score {
+			break
+		}
+		if level >= len(g.links[c.idx]) {
+			continue
+		}
+		for _, n := range g.links[c.idx][level] {
+			if visited.testAndSet(int(n)) {
+				continue
+			}
+			score := CosineSimilarity(q, vectors[n])
+			if results.Len() < ef || score > results[0].score {
+				h := hit{idx: int(n), score: score}
+				heap.Push(&candidates, h)
+				if mask.has(h.idx) {
+					heap.Push(&results, h)
+					if results.Len() > ef {
+						heap.Pop(&results)
+					}
+				}
+			}
+		}
+	}
+	return results
+}
+
+// search returns the approximate topK nearest nodes accepted by mask with a
+// score of at least threshold, best first
+func (g *HNSW) search(vectors [][]float32, q []float32, mask chunkMask, topK int, threshold float32) []hit {
+	if g.entry < 0 {
+		return nil
+	}
+
+	ep := []hit{{idx: g.entry, score: CosineSimilarity(q, vectors[g.entry])}}
+	for l := g.maxLevel; l > 0; l-- {
+		ep = g.searchLayer(vectors, q, nil, ep, 1, l)
+	}
+	found := g.searchLayer(vectors, q, mask, ep, max(g.EfSearch, topK), 0)
+
+	hits := found[:0]
+	for _, h := range found {
+		if h.score >= threshold {
+			hits = append(hits, h)
+		}
+	}
+	sortHits(hits)
+	if len(hits) > topK {
+		hits = hits[:topK]
+	}
+	return hits
+}
+
+// visitedSet is a bitset of graph nodes, pooled between searches
+type visitedSet []uint64
+
+var visitedPool sync.Pool
+
+func getVisited(n int) visitedSet {
+	words := (n + 63) / 64
+	if v, ok := visitedPool.Get().(visitedSet); ok && cap(v) >= words {
+		v = v[:words]
+		clear(v)
+		return v
+	}
+	return make(visitedSet, words)
+}
+
+func putVisited(v visitedSet) {
+	visitedPool.Put(v)
+}
+
+// testAndSet marks i as visited and reports whether it already was
+func (v visitedSet) testAndSet(i int) bool {
+	w, b := i/64, uint64(1)<<(i%64)
+	seen := v[w]&b != 0
+	v[w] |= b
+	return seen
+}
+
+// marshal encodes the graph as the payload of an HNSW section:
+//
+//	M, EfConstruction, EfSearch, entry, maxLevel, node count: uint32
+//	per node: level count uint8, then per level: neighbour count uint32, neighbours int32...
+func (g *HNSW) marshal() []byte {
+	var w binWriter
+	w.u32(uint32(g.M))
+	w.u32(uint32(g.EfConstruction))
+	w.u32(uint32(g.EfSearch))
+	w.i32(int32(g.entry))
+	w.u32(uint32(g.maxLevel))
+	w.u32(uint32(len(g.links)))
+	for _, levels := range g.links {
+		w.u8(uint8(len(levels)))
+		for _, links := range levels {
+			w.u32(uint32(len(links)))
+			for _, n := range links {
+				w.i32(n)
+			}
+		}
+	}
+	return w.buf
+}
+
+// unmarshalHNSW decodes an HNSW section for an index of n chunks
+func unmarshalHNSW(data []byte, n int) (*HNSW, error) {
+	r := &binReader{buf: data}
+	g := &HNSW{
+		M:              int(r.u32()),
+		EfConstruction: int(r.u32()),
+		EfSearch:       int(r.u32()),
+		entry:          int(r.i32()),
+		maxLevel:       int(r.u32()),
+	}
+	nodes := r.count(1)
+	if r.err == nil && nodes != n {
+		return nil, fmt.Errorf("%w: HNSW graph has %d nodes, index has %d chunks", ErrCountMismatch, nodes, n)
+	}
+
+	g.links = make([][][]int32, nodes)
+	for i := range g.links {
+		levels := make([][]int32, r.u8())
+		for l := range levels {
+			links := make([]int32, r.count(4))
+			for j := range links {
+				links[j] = r.i32()
+				if links[j] < 0 || int(links[j]) >= nodes {
+					r.err = fmt.Errorf("%w: HNSW link out of range", ErrCorruptIndex)
+				}
+			}
+			levels[l] = links
+		}
+		g.links[i] = levels
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if g.entry >= nodes || (nodes > 0 && (g.entry < 0 || g.maxLevel >= len(g.links[g.entry]))) {
+		return nil, fmt.Errorf("%w: bad HNSW entry point", ErrCorruptIndex)
+	}
+	return g, nil
+}
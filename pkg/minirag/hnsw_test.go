@@ -0,0 +1,158 @@
+package minirag
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"testing"
+)
+
+// randomIndex builds an index of n random unit vectors. The vectors are
+// drawn around a number of cluster centres, which resembles real embedding
+// corpora more than uniform noise.
+func randomIndex(n, dim int, seed uint64) *VectorIndex {
+	rng := rand.New(rand.NewPCG(seed, 1))
+	centres := make([][]float32, 32)
+	for i := range centres {
+		centres[i] = randomVector(rng, dim)
+	}
+
+	chunks := make([]Chunk, n)
+	embeddings := make([][]float32, n)
+	for i := range embeddings {
+		c := centres[rng.IntN(len(centres))]
+		v := randomVector(rng, dim)
+		for j := range v {
+			v[j] = c[j] + 0.5*v[j]
+		}
+		unitNormalize(v)
+		embeddings[i] = v
+		chunks[i] = Chunk{Path: fmt.Sprintf("doc%d.md", i%100), Content: fmt.Sprintf("chunk %d", i), Offset: i}
+	}
+	return BuildIndex(chunks, embeddings, dim)
+}
+
+func randomVector(rng *rand.Rand, dim int) []float32 {
+	v := make([]float32, dim)
+	for i := range v {
+		v[i] = float32(rng.NormFloat64())
+	}
+	unitNormalize(v)
+	return v
+}
+
+// recall returns the fraction of the exact top-k results that approx found
+func recall(exact, approx []SearchResult) float64 {
+	if len(exact) == 0 {
+		return 1
+	}
+	found := make(map[int]bool)
+	for _, r := range approx {
+		found[r.Chunk.Offset] = true
+	}
+	hits := 0
+	for _, r := range exact {
+		if found[r.Chunk.Offset] {
+			hits++
+		}
+	}
+	return float64(hits) / float64(len(exact))
+}
+
+// meanRecall compares search on index against a brute-force scan. Queries
+// are perturbed copies of indexed vectors, like real queries near a topic.
+func meanRecall(t *testing.T, index *VectorIndex, queries int, topK int) float64 {
+	t.Helper()
+	rng := rand.New(rand.NewPCG(99, 2))
+	exactIndex := BuildIndex(index.Chunks, index.Embeddings, index.Dimension)
+
+	var total float64
+	for range queries {
+		q := randomVector(rng, index.Dimension)
+		base := index.Embeddings[rng.IntN(len(index.Embeddings))]
+		for j := range q {
+			q[j] = base[j] + 0.5*q[j]
+		}
+		unitNormalize(q)
+		exact := Search(exactIndex, q, topK, -1)
+		approx := Search(index, q, topK, -1)
+		if len(approx) > topK {
+			t.Fatalf("Expected at most %d results, got %d", topK, len(approx))
+		}
+		total += recall(exact, approx)
+	}
+	return total / float64(queries)
+}
+
+func TestHNSWRecall(t *testing.T) {
+	index := randomIndex(3000, 32, 1)
+	index.HNSW = BuildHNSW(index, HNSWConfig{M: 16, EfConstruction: 100, EfSearch: 64, Seed: 7})
+
+	r := meanRecall(t, index, 100, 10)
+	t.Logf("HNSW recall@10: %.3f", r)
+	if r < 0.95 {
+		t.Errorf("Expected recall@10 >= 0.95, got %.3f", r)
+	}
+}
+
+func TestHNSWEfSearchTradeoff(t *testing.T) {
+	index := randomIndex(3000, 32, 2)
+	index.HNSW = BuildHNSW(index, HNSWConfig{M: 4, EfConstruction: 20, EfSearch: 10, Seed: 7})
+	low := meanRecall(t, index, 50, 10)
+
+	index.HNSW.EfSearch = 200
+	high := meanRecall(t, index, 50, 10)
+
+	t.Logf("recall@10 efSearch=10: %.3f, efSearch=200: %.3f", low, high)
+	if high < low {
+		t.Errorf("Expected higher efSearch to improve recall: %.3f < %.3f", high, low)
+	}
+}
+
+func TestHNSWThreshold(t *testing.T) {
+	index := randomIndex(500, 16, 3)
+	index.HNSW = BuildHNSW(index, DefaultHNSWConfig())
+
+	q := index.Embeddings[42]
+	results := Search(index, q, 10, 0.999)
+	if len(results) == 0 || results[0].Chunk.Offset != 42 {
+		t.Fatalf("Expected exact match first, got %+v", results)
+	}
+	for _, r := range results {
+		if r.Score < 0.999 {
+			t.Errorf("Result below threshold: %.4f", r.Score)
+		}
+	}
+}
+
+func TestHNSWPersistence(t *testing.T) {
+	index := randomIndex(500, 16, 4)
+	index.HNSW = BuildHNSW(index, HNSWConfig{M: 8, EfConstruction: 50, EfSearch: 40})
+
+	var buf bytes.Buffer
+	if err := WriteIndex(&buf, index); err != nil {
+		t.Fatalf("WriteIndex: %v", err)
+	}
+	loaded, err := LoadIndexFromBytes(buf.Bytes())
+	if err != nil {
+		t.Fatalf("LoadIndexFromBytes: %v", err)
+	}
+	if loaded.HNSW == nil {
+		t.Fatal("Expected HNSW graph to be loaded")
+	}
+	if loaded.HNSW.M != 8 || loaded.HNSW.EfSearch != 40 {
+		t.Errorf("Parameters not round-tripped: M=%d efSearch=%d", loaded.HNSW.M, loaded.HNSW.EfSearch)
+	}
+
+	q := index.Embeddings[7]
+	want := Search(index, q, 5, 0)
+	got := Search(loaded, q, 5, 0)
+	if len(want) != len(got) {
+		t.Fatalf("Expected %d results, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if want[i].Chunk.Offset != got[i].Chunk.Offset {
+			t.Errorf("Result %d differs: %d vs %d", i, want[i].Chunk.Offset, got[i].Chunk.Offset)
+		}
+	}
+}
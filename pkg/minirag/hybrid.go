@@ -0,0 +1,127 @@
+package minirag
+
+// LexicalSearch ranks chunks by the BM25 score of query against their
+// content and headings. Threshold is a minimum BM25 score rather than a
+// similarity. It returns nil if the index has no BM25 section.
+func LexicalSearch(index *VectorIndex, query string, opts SearchOptions) []SearchResult {
+	if index.BM25 == nil {
+		return nil
+	}
+	mask, matches := index.filterMask(opts.Filter)
+	if matches == 0 {
+		return nil
+	}
+	return toResults(index, index.BM25.search(query, mask, opts.TopK, opts.Threshold))
+}
+
+// Fusion selects how HybridSearch combines the lexical and vector rankings
+type Fusion uint8
+
+const (
+	// FusionRRF scores each chunk by reciprocal rank fusion: the sum of
+	// weight/(RRFK+rank) over the rankings it appears in
+	FusionRRF Fusion = iota
+	// FusionWeighted blends the scores of both rankings after scaling each
+	// to [0, 1] by its best and worst candidate
+	FusionWeighted
+)
+
+// HybridOptions configures HybridSearch
+type HybridOptions struct {
+	SearchOptions // Threshold applies to the vector similarity of candidates
+
+	Fusion        Fusion
+	VectorWeight  float32 // Weight of the vector ranking; if both weights are 0 each is 1
+	LexicalWeight float32 // Weight of the BM25 ranking
+	RRFK          int     // Rank constant for FusionRRF; 0 picks 60
+	Candidates    int     // Hits taken from each ranking before fusion; 0 picks max(50, 4*TopK)
+}
+
+// VectorOptions returns the options of the vector search HybridSearch runs
+// for candidates, e.g. for VectorIndex.ResolveMode
+func (opts HybridOptions) VectorOptions() SearchOptions {
+	vector := opts.SearchOptions
+	vector.TopK = candidateCount(opts.Candidates, opts.TopK)
+	return vector
+}
+
+// candidateCount resolves a Candidates option for topK results: 0 picks
+// max(50, 4*topK), or every match when topK is unlimited too
+func candidateCount(candidates, topK int) int {
+	if candidates <= 0 && topK > 0 {
+		candidates = max(50, 4*topK)
+	}
+	return candidates
+}
+
+// HybridSearch fuses BM25 and vector search results, so that verbatim
+// identifiers found lexically rank alongside semantic matches. Scores of the
+// returned results are fused scores, not similarities. Without a BM25
+// section, or with a query embedding of the wrong dimension, only the
+// other ranking is used.
+func HybridSearch(index *VectorIndex, query string, queryEmbedding []float32, opts HybridOptions) []SearchResult {
+	mask, matches := index.filterMask(opts.Filter)
+	if matches == 0 {
+		return nil
+	}
+
+	candidates := candidateCount(opts.Candidates, opts.TopK)
+	vectorWeight, lexicalWeight := opts.VectorWeight, opts.LexicalWeight
+	if vectorWeight == 0 && lexicalWeight == 0 {
+		vectorWeight, lexicalWeight = 1, 1
+	}
+
+	var vector, lexical []hit
+	if len(queryEmbedding) == index.Dimension && vectorWeight > 0 {
+		vector = index.vectorHits(queryEmbedding, mask, matches, candidates, opts.Threshold)
+	}
+	if index.BM25 != nil && lexicalWeight > 0 {
+		lexical = index.BM25.search(query, mask, candidates, 0)
+	}
+
+	scores := make(map[int]float32, len(vector)+len(lexical))
+	switch opts.Fusion {
+	case FusionWeighted:
+		blendScores(scores, vector, vectorWeight)
+		blendScores(scores, lexical, lexicalWeight)
+	default:
+		k := opts.RRFK
+		if k <= 0 {
+			k = 60
+		}
+		rankScores(scores, vector, vectorWeight, k)
+		rankScores(scores, lexical, lexicalWeight, k)
+	}
+
+	hits := make([]hit, 0, len(scores))
+	for idx, score := range scores {
+		hits = append(hits, hit{idx: idx, score: score})
+	}
+	sortHits(hits)
+	if opts.TopK > 0 && len(hits) > opts.TopK {
+		hits = hits[:opts.TopK]
+	}
+	return toResults(index, hits)
+}
+
+// rankScores adds the reciprocal rank fusion contribution of a ranking
+func rankScores(scores map[int]float32, ranking []hit, weight float32, k int) {
+	for rank, h := range ranking {
+		scores[h.idx] += weight / float32(k+rank+1)
+	}
+}
+
+// blendScores adds the min-max scaled scores of a ranking
+func blendScores(scores map[int]float32, ranking []hit, weight float32) {
+	if len(ranking) == 0 {
+		return
+	}
+	best, worst := ranking[0].score, ranking[len(ranking)-1].score
+	for _, h := range ranking {
+		scaled := float32(1)
+		if best > worst {
+			scaled = (h.score - worst) / (best - worst)
+		}
+		scores[h.idx] += weight * scaled
+	}
+}
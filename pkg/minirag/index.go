@@ -0,0 +1,136 @@
+package minirag
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Errors returned when an index fails validation. They are wrapped with
+// details about the offending entry, so use errors.Is to test for them.
+var (
+	ErrCountMismatch     = errors.New("minirag: chunk and embedding counts differ")
+	ErrDimensionMismatch = errors.New("minirag: embedding dimension mismatch")
+	ErrInvalidDimension  = errors.New("minirag: invalid index dimension")
+)
+
+// BuildIndex creates a VectorIndex from chunks and their embeddings
+// The embeddings must be in the same order as the chunks
+func BuildIndex(chunks []Chunk, embeddings [][]float32, dimension int) *VectorIndex {
+	return &VectorIndex{
+		Chunks:     chunks,
+		Embeddings: embeddings,
+		Dimension:  dimension,
+		BuiltAt:    time.Now().UTC(),
+		SourceHash: SourceHash(chunks),
+	}
+}
+
+// Validate checks that the index is internally consistent: one embedding per
+// chunk, and every embedding of the declared dimension
+func (idx *VectorIndex) Validate() error {
+	if len(idx.Chunks) != len(idx.Embeddings) {
+		return fmt.Errorf("%w: %d chunks, %d embeddings", ErrCountMismatch, len(idx.Chunks), len(idx.Embeddings))
+	}
+	if idx.Dimension <= 0 {
+		if len(idx.Embeddings) == 0 && idx.Dimension == 0 {
+			return nil
+		}
+		return fmt.Errorf("%w: %d", ErrInvalidDimension, idx.Dimension)
+	}
+	for i, emb := range idx.Embeddings {
+		if len(emb) != idx.Dimension {
+			return fmt.Errorf("%w: embedding %d has %d values, want %d", ErrDimensionMismatch, i, len(emb), idx.Dimension)
+		}
+	}
+	if idx.HNSW != nil && idx.HNSW.Len() != len(idx.Chunks) {
+		return fmt.Errorf("%w: HNSW graph has %d nodes, index has %d chunks", ErrCountMismatch, idx.HNSW.Len(), len(idx.Chunks))
+	}
+	if idx.IVF != nil && idx.IVF.Len() != len(idx.Chunks) {
+		return fmt.Errorf("%w: IVF lists hold %d chunks, index has %d", ErrCountMismatch, idx.IVF.Len(), len(idx.Chunks))
+	}
+	if idx.Int8 != nil && idx.Int8.Len() != len(idx.Chunks) {
+		return fmt.Errorf("%w: %d int8 vectors, index has %d chunks", ErrCountMismatch, idx.Int8.Len(), len(idx.Chunks))
+	}
+	if idx.Binary != nil && idx.Binary.Len() != len(idx.Chunks) {
+		return fmt.Errorf("%w: %d binary vectors, index has %d chunks", ErrCountMismatch, idx.Binary.Len(), len(idx.Chunks))
+	}
+	if idx.PQ != nil && idx.PQ.Len() != len(idx.Chunks) {
+		return fmt.Errorf("%w: %d PQ codes, index has %d chunks", ErrCountMismatch, idx.PQ.Len(), len(idx.Chunks))
+	}
+	if idx.IVF != nil && idx.IVF.PQ != nil && idx.IVF.PQ.Len() != len(idx.Chunks) {
+		return fmt.Errorf("%w: %d IVF-PQ codes, index has %d chunks", ErrCountMismatch, idx.IVF.PQ.Len(), len(idx.Chunks))
+	}
+	if idx.BM25 != nil && idx.BM25.Len() != len(idx.Chunks) {
+		return fmt.Errorf("%w: BM25 index has %d chunks, index has %d", ErrCountMismatch, idx.BM25.Len(), len(idx.Chunks))
+	}
+	return nil
+}
+
+// SaveIndex writes the index to path, replacing any existing file
+// The file is written to a temporary name first and renamed into place
+func SaveIndex(index *VectorIndex, path string) error {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("creating index directory: %w", err)
+		}
+	}
+
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("creating index file: %w", err)
+	}
+
+	if err := WriteIndex(file, index); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("closing index file: %w", err)
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// WriteIndex validates the index and serializes it to w in the container
+// format described in format.go
+func WriteIndex(w io.Writer, index *VectorIndex) error {
+	if err := index.Validate(); err != nil {
+		return err
+	}
+	if index.deleted > 0 {
+		return ErrDeletedChunks
+	}
+	return encodeIndex(w, index)
+}
+
+// LoadIndexFromFile reads and validates an index written by SaveIndex
+func LoadIndexFromFile(path string) (*VectorIndex, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening index: %w", err)
+	}
+	defer file.Close()
+
+	return LoadIndexFromReader(file)
+}
+
+// LoadIndexFromReader reads and validates an index from r
+// Both the container format and legacy gob files are accepted
+func LoadIndexFromReader(r io.Reader) (*VectorIndex, error) {
+	index, err := decodeIndex(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := index.Validate(); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
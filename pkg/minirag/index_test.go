@@ -0,0 +1,98 @@
+package minirag
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func testIndex() *VectorIndex {
+	chunks := []Chunk{
+		{Path: "a.md", Content: "alpha", Heading: "A", Offset: 0},
+		{Path: "b.md", Content: "beta", Heading: "B", Offset: 10},
+	}
+	embeddings := [][]float32{
+		{1, 0, 0},
+		{0, 1, 0},
+	}
+	index := BuildIndex(chunks, embeddings, 3)
+	index.ModelInfo = "test-model"
+	return index
+}
+
+func TestSaveAndLoadIndex(t *testing.T) {
+	index := testIndex()
+	path := filepath.Join(t.TempDir(), "sub", "index.gob")
+
+	if err := SaveIndex(index, path); err != nil {
+		t.Fatalf("SaveIndex: %v", err)
+	}
+
+	loaded, err := LoadIndexFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadIndexFromFile: %v", err)
+	}
+
+	if loaded.ModelInfo != "test-model" {
+		t.Errorf("Expected model 'test-model', got '%s'", loaded.ModelInfo)
+	}
+	if loaded.Dimension != 3 {
+		t.Errorf("Expected dimension 3, got %d", loaded.Dimension)
+	}
+	if len(loaded.Chunks) != 2 || loaded.Chunks[1].Heading != "B" {
+		t.Errorf("Chunks not round-tripped: %+v", loaded.Chunks)
+	}
+	if loaded.Embeddings[1][1] != 1 {
+		t.Errorf("Embeddings not round-tripped: %v", loaded.Embeddings)
+	}
+}
+
+func TestLoadIndexValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*VectorIndex)
+		want   error
+	}{
+		{"count mismatch", func(idx *VectorIndex) { idx.Embeddings = idx.Embeddings[:1] }, ErrCountMismatch},
+		{"dimension mismatch", func(idx *VectorIndex) { idx.Embeddings[1] = []float32{1, 2} }, ErrDimensionMismatch},
+		{"invalid dimension", func(idx *VectorIndex) { idx.Dimension = -1 }, ErrInvalidDimension},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := testIndex()
+			tt.modify(index)
+
+			if err := WriteIndex(&bytes.Buffer{}, index); !errors.Is(err, tt.want) {
+				t.Errorf("WriteIndex: expected %v, got %v", tt.want, err)
+			}
+			if err := index.Validate(); !errors.Is(err, tt.want) {
+				t.Errorf("Validate: expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoadIndexFromReader_Garbage(t *testing.T) {
+	if _, err := LoadIndexFromReader(bytes.NewReader([]byte("not an index"))); err == nil {
+		t.Error("Expected error decoding garbage input")
+	}
+}
+
+func TestLoadIndexFromReader_Invalid(t *testing.T) {
+	var buf bytes.Buffer
+	data := EmbeddingData{
+		Chunks:     []Chunk{{Path: "a.md"}},
+		Embeddings: [][]float32{{1, 0}},
+		Dimension:  3,
+	}
+	if err := gob.NewEncoder(&buf).Encode(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadIndexFromReader(&buf); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch, got %v", err)
+	}
+}
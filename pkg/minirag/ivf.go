@@ -0,0 +1,407 @@
+package minirag
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"runtime"
+	"sync"
+)
+
+// IVFConfig holds the parameters of an inverted file index
+type IVFConfig struct {
+	Lists      int    // Number of k-means clusters; 0 picks sqrt(chunks)
+	NProbe     int    // Clusters scanned per query; 0 picks Lists/16 (at least 1)
+	Iterations int    // k-means iterations; 0 picks 20
+	SampleSize int    // Vectors used to train centroids; 0 picks 256 per list
+	Seed       uint64 // Seed for centroid initialisation and sampling
+}
+
+// IVF is an inverted file index: embeddings are partitioned into clusters
+// by k-means, and a query only scans the NProbe clusters whose centroids are
+// closest to it. When attached to VectorIndex.IVF, Search uses it instead of
+// a full scan.
+type IVF struct {
+	NProbe    int         // May be changed between searches
+	Centroids [][]float32 // Unit-length cluster centroids
+	PQ        *PQCodes    // Optional PQ codes of the residuals to each centroid, see BuildIVFPQ
+	lists     [][]int32   // lists[c] holds the chunk indices assigned to centroid c
+}
+
+// BuildIVF clusters the embeddings of index and returns the resulting
+// inverted file. Assign it to index.IVF to enable partitioned search.
+func BuildIVF(index *VectorIndex, cfg IVFConfig) *IVF {
+	n := len(index.Embeddings)
+	if cfg.Lists <= 0 {
+		cfg.Lists = max(1, int(math.Sqrt(float64(n))))
+	}
+	cfg.Lists = max(1, min(cfg.Lists, n))
+	if cfg.NProbe <= 0 {
+		cfg.NProbe = max(1, cfg.Lists/16)
+	}
+	if cfg.Iterations <= 0 {
+		cfg.Iterations = 20
+	}
+	if cfg.SampleSize <= 0 {
+		cfg.SampleSize = 256 * cfg.Lists
+	}
+
+	rng := rand.New(rand.NewPCG(cfg.Seed, 0x2545f4914f6cdd1d))
+	centroids := trainKMeans(sampleVectors(index.Embeddings, cfg.SampleSize, rng), cfg.Lists, cfg.Iterations, rng)
+
+	ivf := &IVF{
+		NProbe:    cfg.NProbe,
+		Centroids: centroids,
+		lists:     make([][]int32, len(centroids)),
+	}
+	for i, c := range assignVectors(index.Embeddings, centroids, nearestCentroid) {
+		ivf.lists[c] = append(ivf.lists[c], int32(i))
+	}
+	return ivf
+}
+
+// BuildIVFPQ builds an inverted file whose lists are scanned with product
+// quantization (IVF-PQ): each embedding is stored as the PQ code of its
+// residual to the cluster centroid
+func BuildIVFPQ(index *VectorIndex, ivfCfg IVFConfig, pqCfg PQConfig) *IVF {
+	ivf := BuildIVF(index, ivfCfg)
+
+	residuals := make([][]float32, len(index.Embeddings))
+	for c, list := range ivf.lists {
+		for _, i := range list {
+			r := make([]float32, index.Dimension)
+			for j, x := range index.Embeddings[i] {
+				r[j] = x - ivf.Centroids[c][j]
+			}
+			residuals[i] = r
+		}
+	}
+	ivf.PQ = trainPQ(residuals, index.Embeddings, index.Dimension, pqCfg)
+	return ivf
+}
+
+// decodeAll reconstructs every vector of an IVF-PQ index as its centroid
+// plus its decoded residual
+func (ivf *IVF) decodeAll() [][]float32 {
+	vectors := ivf.PQ.decodeAll()
+	for c, list := range ivf.lists {
+		for _, i := range list {
+			for j, x := range ivf.Centroids[c] {
+				vectors[i][j] += x
+			}
+		}
+	}
+	return vectors
+}
+
+// Len returns the number of chunks in the inverted lists
+func (ivf *IVF) Len() int {
+	n := 0
+	for _, l := range ivf.lists {
+		n += len(l)
+	}
+	return n
+}
+
+// search scans the chunks accepted by mask in the NProbe closest clusters
+// and returns the topK hits with a score of at least threshold, best first
+func (ivf *IVF) search(vectors [][]float32, q []float32, mask chunkMask, topK int, threshold float32) []hit {
+	if ivf.PQ != nil {
+		return ivf.searchPQ(vectors, q, mask, topK, threshold)
+	}
+
+	results := newBestHits(topK)
+	for _, c := range ivf.probe(q) {
+		for _, i := range ivf.lists[c] {
+			if !mask.has(int(i)) {
+				continue
+			}
+			score := CosineSimilarity(q, vectors[i])
+			if score >= threshold {
+				results.push(hit{idx: int(i), score: score})
+			}
+		}
+	}
+	return results.hits()
+}
+
+// searchPQ scans the probed lists using the residual PQ codes. Since
+// <q, x> = <q, centroid> + <q, residual>, one lookup table serves all lists.
+func (ivf *IVF) searchPQ(vectors [][]float32, q []float32, mask chunkMask, topK int, threshold float32) []hit {
+	pq := ivf.PQ
+	qnorm := l2norm(q)
+	if qnorm == 0 {
+		return nil
+	}
+	t := pq.table(q)
+
+	rescore := pq.Rescore > 0 && !pq.dequantized && topK > 0
+	candidates, minScore := topK, threshold
+	if rescore {
+		candidates, minScore = topK*pq.Rescore, float32(math.Inf(-1))
+	}
+
+	results := newBestHits(candidates)
+	for _, c := range ivf.probe(q) {
+		base := dot(q, ivf.Centroids[c])
+		for _, i := range ivf.lists[c] {
+			norm := pq.norms[i]
+			if norm == 0 || !mask.has(int(i)) {
+				continue
+			}
+			if score := (base + pq.innerProduct(t, int(i))) / (qnorm * norm); score >= minScore {
+				results.push(hit{idx: int(i), score: score})
+			}
+		}
+	}
+	if !rescore {
+		return results.hits()
+	}
+	return rescoreHits(vectors, q, results.hits(), topK, threshold)
+}
+
+// probe returns the NProbe clusters closest to q, closest first
+func (ivf *IVF) probe(q []float32) []int {
+	nearest := newBestHits(max(1, ivf.NProbe))
+	for c, centroid := range ivf.Centroids {
+		nearest.push(hit{idx: c, score: CosineSimilarity(q, centroid)})
+	}
+	hits := nearest.hits()
+	clusters := make([]int, len(hits))
+	for i, h := range hits {
+		clusters[i] = h.idx
+	}
+	return clusters
+}
+
+// sampleVectors returns up to n vectors chosen at random without replacement
+func sampleVectors(vectors [][]float32, n int, rng *rand.Rand) [][]float32 {
+	if n >= len(vectors) {
+		return vectors
+	}
+	sample := make([][]float32, n)
+	for i, j := range rng.Perm(len(vectors))[:n] {
+		sample[i] = vectors[j]
+	}
+	return sample
+}
+
+// trainKMeans runs spherical k-means (cosine similarity, unit-length
+// centroids) with k-means++ initialisation and returns the centroids
+func trainKMeans(vectors [][]float32, k, iterations int, rng *rand.Rand) [][]float32 {
+	k = min(k, len(vectors))
+	if k == 0 {
+		return nil
+	}
+	dim := len(vectors[0])
+	centroids := initCentroids(vectors, k, rng)
+
+	for range iterations {
+		assign := assignVectors(vectors, centroids, nearestCentroid)
+
+		sums := make([][]float64, k)
+		counts := make([]int, k)
+		for c := range sums {
+			sums[c] = make([]float64, dim)
+		}
+		for i, c := range assign {
+			counts[c]++
+			for j, x := range vectors[i] {
+				sums[c][j] += float64(x)
+			}
+		}
+
+		changed := false
+		for c := range centroids {
+			if counts[c] == 0 {
+				// Re-seed empty clusters with a random vector
+				centroids[c] = unitCopy(vectors[rng.IntN(len(vectors))])
+				changed = true
+				continue
+			}
+			next := make([]float32, dim)
+			for j, s := range sums[c] {
+				next[j] = float32(s)
+			}
+			unitNormalize(next)
+			if CosineSimilarity(next, centroids[c]) < 1-1e-6 {
+				changed = true
+			}
+			centroids[c] = next
+		}
+		if !changed {
+			break
+		}
+	}
+	return centroids
+}
+
+// initCentroids picks k starting centroids with k-means++: each new centroid
+// is drawn with probability proportional to its distance from the closest
+// centroid chosen so far
+func initCentroids(vectors [][]float32, k int, rng *rand.Rand) [][]float32 {
+	centroids := [][]float32{unitCopy(vectors[rng.IntN(len(vectors))])}
+	dist := make([]float64, len(vectors))
+	for i := range dist {
+		dist[i] = math.Inf(1)
+	}
+
+	for len(centroids) < k {
+		last := centroids[len(centroids)-1]
+		var total float64
+		for i, v := range vectors {
+			d := float64(1 - CosineSimilarity(v, last))
+			if d < dist[i] {
+				dist[i] = d
+			}
+			total += dist[i]
+		}
+
+		next := rng.IntN(len(vectors))
+		if total > 0 {
+			target := rng.Float64() * total
+			for i, d := range dist {
+				target -= d
+				if target <= 0 {
+					next = i
+					break
+				}
+			}
+		}
+		centroids = append(centroids, unitCopy(vectors[next]))
+	}
+	return centroids
+}
+
+// assignVectors returns the index of the closest centroid for every vector,
+// as chosen by nearest, spreading the work across GOMAXPROCS goroutines
+func assignVectors(vectors, centroids [][]float32, nearest func([]float32, [][]float32) int) []int {
+	assign := make([]int, len(vectors))
+	if len(vectors) == 0 {
+		return assign
+	}
+	workers := runtime.GOMAXPROCS(0)
+	per := (len(vectors) + workers - 1) / workers
+
+	var wg sync.WaitGroup
+	for start := 0; start < len(vectors); start += per {
+		end := min(start+per, len(vectors))
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				assign[i] = nearest(vectors[i], centroids)
+			}
+		}(start, end)
+	}
+	wg.Wait()
+	return assign
+}
+
+// nearestCentroid returns the index of the centroid most similar to v
+func nearestCentroid(v []float32, centroids [][]float32) int {
+	best, bestScore := 0, float32(math.Inf(-1))
+	for c, centroid := range centroids {
+		if score := CosineSimilarity(v, centroid); score > bestScore {
+			best, bestScore = c, score
+		}
+	}
+	return best
+}
+
+// unitCopy returns a unit-length copy of v
+func unitCopy(v []float32) []float32 {
+	c := make([]float32, len(v))
+	copy(c, v)
+	unitNormalize(c)
+	return c
+}
+
+// unitNormalize scales v to unit length in place
+func unitNormalize(v []float32) {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return
+	}
+	inv := float32(1 / math.Sqrt(sum))
+	for i := range v {
+		v[i] *= inv
+	}
+}
+
+// marshal encodes the inverted file as the payload of an IVF section:
+//
+//	NProbe, list count, dimension: uint32
+//	centroids: list count * dimension float32
+//	per list: chunk count uint32, chunk indices int32...
+//	has PQ uint8, then the PQ codes as in (*PQCodes).marshal if set
+func (ivf *IVF) marshal() []byte {
+	var w binWriter
+	dim := 0
+	if len(ivf.Centroids) > 0 {
+		dim = len(ivf.Centroids[0])
+	}
+	w.u32(uint32(ivf.NProbe))
+	w.u32(uint32(len(ivf.Centroids)))
+	w.u32(uint32(dim))
+	for _, c := range ivf.Centroids {
+		w.f32s(c)
+	}
+	for _, l := range ivf.lists {
+		w.u32(uint32(len(l)))
+		for _, i := range l {
+			w.i32(i)
+		}
+	}
+	if ivf.PQ != nil {
+		w.u8(1)
+		ivf.PQ.marshalTo(&w)
+	} else {
+		w.u8(0)
+	}
+	return w.buf
+}
+
+// unmarshalIVF decodes an IVF section for an index of n chunks and the
+// given dimension
+func unmarshalIVF(data []byte, n, dim int) (*IVF, error) {
+	r := &binReader{buf: data}
+	ivf := &IVF{NProbe: int(r.u32())}
+	lists := r.count(4)
+	if d := int(r.u32()); r.err == nil && lists > 0 && d != dim {
+		return nil, fmt.Errorf("%w: IVF centroids have dimension %d, index has %d", ErrDimensionMismatch, d, dim)
+	}
+
+	ivf.Centroids = make([][]float32, lists)
+	for c := range ivf.Centroids {
+		ivf.Centroids[c] = r.f32s(dim)
+	}
+	ivf.lists = make([][]int32, lists)
+	for c := range ivf.lists {
+		l := make([]int32, r.count(4))
+		for j := range l {
+			l[j] = r.i32()
+			if l[j] < 0 || int(l[j]) >= n {
+				r.err = fmt.Errorf("%w: IVF list entry out of range", ErrCorruptIndex)
+			}
+		}
+		ivf.lists[c] = l
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if ivf.Len() != n {
+		return nil, fmt.Errorf("%w: IVF lists hold %d chunks, index has %d", ErrCountMismatch, ivf.Len(), n)
+	}
+	if r.u8() == 1 {
+		pq, err := unmarshalPQFrom(r, n, dim)
+		if err != nil {
+			return nil, err
+		}
+		ivf.PQ = pq
+	}
+	return ivf, r.err
+}
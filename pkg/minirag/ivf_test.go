@@ -0,0 +1,82 @@
+package minirag
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestIVFRecall(t *testing.T) {
+	index := randomIndex(3000, 32, 5)
+	index.IVF = BuildIVF(index, IVFConfig{Lists: 32, NProbe: 8, Seed: 1})
+
+	if index.IVF.Len() != 3000 {
+		t.Fatalf("Expected 3000 chunks in lists, got %d", index.IVF.Len())
+	}
+
+	r := meanRecall(t, index, 100, 10)
+	t.Logf("IVF recall@10 nprobe=8: %.3f", r)
+	if r < 0.9 {
+		t.Errorf("Expected recall@10 >= 0.9, got %.3f", r)
+	}
+}
+
+func TestIVFNProbeTradeoff(t *testing.T) {
+	index := randomIndex(2000, 32, 6)
+	index.IVF = BuildIVF(index, IVFConfig{Lists: 40, NProbe: 1, Seed: 1})
+	low := meanRecall(t, index, 50, 10)
+
+	// Probing every list is an exhaustive search
+	index.IVF.NProbe = 40
+	full := meanRecall(t, index, 50, 10)
+
+	t.Logf("recall@10 nprobe=1: %.3f, nprobe=40: %.3f", low, full)
+	if full != 1 {
+		t.Errorf("Expected perfect recall when probing all lists, got %.3f", full)
+	}
+	if low > full {
+		t.Errorf("Expected more probes to improve recall: %.3f > %.3f", low, full)
+	}
+}
+
+func TestIVFDefaults(t *testing.T) {
+	index := randomIndex(400, 8, 7)
+	ivf := BuildIVF(index, IVFConfig{})
+
+	if len(ivf.Centroids) != 20 {
+		t.Errorf("Expected sqrt(400)=20 lists, got %d", len(ivf.Centroids))
+	}
+	if ivf.NProbe != 1 {
+		t.Errorf("Expected NProbe 1, got %d", ivf.NProbe)
+	}
+
+	empty := BuildIVF(BuildIndex(nil, nil, 8), IVFConfig{})
+	if empty.Len() != 0 {
+		t.Errorf("Expected empty IVF, got %d entries", empty.Len())
+	}
+}
+
+func TestIVFPersistence(t *testing.T) {
+	index := randomIndex(500, 16, 8)
+	index.IVF = BuildIVF(index, IVFConfig{Lists: 10, NProbe: 3})
+
+	var buf bytes.Buffer
+	if err := WriteIndex(&buf, index); err != nil {
+		t.Fatalf("WriteIndex: %v", err)
+	}
+	loaded, err := LoadIndexFromReader(&buf)
+	if err != nil {
+		t.Fatalf("LoadIndexFromReader: %v", err)
+	}
+	if loaded.IVF == nil || loaded.IVF.NProbe != 3 || len(loaded.IVF.Centroids) != 10 {
+		t.Fatalf("IVF not round-tripped: %+v", loaded.IVF)
+	}
+
+	q := index.Embeddings[3]
+	want := Search(index, q, 5, 0)
+	got := Search(loaded, q, 5, 0)
+	for i := range want {
+		if want[i].Chunk.Offset != got[i].Chunk.Offset {
+			t.Errorf("Result %d differs: %d vs %d", i, want[i].Chunk.Offset, got[i].Chunk.Offset)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package minirag
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// LoadIndexFromBytes decodes an index held in memory, such as a slice from
+// //go:embed. For container-format data the embeddings are views into data
+// rather than copies, so data must stay alive and unmodified for as long as
+// the index is used, and the embeddings must be treated as read-only.
+// Legacy gob data is decoded into fresh memory.
+func LoadIndexFromBytes(data []byte) (*VectorIndex, error) {
+	if !bytes.HasPrefix(data, []byte(formatMagic)) {
+		return LoadIndexFromReader(bytes.NewReader(data))
+	}
+
+	sections, err := parseSections(data)
+	if err != nil {
+		return nil, err
+	}
+	index, err := decodeSections(sections)
+	if err != nil {
+		return nil, err
+	}
+	if err := index.Validate(); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// MappedIndex is a VectorIndex whose embeddings live in a memory-mapped
+// index file. The embeddings are read-only and become invalid after Close.
+type MappedIndex struct {
+	*VectorIndex
+	data  []byte
+	unmap func([]byte) error
+}
+
+// OpenIndexFile memory-maps the index file at path and decodes it without
+// copying the vectors. Chunks are still decoded onto the heap. On platforms
+// without mmap support the file is read into memory instead.
+func OpenIndexFile(path string) (*MappedIndex, error) {
+	data, unmap, err := mapFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("mapping index: %w", err)
+	}
+
+	index, err := LoadIndexFromBytes(data)
+	if err != nil {
+		unmap(data)
+		return nil, err
+	}
+
+	return &MappedIndex{VectorIndex: index, data: data, unmap: unmap}, nil
+}
+
+// Close releases the mapping. The index must not be used afterwards.
+func (m *MappedIndex) Close() error {
+	if m.data == nil {
+		return nil
+	}
+	err := m.unmap(m.data)
+	m.data = nil
+	m.VectorIndex = nil
+	return err
+}
+
+// readFile is the fallback used when a file cannot be mapped
+func readFile(path string) ([]byte, func([]byte) error, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func([]byte) error { return nil }, nil
+}
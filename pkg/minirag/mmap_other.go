@@ -0,0 +1,8 @@
+//go:build !unix
+
+package minirag
+
+// mapFile reads path into memory on platforms without mmap support
+func mapFile(path string) ([]byte, func([]byte) error, error) {
+	return readFile(path)
+}
@@ -0,0 +1,73 @@
+package minirag
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadIndexFromBytes_ZeroCopy(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteIndex(&buf, testIndex()); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	index, err := LoadIndexFromBytes(data)
+	if err != nil {
+		t.Fatalf("LoadIndexFromBytes: %v", err)
+	}
+	if index.Embeddings[1][1] != 1 {
+		t.Fatalf("Unexpected embedding: %v", index.Embeddings[1])
+	}
+
+	if !littleEndian {
+		t.Skip("vectors are copied on big-endian hosts")
+	}
+
+	// The vectors must alias the input rather than copy it
+	for i := range data {
+		data[i] = 0
+	}
+	if index.Embeddings[1][1] != 0 {
+		t.Error("Expected embeddings to be views into the input buffer")
+	}
+}
+
+func TestLoadIndexFromBytes_Corrupt(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteIndex(&buf, testIndex()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range []int{headerSize + 3, headerSize + sectionHeaderSize + 5, buf.Len() - 20} {
+		if _, err := LoadIndexFromBytes(buf.Bytes()[:n]); !errors.Is(err, ErrCorruptIndex) {
+			t.Errorf("Truncated to %d bytes: expected ErrCorruptIndex, got %v", n, err)
+		}
+	}
+}
+
+func TestOpenIndexFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.gob")
+	if err := SaveIndex(testIndex(), path); err != nil {
+		t.Fatal(err)
+	}
+
+	mapped, err := OpenIndexFile(path)
+	if err != nil {
+		t.Fatalf("OpenIndexFile: %v", err)
+	}
+
+	results := Search(mapped.VectorIndex, []float32{0, 1, 0}, 1, 0)
+	if len(results) != 1 || results[0].Chunk.Path != "b.md" {
+		t.Errorf("Unexpected results: %+v", results)
+	}
+
+	if err := mapped.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if err := mapped.Close(); err != nil {
+		t.Errorf("Second Close: %v", err)
+	}
+}
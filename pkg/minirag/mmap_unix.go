@@ -0,0 +1,33 @@
+//go:build unix
+
+package minirag
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps path read-only into memory
+func mapFile(path string) ([]byte, func([]byte) error, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	size := info.Size()
+	if size == 0 || size != int64(int(size)) {
+		// Empty files cannot be mapped; oversized ones cannot be addressed
+		return readFile(path)
+	}
+
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return readFile(path)
+	}
+	return data, syscall.Munmap, nil
+}
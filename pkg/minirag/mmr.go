@@ -0,0 +1,90 @@
+package minirag
+
+import "math"
+
+// MMROptions configures MMRSearch
+type MMROptions struct {
+	SearchOptions
+
+	// Lambda trades relevance against diversity, from 1 (similarity to the
+	// query alone) to 0 (dissimilarity to results already picked alone).
+	// nil picks 0.5.
+	Lambda *float32
+
+	// Candidates is how many of the most relevant chunks are considered;
+	// 0 picks max(50, 4*TopK)
+	Candidates int
+}
+
+// VectorOptions returns the options of the vector search MMRSearch runs for
+// candidates, e.g. for VectorIndex.ResolveMode
+func (opts MMROptions) VectorOptions() SearchOptions {
+	vector := opts.SearchOptions
+	vector.TopK = candidateCount(opts.Candidates, opts.TopK)
+	return vector
+}
+
+// MMRSearch returns results picked by Maximal Marginal Relevance, so that
+// near-duplicate chunks do not crowd out the rest. Each step picks the
+// candidate maximising
+//
+//	Lambda*sim(query, c) - (1-Lambda)*max sim(c, picked)
+//
+// Results are in pick order and keep their similarity to the query as score.
+func MMRSearch(index *VectorIndex, queryEmbedding []float32, opts MMROptions) []SearchResult {
+	if len(queryEmbedding) != index.Dimension {
+		return nil
+	}
+	mask, matches := index.filterMask(opts.Filter)
+	if matches == 0 {
+		return nil
+	}
+
+	lambda := float32(0.5)
+	if opts.Lambda != nil {
+		lambda = *opts.Lambda
+	}
+	candidates := candidateCount(opts.Candidates, opts.TopK)
+	hits := index.vectorHits(queryEmbedding, mask, matches, candidates, opts.Threshold)
+	return toResults(index, diversify(index.Embeddings, hits, opts.TopK, lambda))
+}
+
+// diversify reorders candidates by MMR and keeps the first topK
+func diversify(vectors [][]float32, candidates []hit, topK int, lambda float32) []hit {
+	if topK <= 0 || topK > len(candidates) {
+		topK = len(candidates)
+	}
+
+	// redundancy[i] is the highest similarity of candidate i to any pick
+	redundancy := make([]float32, len(candidates))
+	for i := range redundancy {
+		redundancy[i] = float32(math.Inf(-1))
+	}
+	picked := make([]bool, len(candidates))
+	selected := make([]hit, 0, topK)
+	for len(selected) < topK {
+		best, bestScore := -1, float32(math.Inf(-1))
+		for i, c := range candidates {
+			if picked[i] {
+				continue
+			}
+			score := lambda * c.score
+			if len(selected) > 0 {
+				score -= (1 - lambda) * redundancy[i]
+			}
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+
+		picked[best] = true
+		selected = append(selected, candidates[best])
+		pick := vectors[candidates[best].idx]
+		for i, c := range candidates {
+			if !picked[i] {
+				redundancy[i] = max(redundancy[i], CosineSimilarity(pick, vectors[c.idx]))
+			}
+		}
+	}
+	return selected
+}
@@ -0,0 +1,98 @@
+package minirag
+
+import "testing"
+
+// duplicateIndex has three copies of the chunk closest to the query and two
+// distinct, slightly less relevant chunks
+func duplicateIndex() *VectorIndex {
+	chunks := []Chunk{
+		{Path: "linux.md", Content: "install steps"},
+		{Path: "mac.md", Content: "install steps"},
+		{Path: "windows.md", Content: "install steps"},
+		{Path: "config.md", Content: "configuration"},
+		{Path: "usage.md", Content: "usage"},
+	}
+	embeddings := [][]float32{
+		{1, 0, 0},
+		{1, 0, 0.01},
+		{1, 0.01, 0},
+		{0.7, 0.7, 0},
+		{0.7, 0, 0.7},
+	}
+	return BuildIndex(chunks, embeddings, 3)
+}
+
+func TestMMRSearchDiversifies(t *testing.T) {
+	index := duplicateIndex()
+	query := []float32{1, 0.1, 0.1}
+
+	plain := Search(index, query, 3, 0)
+	if plain[2].Chunk.Content != "install steps" {
+		t.Fatalf("Expected plain search to return three copies, got %+v", plain)
+	}
+
+	results := MMRSearch(index, query, MMROptions{SearchOptions: SearchOptions{TopK: 3}, Lambda: ptr(float32(0.5))})
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	if results[0].Chunk.Path != plain[0].Chunk.Path {
+		t.Errorf("Expected the most relevant chunk first, got %s", results[0].Chunk.Path)
+	}
+	copies := 0
+	for _, r := range results {
+		if r.Chunk.Content == "install steps" {
+			copies++
+		}
+	}
+	if copies != 1 {
+		t.Errorf("Expected one copy of the duplicated chunk, got %d: %+v", copies, results)
+	}
+
+	similarity := make(map[string]float32)
+	for _, r := range Search(index, query, 0, -1) {
+		similarity[r.Chunk.Path] = r.Score
+	}
+	for _, r := range results {
+		if r.Score != similarity[r.Chunk.Path] {
+			t.Errorf("%s: expected query similarity %.3f as score, got %.3f", r.Chunk.Path, similarity[r.Chunk.Path], r.Score)
+		}
+	}
+}
+
+func TestMMRSearchLambdaOne(t *testing.T) {
+	index := duplicateIndex()
+	query := []float32{1, 0.1, 0.1}
+
+	plain := Search(index, query, 5, 0)
+	results := MMRSearch(index, query, MMROptions{SearchOptions: SearchOptions{TopK: 5}, Lambda: ptr(float32(1))})
+	for i := range plain {
+		if plain[i].Chunk.Path != results[i].Chunk.Path {
+			t.Errorf("Result %d: expected %s with lambda 1, got %s", i, plain[i].Chunk.Path, results[i].Chunk.Path)
+		}
+	}
+}
+
+func TestMMRSearchLambdaZero(t *testing.T) {
+	chunks := []Chunk{{Path: "a.md"}, {Path: "b.md"}, {Path: "c.md"}}
+	embeddings := [][]float32{{1, 0, 0}, {0.8, 0.6, 0}, {0, 0, 1}}
+	index := BuildIndex(chunks, embeddings, 3)
+	query := []float32{1, 0.3, 0}
+	opts := SearchOptions{TopK: 2, Threshold: -1}
+
+	// b.md is relevant but close to a.md, c.md is irrelevant but distinct
+	for _, tc := range []struct {
+		lambda *float32
+		second string
+	}{
+		{nil, "b.md"},
+		{ptr(float32(0.5)), "b.md"},
+		{ptr(float32(0)), "c.md"},
+	} {
+		results := MMRSearch(index, query, MMROptions{SearchOptions: opts, Lambda: tc.lambda})
+		if len(results) != 2 || results[0].Chunk.Path != "a.md" || results[1].Chunk.Path != tc.second {
+			t.Errorf("Lambda %v: expected a.md, %s, got %+v", tc.lambda, tc.second, results)
+		}
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
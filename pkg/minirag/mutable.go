@@ -0,0 +1,284 @@
+package minirag
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+var (
+	// ErrDuplicateID is returned when chunks added to a MutableIndex share
+	// an ID with each other or with a chunk already in it
+	ErrDuplicateID = errors.New("minirag: duplicate chunk ID")
+
+	// ErrDeletedChunks is returned when saving the live index of a
+	// MutableIndex, whose deleted chunks would be written back out
+	ErrDeletedChunks = errors.New("minirag: index holds deleted chunks, save a MutableIndex Snapshot instead")
+)
+
+// MutableIndex is a VectorIndex whose chunks can be added, replaced and
+// deleted by ID while it is being searched. Writers hold an exclusive lock
+// and searches a shared one, so a search sees every write before it and
+// none after.
+//
+// Deleted and replaced chunks are marked with tombstones and skipped by
+// every search until Compact removes them, which happens automatically once
+// they make up CompactRatio of the chunks. BM25 statistics include them
+// until then.
+//
+// BM25 and HNSW structures are extended as chunks are added. IVF, int8,
+// binary and PQ structures are trained on a fixed corpus, so they are
+// dropped and searches fall back to the HNSW graph or an exact scan.
+type MutableIndex struct {
+	// CompactRatio is the fraction of tombstoned chunks that triggers
+	// compaction; 0 picks 0.25, and 1 or more only compacts on Compact
+	CompactRatio float64
+
+	mu    sync.RWMutex
+	index *VectorIndex
+	ids   map[string]int // Position of each live chunk
+}
+
+// NewMutableIndex takes ownership of index. Chunks without an ID are given
+// their ChunkHash.
+func NewMutableIndex(index *VectorIndex) (*MutableIndex, error) {
+	if err := index.Validate(); err != nil {
+		return nil, err
+	}
+	index.IVF, index.Int8, index.Binary, index.PQ = nil, nil, nil, nil
+
+	m := &MutableIndex{index: index, ids: make(map[string]int, len(index.Chunks))}
+	for i := range index.Chunks {
+		c := &index.Chunks[i]
+		if c.ID == "" {
+			c.ID = ChunkHash(*c)
+		}
+		if _, ok := m.ids[c.ID]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateID, c.ID)
+		}
+		m.ids[c.ID] = i
+	}
+	return m, nil
+}
+
+// Add appends chunks with their embeddings. It fails without changing the
+// index if an ID is already present.
+func (m *MutableIndex) Add(chunks []Chunk, embeddings [][]float32) error {
+	return m.write(chunks, embeddings, false)
+}
+
+// Upsert adds chunks, replacing the chunks with the same IDs
+func (m *MutableIndex) Upsert(chunks []Chunk, embeddings [][]float32) error {
+	return m.write(chunks, embeddings, true)
+}
+
+func (m *MutableIndex) write(chunks []Chunk, embeddings [][]float32, replace bool) error {
+	if len(chunks) != len(embeddings) {
+		return fmt.Errorf("%w: %d chunks, %d embeddings", ErrCountMismatch, len(chunks), len(embeddings))
+	}
+	chunks = append([]Chunk(nil), chunks...)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	idx := m.index
+
+	dim := idx.Dimension
+	if dim == 0 && len(embeddings) > 0 {
+		dim = len(embeddings[0]) // The first chunks of an empty index
+	}
+	seen := make(map[string]bool, len(chunks))
+	for i := range chunks {
+		c := &chunks[i]
+		if c.ID == "" {
+			c.ID = ChunkHash(*c)
+		}
+		if len(embeddings[i]) != dim || dim == 0 {
+			return fmt.Errorf("%w: embedding %d has %d values, want %d", ErrDimensionMismatch, i, len(embeddings[i]), dim)
+		}
+		_, exists := m.ids[c.ID]
+		if seen[c.ID] || exists && !replace {
+			return fmt.Errorf("%w: %s", ErrDuplicateID, c.ID)
+		}
+		seen[c.ID] = true
+	}
+	idx.Dimension = dim
+
+	tf := make(map[string]float32)
+	for i := range chunks {
+		if old, ok := m.ids[chunks[i].ID]; ok {
+			m.tombstone(old)
+		}
+		pos := len(idx.Chunks)
+		idx.Chunks = append(idx.Chunks, chunks[i])
+		idx.Embeddings = append(idx.Embeddings, embeddings[i])
+		if idx.tombstones != nil {
+			idx.tombstones = append(idx.tombstones, false)
+		}
+		if idx.BM25 != nil {
+			idx.BM25.add(&idx.Chunks[pos], tf)
+		}
+		if idx.HNSW != nil {
+			idx.HNSW.insert(idx.Embeddings, pos)
+		}
+		m.ids[chunks[i].ID] = pos
+	}
+	if idx.BM25 != nil {
+		idx.BM25.updateAverage()
+	}
+	idx.SourceHash = ""
+	m.maybeCompact()
+	return nil
+}
+
+// Delete removes the chunks with the given IDs and returns how many were
+// present
+func (m *MutableIndex) Delete(ids ...string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deleted := 0
+	for _, id := range ids {
+		if pos, ok := m.ids[id]; ok {
+			m.tombstone(pos)
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		m.index.SourceHash = ""
+		m.maybeCompact()
+	}
+	return deleted
+}
+
+// tombstone marks the chunk at pos deleted. m.mu must be held.
+func (m *MutableIndex) tombstone(pos int) {
+	idx := m.index
+	if idx.tombstones == nil {
+		idx.tombstones = make([]bool, len(idx.Chunks), cap(idx.Chunks))
+	}
+	idx.tombstones[pos] = true
+	idx.deleted++
+	delete(m.ids, idx.Chunks[pos].ID)
+}
+
+func (m *MutableIndex) maybeCompact() {
+	ratio := m.CompactRatio
+	if ratio <= 0 {
+		ratio = 0.25
+	}
+	if ratio < 1 && float64(m.index.deleted) >= ratio*float64(len(m.index.Chunks)) {
+		m.compact()
+	}
+}
+
+// Compact removes deleted chunks for good, rebuilding the BM25 index and
+// HNSW graph over the remaining ones. Searches wait until it is done.
+func (m *MutableIndex) Compact() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.compact()
+}
+
+func (m *MutableIndex) compact() {
+	old := m.index
+	if old.deleted == 0 {
+		return
+	}
+
+	live := len(old.Chunks) - old.deleted
+	idx := *old
+	idx.Chunks = make([]Chunk, 0, live)
+	idx.Embeddings = make([][]float32, 0, live)
+	idx.tombstones, idx.deleted = nil, 0
+	for i := range old.Chunks {
+		if !old.tombstones[i] {
+			m.ids[old.Chunks[i].ID] = len(idx.Chunks)
+			idx.Chunks = append(idx.Chunks, old.Chunks[i])
+			idx.Embeddings = append(idx.Embeddings, old.Embeddings[i])
+		}
+	}
+	if old.BM25 != nil {
+		idx.BM25 = BuildBM25(idx.Chunks, BM25Config{K1: old.BM25.K1, B: old.BM25.B, HeadingWeight: old.BM25.HeadingWeight})
+	}
+	if old.HNSW != nil {
+		idx.HNSW = BuildHNSW(&idx, HNSWConfig{M: old.HNSW.M, EfConstruction: old.HNSW.EfConstruction, EfSearch: old.HNSW.EfSearch})
+	}
+	m.index = &idx
+}
+
+// Len returns the number of chunks, not counting deleted ones
+func (m *MutableIndex) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.ids)
+}
+
+// Get returns the chunk with the given ID and its embedding
+func (m *MutableIndex) Get(id string) (Chunk, []float32, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	pos, ok := m.ids[id]
+	if !ok {
+		return Chunk{}, nil, false
+	}
+	return m.index.Chunks[pos], m.index.Embeddings[pos], true
+}
+
+// View calls fn with the index while holding the read lock, for searches
+// not covered by the methods below. fn must not modify the index or keep it
+// after returning, and must skip deleted chunks if it reads Chunks directly;
+// the search functions do. Deleted chunks are only dropped by compaction,
+// so WriteIndex and SaveIndex refuse the index with ErrDeletedChunks while
+// it holds any; use Snapshot to persist it.
+func (m *MutableIndex) View(fn func(index *VectorIndex)) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	fn(m.index)
+}
+
+// Snapshot returns a compacted copy of the index, which later writes do not
+// change, to save or search without locking
+func (m *MutableIndex) Snapshot() *VectorIndex {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.compact()
+	idx := *m.index
+	idx.Chunks = slices.Clone(idx.Chunks)
+	idx.Embeddings = slices.Clone(idx.Embeddings)
+	if idx.BM25 != nil {
+		idx.BM25 = idx.BM25.clone()
+	}
+	if idx.HNSW != nil {
+		idx.HNSW = idx.HNSW.clone()
+	}
+	return &idx
+}
+
+// Search is SearchWithOptions on the current chunks
+func (m *MutableIndex) Search(queryEmbedding []float32, opts SearchOptions) []SearchResult {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return SearchWithOptions(m.index, queryEmbedding, opts)
+}
+
+// LexicalSearch is LexicalSearch on the current chunks
+func (m *MutableIndex) LexicalSearch(query string, opts SearchOptions) []SearchResult {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return LexicalSearch(m.index, query, opts)
+}
+
+// HybridSearch is HybridSearch on the current chunks
+func (m *MutableIndex) HybridSearch(query string, queryEmbedding []float32, opts HybridOptions) []SearchResult {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return HybridSearch(m.index, query, queryEmbedding, opts)
+}
+
+// MMRSearch is MMRSearch on the current chunks
+func (m *MutableIndex) MMRSearch(queryEmbedding []float32, opts MMROptions) []SearchResult {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return MMRSearch(m.index, queryEmbedding, opts)
+}
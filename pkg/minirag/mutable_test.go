@@ -0,0 +1,195 @@
+package minirag
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"sync"
+	"testing"
+)
+
+func TestMutableIndex(t *testing.T) {
+	index := testIndex()
+	index.BM25 = BuildBM25(index.Chunks, BM25Config{})
+	m, err := NewMutableIndex(index)
+	if err != nil {
+		t.Fatalf("NewMutableIndex: %v", err)
+	}
+	m.CompactRatio = 1 // Keep tombstones until Compact
+
+	alpha := ChunkHash(Chunk{Path: "a.md", Content: "alpha", Heading: "A"})
+	if _, _, ok := m.Get(alpha); !ok {
+		t.Fatal("Expected chunks without ID to be keyed by their hash")
+	}
+
+	err = m.Add([]Chunk{{ID: "c", Path: "c.md", Content: "gamma"}}, [][]float32{{0, 0, 1}})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	err = m.Add([]Chunk{{ID: "d", Content: "delta"}, {ID: "c", Content: "again"}}, [][]float32{{1, 0, 0}, {1, 0, 0}})
+	if !errors.Is(err, ErrDuplicateID) {
+		t.Errorf("Expected ErrDuplicateID, got %v", err)
+	}
+	err = m.Add([]Chunk{{ID: "e"}}, [][]float32{{1, 0}})
+	if !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch, got %v", err)
+	}
+	if m.Len() != 3 {
+		t.Errorf("Expected failed adds to leave 3 chunks, got %d", m.Len())
+	}
+
+	results := m.Search([]float32{0, 0, 1}, SearchOptions{TopK: 1})
+	if len(results) != 1 || results[0].Chunk.ID != "c" {
+		t.Errorf("Expected the added chunk, got %+v", results)
+	}
+
+	// Replace c with a chunk pointing elsewhere; the old version must not
+	// be found by vector or keyword search
+	err = m.Upsert([]Chunk{{ID: "c", Path: "c.md", Content: "omega"}}, [][]float32{{0, 1, 0}})
+	if err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	for _, r := range m.Search([]float32{0, 0, 1}, SearchOptions{}) {
+		if r.Chunk.Content == "gamma" {
+			t.Error("Expected the replaced chunk to be gone")
+		}
+	}
+	if r := m.LexicalSearch("gamma", SearchOptions{}); len(r) != 0 {
+		t.Errorf("Expected no keyword match for the replaced chunk, got %+v", r)
+	}
+	if r := m.LexicalSearch("omega", SearchOptions{}); len(r) != 1 || r[0].Chunk.ID != "c" {
+		t.Errorf("Expected a keyword match for the new chunk, got %+v", r)
+	}
+
+	if n := m.Delete(alpha, "missing"); n != 1 {
+		t.Errorf("Expected 1 chunk deleted, got %d", n)
+	}
+	for _, r := range m.Search([]float32{1, 0, 0}, SearchOptions{}) {
+		if r.Chunk.ID == alpha {
+			t.Error("Expected the deleted chunk to be gone")
+		}
+	}
+	if r := m.LexicalSearch("alpha", SearchOptions{}); len(r) != 0 {
+		t.Errorf("Expected no keyword match for the deleted chunk, got %+v", r)
+	}
+
+	m.View(func(idx *VectorIndex) {
+		if len(idx.Chunks) != 4 || idx.deleted != 2 {
+			t.Errorf("Expected 2 of 4 chunks tombstoned, got %d of %d", idx.deleted, len(idx.Chunks))
+		}
+		// Saving would resurrect the deleted chunks
+		if err := WriteIndex(io.Discard, idx); !errors.Is(err, ErrDeletedChunks) {
+			t.Errorf("Expected ErrDeletedChunks, got %v", err)
+		}
+	})
+	m.Compact()
+	m.View(func(idx *VectorIndex) {
+		if len(idx.Chunks) != 2 || idx.deleted != 0 || idx.BM25.Len() != 2 {
+			t.Errorf("Expected 2 chunks after compaction, got %d (%d deleted)", len(idx.Chunks), idx.deleted)
+		}
+	})
+	if c, _, ok := m.Get("c"); !ok || c.Content != "omega" {
+		t.Errorf("Expected c to survive compaction, got %+v", c)
+	}
+
+	// A snapshot is a plain index, unaffected by later writes
+	snap := m.Snapshot()
+	m.Delete("c")
+	if err := snap.Validate(); err != nil || len(snap.Chunks) != 2 {
+		t.Errorf("Expected a valid snapshot of 2 chunks, got %d: %v", len(snap.Chunks), err)
+	}
+	if r := LexicalSearch(snap, "omega", SearchOptions{}); len(r) != 1 {
+		t.Errorf("Expected the snapshot to keep c, got %+v", r)
+	}
+}
+
+func TestMutableIndexAutoCompact(t *testing.T) {
+	m, _ := NewMutableIndex(randomIndex(100, 8, 1))
+	for i := range 24 {
+		m.Delete(ChunkHash(Chunk{Path: fmt.Sprintf("doc%d.md", i), Content: fmt.Sprintf("chunk %d", i)}))
+	}
+	m.View(func(idx *VectorIndex) {
+		if idx.deleted != 24 {
+			t.Errorf("Expected 24 tombstones below the ratio, got %d", idx.deleted)
+		}
+	})
+	m.Delete(ChunkHash(Chunk{Path: "doc24.md", Content: "chunk 24"}))
+	m.View(func(idx *VectorIndex) {
+		if idx.deleted != 0 || len(idx.Chunks) != 75 {
+			t.Errorf("Expected compaction at 25%%, got %d chunks with %d tombstones", len(idx.Chunks), idx.deleted)
+		}
+	})
+}
+
+func TestMutableIndexHNSW(t *testing.T) {
+	index := randomIndex(500, 16, 2)
+	index.HNSW = BuildHNSW(index, DefaultHNSWConfig())
+	m, err := NewMutableIndex(index)
+	if err != nil {
+		t.Fatalf("NewMutableIndex: %v", err)
+	}
+
+	rng := rand.New(rand.NewPCG(3, 1))
+	for i := range 100 {
+		v := randomVector(rng, 16)
+		if err := m.Add([]Chunk{{ID: fmt.Sprint("new", i)}}, [][]float32{v}); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+		if r := m.Search(v, SearchOptions{TopK: 1}); len(r) != 1 || r[0].Chunk.ID != fmt.Sprint("new", i) {
+			t.Fatalf("Expected the graph to find added chunk %d, got %+v", i, r)
+		}
+	}
+	m.View(func(idx *VectorIndex) {
+		if idx.HNSW.Len() != 600 {
+			t.Errorf("Expected 600 graph nodes, got %d", idx.HNSW.Len())
+		}
+	})
+}
+
+func TestMutableIndexConcurrent(t *testing.T) {
+	index := randomIndex(200, 8, 4)
+	index.BM25 = BuildBM25(index.Chunks, BM25Config{})
+	index.HNSW = BuildHNSW(index, DefaultHNSWConfig())
+	m, _ := NewMutableIndex(index)
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for r := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewPCG(uint64(r), 2))
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				// A replaced chunk and its replacement are never both live
+				seen := make(map[string]bool)
+				q := randomVector(rng, 8)
+				for _, res := range m.HybridSearch("chunk", q, HybridOptions{SearchOptions: SearchOptions{TopK: 20}}) {
+					if seen[res.Chunk.ID] {
+						t.Errorf("Search returned two chunks with ID %s", res.Chunk.ID)
+						return
+					}
+					seen[res.Chunk.ID] = true
+				}
+			}
+		}()
+	}
+
+	rng := rand.New(rand.NewPCG(5, 1))
+	for i := range 300 {
+		id := fmt.Sprint("doc", i%50)
+		if err := m.Upsert([]Chunk{{ID: id, Content: "chunk"}}, [][]float32{randomVector(rng, 8)}); err != nil {
+			t.Fatalf("Upsert: %v", err)
+		}
+		if i%3 == 0 {
+			m.Delete(id)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
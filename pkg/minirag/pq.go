@@ -0,0 +1,410 @@
+package minirag
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+)
+
+// PQConfig holds the parameters of a product quantizer
+type PQConfig struct {
+	SubVectors int    // Number of sub-vectors (bytes per code); 0 picks dimension/8
+	Iterations int    // k-means iterations per codebook; 0 picks 20
+	SampleSize int    // Vectors used to train codebooks; 0 picks 65536
+	Rescore    int    // Candidates rescored exactly, as a multiple of topK; 0 disables
+	Seed       uint64 // Seed for codebook training
+}
+
+// pqDropFloat32 flags DropFloat32 in the rescore field of encoded codes
+const pqDropFloat32 = 1 << 31
+
+// pqCentroids is the number of centroids per codebook, so each sub-vector
+// code fits in one byte
+const pqCentroids = 256
+
+// PQCodes holds product-quantized embeddings. Each vector is split into
+// SubVectors contiguous sub-vectors, and each sub-vector is replaced by the
+// index of its nearest centroid in a per-subspace codebook. Queries are
+// scored with asymmetric distance computation: the query stays in float32
+// and is compared to the codebook entries once per search. Attach to
+// VectorIndex.PQ for stand-alone use, or build with BuildIVFPQ to encode
+// IVF residuals.
+type PQCodes struct {
+	Rescore int // Candidates rescored exactly, as a multiple of topK; 0 disables
+
+	// DropFloat32 stores only the codes when the index is saved. Such
+	// indexes are loaded with embeddings decoded from the codes, and
+	// rescoring is skipped, returning the ADC scores.
+	DropFloat32 bool
+
+	dim         int
+	bounds      []int       // Sub-vector m spans dimensions bounds[m]:bounds[m+1]
+	codebooks   [][]float32 // codebooks[m] holds ksub centroids of its sub-vector width
+	ksub        int
+	codes       []uint8   // n*SubVectors codes, one vector after another
+	norms       []float32 // L2 norm of each original vector
+	dequantized bool      // Embeddings were decoded from the codes
+}
+
+// QuantizePQ trains codebooks on the embeddings of index and encodes them.
+// Assign the result to index.PQ to search the codes.
+func QuantizePQ(index *VectorIndex, cfg PQConfig) *PQCodes {
+	return trainPQ(index.Embeddings, index.Embeddings, index.Dimension, cfg)
+}
+
+// trainPQ trains codebooks on vectors (which may be residuals) and encodes
+// them; originals supplies the norms used for cosine scores
+func trainPQ(vectors, originals [][]float32, dim int, cfg PQConfig) *PQCodes {
+	m := cfg.SubVectors
+	if m <= 0 {
+		m = max(1, dim/8)
+	}
+	m = max(1, min(m, dim))
+	if cfg.Iterations <= 0 {
+		cfg.Iterations = 20
+	}
+	if cfg.SampleSize <= 0 {
+		cfg.SampleSize = 65536
+	}
+
+	pq := &PQCodes{
+		Rescore:   cfg.Rescore,
+		dim:       dim,
+		bounds:    make([]int, m+1),
+		codebooks: make([][]float32, m),
+	}
+	for s := range pq.bounds {
+		pq.bounds[s] = s * dim / m
+	}
+
+	rng := rand.New(rand.NewPCG(cfg.Seed, 0x6a09e667f3bcc909))
+	sample := sampleVectors(vectors, cfg.SampleSize, rng)
+	pq.ksub = min(pqCentroids, len(sample))
+	for s := range pq.codebooks {
+		lo, hi := pq.bounds[s], pq.bounds[s+1]
+		sub := make([][]float32, len(sample))
+		for i, v := range sample {
+			sub[i] = v[lo:hi]
+		}
+		centroids := trainKMeansL2(sub, pq.ksub, cfg.Iterations, rng)
+		pq.codebooks[s] = make([]float32, 0, pq.ksub*(hi-lo))
+		for _, c := range centroids {
+			pq.codebooks[s] = append(pq.codebooks[s], c...)
+		}
+	}
+
+	pq.codes = make([]uint8, len(vectors)*m)
+	pq.norms = make([]float32, len(vectors))
+	for i, v := range vectors {
+		pq.encode(v, pq.codes[i*m:(i+1)*m])
+		pq.norms[i] = l2norm(originals[i])
+	}
+	return pq
+}
+
+// SubVectors returns the number of sub-vectors, i.e. bytes per code
+func (pq *PQCodes) SubVectors() int {
+	return len(pq.codebooks)
+}
+
+// Len returns the number of encoded vectors
+func (pq *PQCodes) Len() int {
+	return len(pq.norms)
+}
+
+// encode writes the code of v into dst
+func (pq *PQCodes) encode(v []float32, dst []uint8) {
+	for s := range pq.codebooks {
+		lo, hi := pq.bounds[s], pq.bounds[s+1]
+		width := hi - lo
+		best, bestDist := 0, float32(math.Inf(1))
+		for k := 0; k < pq.ksub; k++ {
+			if d := squaredL2(v[lo:hi], pq.codebooks[s][k*width:(k+1)*width]); d < bestDist {
+				best, bestDist = k, d
+			}
+		}
+		dst[s] = uint8(best)
+	}
+}
+
+// Decode reconstructs an approximation of encoded vector i. For IVF-PQ
+// codes this is the residual relative to the vector's centroid.
+func (pq *PQCodes) Decode(i int) []float32 {
+	v := make([]float32, pq.dim)
+	pq.decodeInto(v, i)
+	return v
+}
+
+func (pq *PQCodes) decodeInto(v []float32, i int) {
+	m := pq.SubVectors()
+	for s, code := range pq.codes[i*m : (i+1)*m] {
+		lo, hi := pq.bounds[s], pq.bounds[s+1]
+		width := hi - lo
+		copy(v[lo:hi], pq.codebooks[s][int(code)*width:(int(code)+1)*width])
+	}
+}
+
+// decodeAll decodes every vector into one contiguous buffer
+func (pq *PQCodes) decodeAll() [][]float32 {
+	vectors := splitVectors(make([]float32, pq.Len()*pq.dim), pq.Len(), pq.dim)
+	for i, v := range vectors {
+		pq.decodeInto(v, i)
+	}
+	return vectors
+}
+
+// table computes the inner products between each query sub-vector and all
+// centroids of its codebook: table[s*ksub+k] = <q_s, codebook_s[k]>
+func (pq *PQCodes) table(q []float32) []float32 {
+	t := make([]float32, pq.SubVectors()*pq.ksub)
+	for s := range pq.codebooks {
+		lo, hi := pq.bounds[s], pq.bounds[s+1]
+		width := hi - lo
+		for k := 0; k < pq.ksub; k++ {
+			t[s*pq.ksub+k] = dot(q[lo:hi], pq.codebooks[s][k*width:(k+1)*width])
+		}
+	}
+	return t
+}
+
+// innerProduct approximates <q, x_i> from the lookup table
+func (pq *PQCodes) innerProduct(t []float32, i int) float32 {
+	m := pq.SubVectors()
+	var sum float32
+	for s, code := range pq.codes[i*m : (i+1)*m] {
+		sum += t[s*pq.ksub+int(code)]
+	}
+	return sum
+}
+
+// search scores every code accepted by mask against query and optionally
+// rescores the best candidates with the float32 vectors
+func (pq *PQCodes) search(vectors [][]float32, query []float32, mask chunkMask, topK int, threshold float32) []hit {
+	qnorm := l2norm(query)
+	if qnorm == 0 {
+		return nil
+	}
+	t := pq.table(query)
+
+	rescore := pq.Rescore > 0 && !pq.dequantized && topK > 0
+	candidates, minScore := topK, threshold
+	if rescore {
+		candidates, minScore = topK*pq.Rescore, float32(math.Inf(-1))
+	}
+
+	results := newBestHits(candidates)
+	for i, norm := range pq.norms {
+		if norm == 0 || !mask.has(i) {
+			continue
+		}
+		if score := pq.innerProduct(t, i) / (qnorm * norm); score >= minScore {
+			results.push(hit{idx: i, score: score})
+		}
+	}
+	if !rescore {
+		return results.hits()
+	}
+	return rescoreHits(vectors, query, results.hits(), topK, threshold)
+}
+
+// rescoreHits recomputes exact cosine scores for candidates and keeps the
+// topK at or above threshold
+func rescoreHits(vectors [][]float32, query []float32, candidates []hit, topK int, threshold float32) []hit {
+	results := newBestHits(topK)
+	for _, h := range candidates {
+		if score := CosineSimilarity(query, vectors[h.idx]); score >= threshold {
+			results.push(hit{idx: h.idx, score: score})
+		}
+	}
+	return results.hits()
+}
+
+// trainKMeansL2 runs k-means with squared Euclidean distance, as used for
+// PQ codebooks, with k-means++ initialisation
+func trainKMeansL2(vectors [][]float32, k, iterations int, rng *rand.Rand) [][]float32 {
+	k = min(k, len(vectors))
+	if k == 0 {
+		return nil
+	}
+	dim := len(vectors[0])
+
+	// k-means++ seeding
+	centroids := [][]float32{clone(vectors[rng.IntN(len(vectors))])}
+	dist := make([]float64, len(vectors))
+	for i := range dist {
+		dist[i] = math.Inf(1)
+	}
+	for len(centroids) < k {
+		last := centroids[len(centroids)-1]
+		var total float64
+		for i, v := range vectors {
+			dist[i] = min(dist[i], float64(squaredL2(v, last)))
+			total += dist[i]
+		}
+		next := rng.IntN(len(vectors))
+		if total > 0 {
+			target := rng.Float64() * total
+			for i, d := range dist {
+				if target -= d; target <= 0 {
+					next = i
+					break
+				}
+			}
+		}
+		centroids = append(centroids, clone(vectors[next]))
+	}
+
+	for range iterations {
+		assign := assignVectors(vectors, centroids, nearestL2)
+		sums := make([][]float64, k)
+		counts := make([]int, k)
+		for c := range sums {
+			sums[c] = make([]float64, dim)
+		}
+		for i, c := range assign {
+			counts[c]++
+			for j, x := range vectors[i] {
+				sums[c][j] += float64(x)
+			}
+		}
+
+		changed := false
+		for c := range centroids {
+			if counts[c] == 0 {
+				centroids[c] = clone(vectors[rng.IntN(len(vectors))])
+				changed = true
+				continue
+			}
+			for j, s := range sums[c] {
+				x := float32(s / float64(counts[c]))
+				if x != centroids[c][j] {
+					changed = true
+				}
+				centroids[c][j] = x
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	return centroids
+}
+
+// nearestL2 returns the index of the centroid closest to v in Euclidean distance
+func nearestL2(v []float32, centroids [][]float32) int {
+	best, bestDist := 0, float32(math.Inf(1))
+	for c, centroid := range centroids {
+		if d := squaredL2(v, centroid); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+func squaredL2(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+	return sum
+}
+
+func dot(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+func l2norm(v []float32) float32 {
+	return float32(math.Sqrt(float64(dot(v, v))))
+}
+
+func clone(v []float32) []float32 {
+	return append([]float32(nil), v...)
+}
+
+// marshal encodes the codes as the payload of a PQCB section, or as the
+// trailing block of an IVF section:
+//
+//	rescore (bit 31: DropFloat32), dimension, sub-vector count,
+//	centroids per codebook, vector count: uint32
+//	codebooks: per sub-vector, centroids*width float32
+//	norms: count float32
+//	codes: count*sub-vectors uint8
+func (pq *PQCodes) marshal() []byte {
+	var w binWriter
+	pq.marshalTo(&w)
+	return w.buf
+}
+
+func (pq *PQCodes) marshalTo(w *binWriter) {
+	rescore := uint32(pq.Rescore) &^ pqDropFloat32
+	if pq.DropFloat32 {
+		rescore |= pqDropFloat32
+	}
+	w.u32(rescore)
+	w.u32(uint32(pq.dim))
+	w.u32(uint32(pq.SubVectors()))
+	w.u32(uint32(pq.ksub))
+	w.u32(uint32(pq.Len()))
+	for _, cb := range pq.codebooks {
+		w.f32s(cb)
+	}
+	w.f32s(pq.norms)
+	w.bytes(pq.codes)
+}
+
+// unmarshalPQ decodes a PQCB section for an index of n chunks and the
+// given dimension
+func unmarshalPQ(data []byte, n, dim int) (*PQCodes, error) {
+	return unmarshalPQFrom(&binReader{buf: data}, n, dim)
+}
+
+func unmarshalPQFrom(r *binReader, n, dim int) (*PQCodes, error) {
+	rescore := r.u32()
+	pq := &PQCodes{
+		Rescore:     int(rescore &^ pqDropFloat32),
+		DropFloat32: rescore&pqDropFloat32 != 0,
+		dim:         int(r.u32()),
+	}
+	m := int(r.u32())
+	pq.ksub = int(r.u32())
+	count := int(r.u32())
+	if r.err != nil {
+		return nil, r.err
+	}
+	if count != n {
+		return nil, fmt.Errorf("%w: %d PQ codes, index has %d chunks", ErrCountMismatch, count, n)
+	}
+	// An empty index has nothing to train centroids on
+	minKsub := 1
+	if n == 0 {
+		minKsub = 0
+	}
+	if pq.dim != dim || m < 1 || m > dim || pq.ksub < minKsub || pq.ksub > pqCentroids {
+		return nil, fmt.Errorf("%w: bad PQ parameters (dimension %d, sub-vectors %d, centroids %d)", ErrCorruptIndex, pq.dim, m, pq.ksub)
+	}
+
+	pq.bounds = make([]int, m+1)
+	for s := range pq.bounds {
+		pq.bounds[s] = s * dim / m
+	}
+	pq.codebooks = make([][]float32, m)
+	for s := range pq.codebooks {
+		pq.codebooks[s] = r.f32s(pq.ksub * (pq.bounds[s+1] - pq.bounds[s]))
+	}
+	pq.norms = r.f32s(n)
+	pq.codes = r.take(n * m)
+	if r.err != nil {
+		return nil, r.err
+	}
+	for _, c := range pq.codes {
+		if int(c) >= pq.ksub {
+			return nil, fmt.Errorf("%w: PQ code out of range", ErrCorruptIndex)
+		}
+	}
+	return pq, nil
+}
@@ -0,0 +1,176 @@
+package minirag
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPQRecall(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		rescore int
+		want    float64
+	}{
+		{"adc", 0, 0.5},
+		{"rescored", 5, 0.95},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			index := randomIndex(2000, 64, 16)
+			index.PQ = QuantizePQ(index, PQConfig{SubVectors: 16, Rescore: tt.rescore, Seed: 1})
+
+			if index.PQ.SubVectors() != 16 || len(index.PQ.codes) != 2000*16 {
+				t.Fatalf("Expected 16 bytes per code, got %d", index.PQ.SubVectors())
+			}
+
+			r := meanRecall(t, index, 50, 10)
+			t.Logf("PQ recall@10: %.3f", r)
+			if r < tt.want {
+				t.Errorf("Expected recall@10 >= %.2f, got %.3f", tt.want, r)
+			}
+		})
+	}
+}
+
+func TestPQDecode(t *testing.T) {
+	index := randomIndex(1000, 32, 17)
+	pq := QuantizePQ(index, PQConfig{SubVectors: 8})
+
+	// Reconstructions should point roughly the same way as the originals
+	var total float32
+	for i, v := range index.Embeddings {
+		total += CosineSimilarity(v, pq.Decode(i))
+	}
+	if mean := total / float32(len(index.Embeddings)); mean < 0.9 {
+		t.Errorf("Expected mean reconstruction similarity >= 0.9, got %.3f", mean)
+	}
+}
+
+func TestIVFPQRecall(t *testing.T) {
+	index := randomIndex(3000, 64, 18)
+	index.IVF = BuildIVFPQ(index, IVFConfig{Lists: 32, NProbe: 8, Seed: 1}, PQConfig{SubVectors: 16, Rescore: 5, Seed: 1})
+
+	r := meanRecall(t, index, 50, 10)
+	t.Logf("IVF-PQ recall@10: %.3f", r)
+	if r < 0.9 {
+		t.Errorf("Expected recall@10 >= 0.9, got %.3f", r)
+	}
+}
+
+func TestPQPersistence(t *testing.T) {
+	index := randomIndex(500, 32, 19)
+	index.PQ = QuantizePQ(index, PQConfig{SubVectors: 8, Rescore: 3})
+	index.IVF = BuildIVFPQ(index, IVFConfig{Lists: 8, NProbe: 2}, PQConfig{SubVectors: 4})
+
+	var buf bytes.Buffer
+	if err := WriteIndex(&buf, index); err != nil {
+		t.Fatalf("WriteIndex: %v", err)
+	}
+	loaded, err := LoadIndexFromBytes(buf.Bytes())
+	if err != nil {
+		t.Fatalf("LoadIndexFromBytes: %v", err)
+	}
+	if loaded.PQ == nil || loaded.PQ.Rescore != 3 || loaded.PQ.SubVectors() != 8 {
+		t.Fatalf("PQ codes not round-tripped")
+	}
+	if loaded.IVF == nil || loaded.IVF.PQ == nil || loaded.IVF.PQ.SubVectors() != 4 {
+		t.Fatalf("IVF-PQ codes not round-tripped")
+	}
+
+	q := index.Embeddings[11]
+	for _, mode := range []SearchMode{ModePQ, ModeIVF} {
+		index.Mode, loaded.Mode = mode, mode
+		want := Search(index, q, 5, 0)
+		got := Search(loaded, q, 5, 0)
+		if len(want) != len(got) {
+			t.Fatalf("Mode %s: expected %d results, got %d", mode, len(want), len(got))
+		}
+		for i := range want {
+			if want[i].Chunk.Offset != got[i].Chunk.Offset || want[i].Score != got[i].Score {
+				t.Errorf("Mode %s: result %d differs: %+v vs %+v", mode, i, want[i], got[i])
+			}
+		}
+	}
+}
+
+func TestPQEmptyIndex(t *testing.T) {
+	index := BuildIndex(nil, nil, 16)
+	index.PQ = QuantizePQ(index, PQConfig{})
+	index.IVF = BuildIVFPQ(index, IVFConfig{}, PQConfig{})
+
+	var buf bytes.Buffer
+	if err := WriteIndex(&buf, index); err != nil {
+		t.Fatalf("WriteIndex: %v", err)
+	}
+	loaded, err := LoadIndexFromBytes(buf.Bytes())
+	if err != nil {
+		t.Fatalf("LoadIndexFromBytes: %v", err)
+	}
+	if loaded.PQ == nil || loaded.IVF == nil || loaded.IVF.PQ == nil {
+		t.Fatalf("PQ codes not round-tripped")
+	}
+	q := make([]float32, 16)
+	q[0] = 1
+	for _, mode := range []SearchMode{ModePQ, ModeIVF} {
+		loaded.Mode = mode
+		if results := Search(loaded, q, 5, 0); len(results) != 0 {
+			t.Errorf("Mode %s: expected no results, got %d", mode, len(results))
+		}
+	}
+}
+
+func TestPQDropFloat32(t *testing.T) {
+	for _, ivf := range []bool{false, true} {
+		index := randomIndex(300, 32, 20)
+		var pq *PQCodes
+		if ivf {
+			index.IVF = BuildIVFPQ(index, IVFConfig{Lists: 4, NProbe: 4}, PQConfig{SubVectors: 8, Rescore: 3})
+			pq = index.IVF.PQ
+		} else {
+			index.PQ = QuantizePQ(index, PQConfig{SubVectors: 8, Rescore: 3})
+			pq = index.PQ
+		}
+
+		var full bytes.Buffer
+		if err := WriteIndex(&full, index); err != nil {
+			t.Fatalf("WriteIndex: %v", err)
+		}
+		pq.DropFloat32 = true
+		var small bytes.Buffer
+		if err := WriteIndex(&small, index); err != nil {
+			t.Fatalf("WriteIndex: %v", err)
+		}
+		if vectorBytes := 300 * 32 * 4; full.Len()-small.Len() < vectorBytes {
+			t.Errorf("IVF %v: expected dropping float32 to save at least %d bytes, saved %d", ivf, vectorBytes, full.Len()-small.Len())
+		}
+
+		loaded, err := LoadIndexFromBytes(small.Bytes())
+		if err != nil {
+			t.Fatalf("LoadIndexFromBytes: %v", err)
+		}
+		loadedPQ := loaded.PQ
+		if ivf {
+			loadedPQ = loaded.IVF.PQ
+		}
+		if !loadedPQ.DropFloat32 || loadedPQ.Rescore != 3 {
+			t.Fatalf("IVF %v: PQ flags not round-tripped: %+v", ivf, loadedPQ)
+		}
+		if len(loaded.Embeddings) != 300 {
+			t.Fatalf("IVF %v: expected decoded embeddings, got %d", ivf, len(loaded.Embeddings))
+		}
+		if s := CosineSimilarity(loaded.Embeddings[7], index.Embeddings[7]); s < 0.8 {
+			t.Errorf("IVF %v: decoded embedding too far from original: similarity %.4f", ivf, s)
+		}
+
+		// Without rescoring, the loaded index returns the ADC scores
+		pq.Rescore = 0
+		q := index.Embeddings[7]
+		want := Search(index, q, 5, 0)
+		got := Search(loaded, q, 5, 0)
+		for i := range want {
+			if i >= len(got) || want[i].Chunk.Offset != got[i].Chunk.Offset || want[i].Score != got[i].Score {
+				t.Errorf("IVF %v: expected ADC result %+v, got %+v", ivf, want[i], got)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package minirag
+
+import (
+	"fmt"
+	"math"
+	"unsafe"
+)
+
+// QuantizationScale selects how int8 scale factors are computed
+type QuantizationScale uint8
+
+const (
+	// PerVector uses one scale per embedding, from its largest component
+	PerVector QuantizationScale = iota
+	// PerDimension uses one scale per dimension, from its largest component
+	// across all embeddings
+	PerDimension
+)
+
+// Int8Vectors holds the embeddings of an index quantized to int8. Each
+// component x is stored as round(x/scale) in [-127, 127]. When attached to
+// VectorIndex.Int8, Search scans the int8 codes instead of the float32
+// vectors and optionally rescores the best candidates exactly.
+type Int8Vectors struct {
+	Scale QuantizationScale
+
+	// Rescore sets how many candidates, as a multiple of topK, are rescored
+	// with the float32 embeddings. 0 returns the quantized scores directly.
+	Rescore int
+
+	// DropFloat32 stores only the int8 codes when the index is saved,
+	// shrinking the file about 4x. Such indexes are loaded with dequantized
+	// embeddings, and rescoring is skipped since it would not be exact.
+	DropFloat32 bool
+
+	dim         int
+	codes       []int8    // n*dim codes, one vector after another
+	scales      []float32 // n scales for PerVector, dim scales for PerDimension
+	norms       []float32 // L2 norm of each original vector
+	dequantized bool      // Embeddings were reconstructed from the codes
+}
+
+// QuantizeInt8 quantizes the embeddings of index. Assign the result to
+// index.Int8 to search the quantized vectors.
+func QuantizeInt8(index *VectorIndex, scale QuantizationScale) *Int8Vectors {
+	n, dim := len(index.Embeddings), index.Dimension
+	q := &Int8Vectors{
+		Scale: scale,
+		dim:   dim,
+		codes: make([]int8, n*dim),
+		norms: make([]float32, n),
+	}
+
+	switch scale {
+	case PerDimension:
+		q.scales = make([]float32, dim)
+		for _, v := range index.Embeddings {
+			for j, x := range v {
+				q.scales[j] = max(q.scales[j], float32(math.Abs(float64(x))))
+			}
+		}
+		for j := range q.scales {
+			q.scales[j] /= 127
+		}
+	default:
+		q.scales = make([]float32, n)
+		for i, v := range index.Embeddings {
+			for _, x := range v {
+				q.scales[i] = max(q.scales[i], float32(math.Abs(float64(x))))
+			}
+			q.scales[i] /= 127
+		}
+	}
+
+	for i, v := range index.Embeddings {
+		codes := q.codes[i*dim : (i+1)*dim]
+		var norm float64
+		for j, x := range v {
+			codes[j] = quantizeComponent(x, q.scale(i, j))
+			norm += float64(x) * float64(x)
+		}
+		q.norms[i] = float32(math.Sqrt(norm))
+	}
+	return q
+}
+
+// quantizeComponent maps x to the nearest int8 step of the given scale
+func quantizeComponent(x, scale float32) int8 {
+	if scale == 0 {
+		return 0
+	}
+	c := math.Round(float64(x / scale))
+	return int8(max(-127, min(127, c)))
+}
+
+// scale returns the scale factor for component j of vector i
+func (q *Int8Vectors) scale(i, j int) float32 {
+	if q.Scale == PerDimension {
+		return q.scales[j]
+	}
+	return q.scales[i]
+}
+
+// Len returns the number of quantized vectors
+func (q *Int8Vectors) Len() int {
+	return len(q.norms)
+}
+
+// Dequantize reconstructs an approximation of vector i
+func (q *Int8Vectors) Dequantize(i int) []float32 {
+	v := make([]float32, q.dim)
+	q.dequantizeInto(v, i)
+	return v
+}
+
+func (q *Int8Vectors) dequantizeInto(v []float32, i int) {
+	codes := q.codes[i*q.dim : (i+1)*q.dim]
+	for j, c := range codes {
+		v[j] = float32(c) * q.scale(i, j)
+	}
+}
+
+// dequantizeAll reconstructs every vector into one contiguous buffer
+func (q *Int8Vectors) dequantizeAll() [][]float32 {
+	vectors := splitVectors(make([]float32, len(q.codes)), q.Len(), q.dim)
+	for i, v := range vectors {
+		q.dequantizeInto(v, i)
+	}
+	return vectors
+}
+
+// search scores every quantized vector accepted by mask against query, then
+// rescores the best candidates with the float32 vectors if configured
+func (q *Int8Vectors) search(vectors [][]float32, query []float32, mask chunkMask, topK int, threshold float32) []hit {
+	var qnorm float64
+	for _, x := range query {
+		qnorm += float64(x) * float64(x)
+	}
+	if qnorm == 0 {
+		return nil
+	}
+	qnorm = math.Sqrt(qnorm)
+
+	// Fold per-dimension scales into the query once
+	scaled := query
+	if q.Scale == PerDimension {
+		scaled = make([]float32, q.dim)
+		for j, x := range query {
+			scaled[j] = x * q.scales[j]
+		}
+	}
+
+	rescore := q.Rescore > 0 && !q.dequantized && topK > 0
+	candidates, minScore := topK, threshold
+	if rescore {
+		// Quantized scores are approximate, so collect extra candidates and
+		// apply the threshold only after rescoring
+		candidates, minScore = topK*q.Rescore, float32(math.Inf(-1))
+	}
+
+	results := newBestHits(candidates)
+	for i := range q.norms {
+		if q.norms[i] == 0 || !mask.has(i) {
+			continue
+		}
+		dot := dotInt8(scaled, q.codes[i*q.dim:(i+1)*q.dim])
+		if q.Scale == PerVector {
+			dot *= q.scales[i]
+		}
+		score := dot / (float32(qnorm) * q.norms[i])
+		if score >= minScore {
+			results.push(hit{idx: i, score: score})
+		}
+	}
+	if !rescore {
+		return results.hits()
+	}
+	return rescoreHits(vectors, query, results.hits(), topK, threshold)
+}
+
+// dotInt8 computes the dot product of a float32 query and int8 codes
+func dotInt8(q []float32, codes []int8) float32 {
+	var sum float32
+	for j, c := range codes {
+		sum += q[j] * float32(c)
+	}
+	return sum
+}
+
+// marshal encodes the quantized vectors as the payload of an INT8 section:
+//
+//	scale mode uint8, flags uint8 (bit 0: DropFloat32), rescore uint32,
+//	dimension uint32, vector count uint32,
+//	scales: float32 (count or dimension of them), norms: count float32,
+//	codes: count*dimension int8
+func (q *Int8Vectors) marshal() []byte {
+	var w binWriter
+	w.u8(uint8(q.Scale))
+	var flags uint8
+	if q.DropFloat32 {
+		flags |= 1
+	}
+	w.u8(flags)
+	w.u32(uint32(q.Rescore))
+	w.u32(uint32(q.dim))
+	w.u32(uint32(q.Len()))
+	w.f32s(q.scales)
+	w.f32s(q.norms)
+	if len(q.codes) > 0 {
+		w.bytes(unsafe.Slice((*byte)(unsafe.Pointer(&q.codes[0])), len(q.codes)))
+	}
+	return w.buf
+}
+
+// unmarshalInt8 decodes an INT8 section for an index of n chunks and the
+// given dimension
+func unmarshalInt8(data []byte, n, dim int) (*Int8Vectors, error) {
+	r := &binReader{buf: data}
+	q := &Int8Vectors{Scale: QuantizationScale(r.u8())}
+	q.DropFloat32 = r.u8()&1 != 0
+	q.Rescore = int(r.u32())
+	q.dim = int(r.u32())
+	count := int(r.u32())
+	if r.err != nil {
+		return nil, r.err
+	}
+	if count != n {
+		return nil, fmt.Errorf("%w: %d int8 vectors, index has %d chunks", ErrCountMismatch, count, n)
+	}
+	if q.dim != dim {
+		return nil, fmt.Errorf("%w: int8 vectors have dimension %d, index has %d", ErrDimensionMismatch, q.dim, dim)
+	}
+
+	scales := n
+	if q.Scale == PerDimension {
+		scales = dim
+	}
+	q.scales = r.f32s(scales)
+	q.norms = r.f32s(n)
+	raw := r.take(n * dim)
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(raw) > 0 {
+		// int8 and byte share a layout, so the codes alias the payload
+		q.codes = unsafe.Slice((*int8)(unsafe.Pointer(&raw[0])), len(raw))
+	}
+	return q, nil
+}
@@ -0,0 +1,110 @@
+package minirag
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestQuantizeInt8Error(t *testing.T) {
+	index := randomIndex(200, 64, 9)
+
+	for _, scale := range []QuantizationScale{PerVector, PerDimension} {
+		q := QuantizeInt8(index, scale)
+		var worst float64
+		for i, v := range index.Embeddings {
+			for j, x := range q.Dequantize(i) {
+				worst = max(worst, math.Abs(float64(x-v[j])))
+			}
+		}
+		// Unit vectors in 64 dimensions have components well below 1, so
+		// half a quantization step is at most 1/254
+		if worst > 1.0/254+1e-6 {
+			t.Errorf("Scale %d: max reconstruction error %.5f too large", scale, worst)
+		}
+	}
+}
+
+func TestInt8Recall(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		scale   QuantizationScale
+		rescore int
+		want    float64
+	}{
+		{"per-vector", PerVector, 0, 0.9},
+		{"per-dimension", PerDimension, 0, 0.9},
+		{"rescored", PerVector, 4, 0.99},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			index := randomIndex(2000, 64, 10)
+			index.Int8 = QuantizeInt8(index, tt.scale)
+			index.Int8.Rescore = tt.rescore
+
+			r := meanRecall(t, index, 50, 10)
+			t.Logf("int8 recall@10: %.3f", r)
+			if r < tt.want {
+				t.Errorf("Expected recall@10 >= %.2f, got %.3f", tt.want, r)
+			}
+		})
+	}
+}
+
+func TestInt8RescoreExactScores(t *testing.T) {
+	index := randomIndex(300, 32, 11)
+	index.Int8 = QuantizeInt8(index, PerDimension)
+	index.Int8.Rescore = 3
+
+	q := index.Embeddings[5]
+	results := Search(index, q, 3, 0)
+	if len(results) == 0 || results[0].Chunk.Offset != 5 {
+		t.Fatalf("Expected exact match first, got %+v", results)
+	}
+	for _, r := range results {
+		want := CosineSimilarity(q, index.Embeddings[r.Chunk.Offset])
+		if r.Score != want {
+			t.Errorf("Expected rescored score %.6f, got %.6f", want, r.Score)
+		}
+	}
+}
+
+func TestInt8Persistence(t *testing.T) {
+	index := randomIndex(300, 32, 12)
+	index.Int8 = QuantizeInt8(index, PerVector)
+	index.Int8.Rescore = 2
+
+	var full bytes.Buffer
+	if err := WriteIndex(&full, index); err != nil {
+		t.Fatalf("WriteIndex: %v", err)
+	}
+
+	index.Int8.DropFloat32 = true
+	var small bytes.Buffer
+	if err := WriteIndex(&small, index); err != nil {
+		t.Fatalf("WriteIndex: %v", err)
+	}
+
+	vectorBytes := 300 * 32 * 4
+	if full.Len()-small.Len() < vectorBytes {
+		t.Errorf("Expected dropping float32 to save at least %d bytes, saved %d", vectorBytes, full.Len()-small.Len())
+	}
+
+	loaded, err := LoadIndexFromBytes(small.Bytes())
+	if err != nil {
+		t.Fatalf("LoadIndexFromBytes: %v", err)
+	}
+	if loaded.Int8 == nil || !loaded.Int8.DropFloat32 || loaded.Int8.Rescore != 2 {
+		t.Fatalf("Int8 vectors not round-tripped: %+v", loaded.Int8)
+	}
+	if len(loaded.Embeddings) != 300 {
+		t.Fatalf("Expected dequantized embeddings, got %d", len(loaded.Embeddings))
+	}
+	if s := CosineSimilarity(loaded.Embeddings[7], index.Embeddings[7]); s < 0.999 {
+		t.Errorf("Dequantized embedding too far from original: similarity %.4f", s)
+	}
+
+	results := Search(loaded, index.Embeddings[7], 1, 0)
+	if len(results) != 1 || results[0].Chunk.Offset != 7 {
+		t.Errorf("Expected chunk 7, got %+v", results)
+	}
+}
@@ -0,0 +1,69 @@
+package minirag
+
+// ReindexPlan tells which chunks of a new corpus can reuse the embeddings of
+// a previous index
+type ReindexPlan struct {
+	// Embeddings holds the reused embedding of each chunk, in the order of
+	// the new chunks, and nil for the chunks that must be embedded
+	Embeddings [][]float32
+
+	Reused  int // Chunks whose path, heading and content are unchanged
+	Changed int // Chunks replacing a section of the same path and heading
+	Added   int // Chunks in sections the previous index did not have
+	Removed int // Previous chunks without a counterpart
+}
+
+// PlanReindex matches chunks against the chunks of prev by ChunkHash. Only
+// chunks that are new or whose text changed need embedding. A nil prev, or
+// one whose float32 vectors were dropped in favour of int8 or PQ codes,
+// reuses nothing.
+//
+// The caller must check that prev was embedded with the same model.
+func PlanReindex(prev *VectorIndex, chunks []Chunk) ReindexPlan {
+	plan := ReindexPlan{Embeddings: make([][]float32, len(chunks))}
+	if prev == nil || prev.dropsFloat32() {
+		plan.Added = len(chunks)
+		if prev != nil {
+			plan.Removed = len(prev.Chunks)
+		}
+		return plan
+	}
+
+	previous := make(map[string][]float32, len(prev.Chunks))
+	for i, c := range prev.Chunks {
+		previous[ChunkHash(c)] = prev.Embeddings[i]
+	}
+	used := make(map[string]bool)
+	for i, c := range chunks {
+		h := ChunkHash(c)
+		if emb, ok := previous[h]; ok {
+			plan.Embeddings[i] = emb
+			plan.Reused++
+			used[h] = true
+		}
+	}
+
+	// Previous chunks left over are either edited, when a new chunk has the
+	// same path and heading, or gone
+	type section struct{ path, heading string }
+	leftover := make(map[section]int)
+	for _, c := range prev.Chunks {
+		if !used[ChunkHash(c)] {
+			leftover[section{c.Path, c.Heading}]++
+			plan.Removed++
+		}
+	}
+	for i, c := range chunks {
+		if plan.Embeddings[i] != nil {
+			continue
+		}
+		if s := (section{c.Path, c.Heading}); leftover[s] > 0 {
+			leftover[s]--
+			plan.Changed++
+			plan.Removed--
+		} else {
+			plan.Added++
+		}
+	}
+	return plan
+}
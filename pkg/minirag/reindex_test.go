@@ -0,0 +1,38 @@
+package minirag
+
+import "testing"
+
+func TestPlanReindex(t *testing.T) {
+	prev := BuildIndex([]Chunk{
+		{Path: "a.md", Heading: "Intro", Content: "alpha"},
+		{Path: "a.md", Heading: "Usage", Content: "old usage"},
+		{Path: "b.md", Heading: "B", Content: "beta"},
+	}, [][]float32{{1, 0}, {0, 1}, {1, 1}}, 2)
+
+	chunks := []Chunk{
+		{Path: "a.md", Heading: "Intro", Content: "alpha", Offset: 42}, // Moved
+		{Path: "a.md", Heading: "Usage", Content: "new usage"},
+		{Path: "c.md", Heading: "C", Content: "gamma"},
+	}
+	plan := PlanReindex(prev, chunks)
+
+	if plan.Reused != 1 || plan.Changed != 1 || plan.Added != 1 || plan.Removed != 1 {
+		t.Errorf("Expected 1 reused, changed, added and removed, got %+v", plan)
+	}
+	if e := plan.Embeddings[0]; len(e) != 2 || e[0] != 1 || e[1] != 0 {
+		t.Errorf("Expected the embedding of the unchanged chunk, got %v", e)
+	}
+	if plan.Embeddings[1] != nil || plan.Embeddings[2] != nil {
+		t.Error("Expected changed and added chunks to need embedding")
+	}
+
+	// int8-only indexes hold only approximate vectors, not worth reusing
+	prev.Int8 = QuantizeInt8(prev, PerVector)
+	prev.Int8.DropFloat32 = true
+	if plan := PlanReindex(prev, chunks); plan.Added != 3 || plan.Removed != 3 {
+		t.Errorf("Expected nothing reused from an int8-only index, got %+v", plan)
+	}
+	if plan := PlanReindex(nil, chunks); plan.Added != 3 || plan.Removed != 0 {
+		t.Errorf("Expected every chunk added without a previous index, got %+v", plan)
+	}
+}
@@ -1,8 +1,10 @@
 package minirag
 
 import (
+	"fmt"
 	"math"
-	"sort"
+	"runtime"
+	"sync"
 )
 
 // CosineSimilarity computes the cosine similarity between two vectors
@@ -26,38 +28,219 @@ func CosineSimilarity(a, b []float32) float32 {
 	return dotProduct / (float32(math.Sqrt(float64(normA))) * float32(math.Sqrt(float64(normB))))
 }
 
+// SearchMode selects the search strategy of a VectorIndex
+type SearchMode uint8
+
+const (
+	// ModeAuto uses the first attached structure of HNSW, IVF, Int8,
+	// Binary and PQ, or an exact scan if there is none
+	ModeAuto SearchMode = iota
+	ModeExact
+	ModeHNSW
+	ModeIVF
+	ModeInt8
+	ModeBinary
+	ModePQ
+)
+
+var modeNames = []string{"auto", "exact", "hnsw", "ivf", "int8", "binary", "pq"}
+
+// String returns the mode name as accepted by ParseSearchMode
+func (m SearchMode) String() string {
+	if int(m) < len(modeNames) {
+		return modeNames[m]
+	}
+	return fmt.Sprintf("SearchMode(%d)", m)
+}
+
+// ParseSearchMode returns the mode with the given name
+func ParseSearchMode(name string) (SearchMode, error) {
+	for i, n := range modeNames {
+		if n == name {
+			return SearchMode(i), nil
+		}
+	}
+	return ModeAuto, fmt.Errorf("unknown search mode %q", name)
+}
+
+// resolveMode returns the mode Search will actually use. A mode whose
+// structure is not attached falls back to an exact scan. HNSW needs a
+// result limit, so it is not used when topK <= 0.
+func (idx *VectorIndex) resolveMode(topK int) SearchMode {
+	mode := idx.Mode
+	if mode == ModeAuto {
+		switch {
+		case idx.HNSW != nil:
+			mode = ModeHNSW
+		case idx.IVF != nil:
+			mode = ModeIVF
+		case idx.Int8 != nil:
+			mode = ModeInt8
+		case idx.Binary != nil:
+			mode = ModeBinary
+		case idx.PQ != nil:
+			mode = ModePQ
+		}
+	}
+
+	switch {
+	case mode == ModeHNSW && idx.HNSW != nil && topK > 0,
+		mode == ModeIVF && idx.IVF != nil,
+		mode == ModeInt8 && idx.Int8 != nil,
+		mode == ModeBinary && idx.Binary != nil,
+		mode == ModePQ && idx.PQ != nil:
+		return mode
+	}
+	return ModeExact
+}
+
 // Search performs similarity search on the vector index
 // Returns top-k results sorted by similarity score (highest first)
+// The index's Mode decides whether an attached approximate structure or an
+// exact scan over every chunk is used
 func Search(index *VectorIndex, queryEmbedding []float32, topK int, threshold float32) []SearchResult {
+	return SearchWithOptions(index, queryEmbedding, SearchOptions{TopK: topK, Threshold: threshold})
+}
+
+// SearchOptions configures SearchWithOptions
+type SearchOptions struct {
+	TopK      int     // Maximum number of results; <= 0 returns every match
+	Threshold float32 // Minimum similarity score
+	Filter    Filter  // Optional; chunks that do not match are never scored
+}
+
+// selectiveFilter is the fraction of chunks below which a filtered HNSW or
+// IVF search is replaced by an exact scan of the matching chunks: the graph
+// or the probed lists would hold too few of them to fill topK
+const selectiveFilter = 0.1
+
+// SearchWithOptions is Search with a metadata filter. The filter is
+// evaluated for every chunk before any vector is scored, so the approximate
+// structures only ever return matching chunks.
+func SearchWithOptions(index *VectorIndex, queryEmbedding []float32, opts SearchOptions) []SearchResult {
 	if len(queryEmbedding) != index.Dimension {
 		return nil
 	}
+	mask, matches := index.filterMask(opts.Filter)
+	if matches == 0 {
+		return nil
+	}
+	return toResults(index, index.vectorHits(queryEmbedding, mask, matches, opts.TopK, opts.Threshold))
+}
+
+// filterMask evaluates f for every chunk and returns the mask along with the
+// number of matching chunks. Chunks deleted from a MutableIndex never match.
+// A nil filter without deleted chunks returns a nil mask.
+func (idx *VectorIndex) filterMask(f Filter) (chunkMask, int) {
+	if idx.deleted > 0 {
+		mask := make(chunkMask, len(idx.Chunks))
+		matches := 0
+		for i := range idx.Chunks {
+			if !idx.tombstones[i] && (f == nil || f.Match(&idx.Chunks[i])) {
+				mask[i] = true
+				matches++
+			}
+		}
+		return mask, matches
+	}
+	if f == nil {
+		return nil, len(idx.Chunks)
+	}
+	return filterMask(idx.Chunks, f)
+}
 
-	results := make([]SearchResult, 0, len(index.Chunks))
+// ResolveMode returns the mode SearchWithOptions uses for opts: the index's
+// Mode, or for ModeAuto the first attached structure, falling back to an
+// exact scan when the structure is missing, TopK is unlimited for HNSW, or
+// the filter is too selective for HNSW or IVF
+func (idx *VectorIndex) ResolveMode(opts SearchOptions) SearchMode {
+	mask, matches := idx.filterMask(opts.Filter)
+	return idx.filteredMode(mask, matches, opts.TopK)
+}
 
-	// Compute similarity for all chunks
-	for i := range index.Chunks {
-		score := CosineSimilarity(queryEmbedding, index.Embeddings[i])
+// filteredMode is resolveMode for a search over the chunks accepted by
+// mask, of which there are matches
+func (idx *VectorIndex) filteredMode(mask chunkMask, matches, topK int) SearchMode {
+	mode := idx.resolveMode(topK)
+	if mask != nil && (mode == ModeHNSW || mode == ModeIVF) && float64(matches) < selectiveFilter*float64(len(idx.Chunks)) {
+		return ModeExact
+	}
+	return mode
+}
 
-		// Only include results above threshold
-		if score >= threshold {
-			results = append(results, SearchResult{
-				Chunk: index.Chunks[i],
-				Score: score,
-			})
-		}
+// vectorHits runs the similarity search selected by the index's mode over
+// the chunks accepted by mask, of which there are matches
+func (idx *VectorIndex) vectorHits(queryEmbedding []float32, mask chunkMask, matches, topK int, threshold float32) []hit {
+	switch idx.filteredMode(mask, matches, topK) {
+	case ModeHNSW:
+		return idx.HNSW.search(idx.Embeddings, queryEmbedding, mask, topK, threshold)
+	case ModeIVF:
+		return idx.IVF.search(idx.Embeddings, queryEmbedding, mask, topK, threshold)
+	case ModeInt8:
+		return idx.Int8.search(idx.Embeddings, queryEmbedding, mask, topK, threshold)
+	case ModeBinary:
+		return idx.Binary.search(idx.Embeddings, queryEmbedding, mask, topK, threshold)
+	case ModePQ:
+		return idx.PQ.search(idx.Embeddings, queryEmbedding, mask, topK, threshold)
+	default:
+		return exactSearch(idx, queryEmbedding, mask, topK, threshold)
 	}
+}
 
-	// Sort by score descending
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].Score > results[j].Score
-	})
+// parallelThreshold is the smallest index that exactSearch splits across
+// goroutines; below it the scheduling overhead outweighs the gain
+const parallelThreshold = 4096
 
-	// Return top-k results
-	if topK > 0 && topK < len(results) {
-		results = results[:topK]
+// exactSearch scores every chunk and returns the top-k hits above threshold.
+// The scan is sharded across GOMAXPROCS goroutines, each keeping a bounded
+// min-heap of its best hits, and the shards are merged at the end.
+func exactSearch(index *VectorIndex, queryEmbedding []float32, mask chunkMask, topK int, threshold float32) []hit {
+	n := len(index.Chunks)
+	workers := 1
+	if n >= parallelThreshold {
+		workers = min(runtime.GOMAXPROCS(0), n/(parallelThreshold/4))
+	}
+	if workers <= 1 {
+		return scanRange(index.Embeddings, queryEmbedding, mask, 0, n, topK, threshold).hits()
 	}
 
+	shards := make([]*bestHits, workers)
+	per := (n + workers - 1) / workers
+	var wg sync.WaitGroup
+	for w := range shards {
+		start, end := w*per, min((w+1)*per, n)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			shards[w] = scanRange(index.Embeddings, queryEmbedding, mask, start, end, topK, threshold)
+		}()
+	}
+	wg.Wait()
+
+	merged := newBestHits(topK)
+	for _, shard := range shards {
+		for _, h := range shard.h {
+			merged.push(h)
+		}
+	}
+	return merged.hits()
+}
+
+// scanRange scores the chunks of vectors[start:end] accepted by mask and
+// collects the best hits
+func scanRange(vectors [][]float32, queryEmbedding []float32, mask chunkMask, start, end, k int, threshold float32) *bestHits {
+	results := newBestHits(k)
+	for i := start; i < end; i++ {
+		if !mask.has(i) {
+			continue
+		}
+		score := CosineSimilarity(queryEmbedding, vectors[i])
+
+		// Only include results above threshold
+		if score >= threshold {
+			results.push(hit{idx: i, score: score})
+		}
+	}
 	return results
 }
 
@@ -67,5 +250,6 @@ func LoadIndex(data *EmbeddingData) *VectorIndex {
 		Chunks:     data.Chunks,
 		Embeddings: data.Embeddings,
 		Dimension:  data.Dimension,
+		ModelInfo:  data.ModelInfo,
 	}
 }
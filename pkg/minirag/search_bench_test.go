@@ -0,0 +1,95 @@
+package minirag
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"testing"
+)
+
+const benchDim = 128
+
+var benchSizes = []int{10_000, 100_000, 1_000_000}
+
+// syntheticIndex returns an index of n random unit vectors, cached between
+// benchmarks since building the larger ones takes a while
+var syntheticIndexes = map[int]*VectorIndex{}
+
+func syntheticIndex(n int) *VectorIndex {
+	if index, ok := syntheticIndexes[n]; ok {
+		return index
+	}
+	rng := rand.New(rand.NewPCG(uint64(n), 3))
+	flat := make([]float32, n*benchDim)
+	for i := range flat {
+		flat[i] = rng.Float32() - 0.5
+	}
+	embeddings := splitVectors(flat, n, benchDim)
+	for _, v := range embeddings {
+		unitNormalize(v)
+	}
+	index := BuildIndex(make([]Chunk, n), embeddings, benchDim)
+	syntheticIndexes[n] = index
+	return index
+}
+
+// sortSearch is the original Search: collect every hit, sort, truncate
+func sortSearch(index *VectorIndex, queryEmbedding []float32, topK int, threshold float32) []SearchResult {
+	results := make([]SearchResult, 0, len(index.Chunks))
+	for i := range index.Chunks {
+		score := CosineSimilarity(queryEmbedding, index.Embeddings[i])
+		if score >= threshold {
+			results = append(results, SearchResult{Chunk: index.Chunks[i], Score: score})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if topK > 0 && topK < len(results) {
+		results = results[:topK]
+	}
+	return results
+}
+
+func benchmarkSearch(b *testing.B, search func(*VectorIndex, []float32, int, float32) []SearchResult) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			if n > 100_000 && testing.Short() {
+				b.Skip("skipping 1M vectors in short mode")
+			}
+			index := syntheticIndex(n)
+			q := randomVector(rand.New(rand.NewPCG(1, 1)), benchDim)
+			b.ResetTimer()
+			for b.Loop() {
+				search(index, q, 5, -1)
+			}
+		})
+	}
+}
+
+func BenchmarkSearch(b *testing.B) {
+	benchmarkSearch(b, Search)
+}
+
+func BenchmarkSearchSortBaseline(b *testing.B) {
+	benchmarkSearch(b, sortSearch)
+}
+
+func TestExactSearchMatchesSortBaseline(t *testing.T) {
+	index := randomIndex(parallelThreshold*3, 32, 20)
+	q := randomVector(rand.New(rand.NewPCG(5, 5)), 32)
+
+	for _, topK := range []int{1, 5, 50, 0} {
+		want := sortSearch(index, q, topK, 0.1)
+		got := Search(index, q, topK, 0.1)
+		if len(want) != len(got) {
+			t.Fatalf("topK=%d: expected %d results, got %d", topK, len(want), len(got))
+		}
+		for i := range want {
+			if want[i].Score != got[i].Score {
+				t.Errorf("topK=%d: result %d has score %.6f, want %.6f", topK, i, got[i].Score, want[i].Score)
+				break
+			}
+		}
+	}
+}
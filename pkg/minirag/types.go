@@ -1,11 +1,42 @@
 package minirag
 
+import (
+	"strings"
+	"time"
+)
+
 // Chunk represents a piece of a document with its content and metadata
 type Chunk struct {
-	Path    string // File path relative to docs/
-	Content string // The actual text content
-	Heading string // Section heading if applicable
-	Offset  int    // Character offset in original file
+	ID      string `json:"id,omitempty"` // Stable key, e.g. "guide.md#install/linux"; see MutableIndex
+	Path    string `json:"path"`         // File path relative to docs/
+	Content string `json:"content"`      // The actual text content
+	Heading string `json:"heading"`      // Section heading if applicable
+	Offset  int    `json:"offset"`       // Character offset in original file
+
+	// Position in the original file: the byte offset just past the last
+	// line, and the first and last lines, counting from 1
+	EndOffset int `json:"end_offset,omitempty"`
+	StartLine int `json:"start_line,omitempty"`
+	EndLine   int `json:"end_line,omitempty"`
+
+	HeadingPath  []string `json:"heading_path,omitempty"`  // Enclosing headings, outermost first, ending with Heading
+	HeadingLevel int      `json:"heading_level,omitempty"` // 1 for "#", 2 for "##"; 0 without a heading
+	Title        string   `json:"title,omitempty"`         // Title of the document
+	ContentHash  string   `json:"content_hash,omitempty"`  // Hex SHA-256 of Content
+	Tokens       int      `json:"tokens,omitempty"`        // Approximate token count of Content
+
+	// Metadata holds free-form attributes, such as front matter fields, that
+	// a Filter can select on
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Breadcrumb returns the heading hierarchy joined by " > ", as in
+// "Install > Linux > Debian", or Heading for chunks without one
+func (c Chunk) Breadcrumb() string {
+	if len(c.HeadingPath) == 0 {
+		return c.Heading
+	}
+	return strings.Join(c.HeadingPath, " > ")
 }
 
 // EmbeddingData holds all pre-computed embeddings and their associated chunks
@@ -27,4 +58,21 @@ type VectorIndex struct {
 	Chunks     []Chunk     // Document chunks
 	Embeddings [][]float32 // Corresponding embeddings (chunk[i] ↔ embedding[i])
 	Dimension  int         // Embedding vector dimension
+	ModelInfo  string      // Model name/version used to create the embeddings
+	BuiltAt    time.Time   // When the index was built (zero for legacy indexes)
+	SourceHash string      // SourceHash of the chunks (empty for legacy indexes)
+
+	HNSW   *HNSW          // Optional graph for approximate search, see BuildHNSW
+	IVF    *IVF           // Optional inverted file for partitioned search, see BuildIVF
+	Int8   *Int8Vectors   // Optional int8 quantized vectors, see QuantizeInt8
+	Binary *BinaryVectors // Optional sign bits for a Hamming prefilter, see QuantizeBinary
+	PQ     *PQCodes       // Optional product-quantized codes, see QuantizePQ
+	BM25   *BM25          // Optional inverted index for lexical search, see BuildBM25
+
+	Mode SearchMode // Which of the structures above Search uses
+
+	// Chunks deleted from a MutableIndex stay in place until it is
+	// compacted, marked in tombstones, so searches skip them
+	tombstones []bool
+	deleted    int
 }